@@ -0,0 +1,375 @@
+package embedcache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DirName is the conventional name of the cache directory.
+const DirName = ".code-context"
+
+// DefaultMaxBytes is the size cap used when Open is given none.
+const DefaultMaxBytes = 512 * 1024 * 1024
+
+// VectorsDir is the directory inside the cache that holds vector indexes
+// (*.hnsw files). They count toward the size cap like the embeddings, and
+// are evicted the same way; an evicted index is rebuilt from the cached
+// embeddings.
+const VectorsDir = "vectors"
+
+// entryMagic starts every entry file, followed by a format version.
+const entryMagic = "CCEV"
+
+const entryVersion = 1
+
+// Key identifies an embedding. Any difference in the embedded text, the
+// model that produced the vector or the way the text was cut out of its file
+// leads to a different entry.
+type Key struct {
+	ContentHash string // Hex SHA-256 of the embedded text
+	Provider    string // Embedding provider ("ollama", "gemini", ...)
+	Model       string // Embedding model
+	Chunking    string // Description of how the text was produced (e.g. "chunks:v1:lines=60:overlap=10")
+}
+
+// NewKey builds a key for text embedded with the given settings.
+func NewKey(text, provider, model, chunking string) Key {
+	sum := sha256.Sum256([]byte(text))
+	return Key{ContentHash: hex.EncodeToString(sum[:]), Provider: provider, Model: model, Chunking: chunking}
+}
+
+// id returns the file name of the entry.
+func (k Key) id() string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{k.ContentHash, k.Provider, k.Model, k.Chunking}, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// entryHeader is stored in front of the vector, for inspection.
+type entryHeader struct {
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+	Chunking string `json:"chunking"`
+	Dims     int    `json:"dims"`
+}
+
+// Cache stores embeddings as files under a directory, one per entry. Vectors
+// are stored as float32. When the total size of the entries and the vector
+// indexes exceeds the cap, the least recently used files are evicted;
+// reading an entry counts as a use. A Cache is safe for concurrent use, and
+// several processes may share the same directory.
+type Cache struct {
+	dir      string // Root of the cache (usually .code-context)
+	maxBytes int64  // Size cap for the embeddings and vector indexes
+
+	mu   sync.Mutex
+	size int64 // Current size of all entries and vector indexes, in bytes
+}
+
+// Open opens or creates the cache under dir. A maxBytes of 0 or less uses
+// DefaultMaxBytes.
+func Open(dir string, maxBytes int64) (*Cache, error) {
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBytes
+	}
+	c := &Cache{dir: dir, maxBytes: maxBytes}
+	if err := os.MkdirAll(c.entriesDir(), 0o755); err != nil {
+		return nil, fmt.Errorf("error creating embedding cache: %w", err)
+	}
+	// Keep the cache out of version control when it lives inside a repository
+	if ignoreFile := filepath.Join(dir, ".gitignore"); !fileExists(ignoreFile) {
+		os.WriteFile(ignoreFile, []byte("# Created by code-context\n*\n"), 0o644)
+	}
+
+	entries, err := c.list()
+	if err != nil {
+		return nil, fmt.Errorf("error reading embedding cache: %w", err)
+	}
+	for _, e := range entries {
+		c.size += e.size
+	}
+	return c, nil
+}
+
+// Dir returns the root directory of the cache.
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+func (c *Cache) entriesDir() string {
+	return filepath.Join(c.dir, "embeddings")
+}
+
+func (c *Cache) vectorsDir() string {
+	return filepath.Join(c.dir, VectorsDir)
+}
+
+func (c *Cache) entryPath(k Key) string {
+	id := k.id()
+	return filepath.Join(c.entriesDir(), id[:2], id+".vec")
+}
+
+// Get returns the cached embedding for k.
+func (c *Cache) Get(k Key) ([]float64, bool) {
+	name := c.entryPath(k)
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, false
+	}
+	_, vector, err := decodeEntry(data)
+	if err != nil {
+		os.Remove(name) // Corrupt or from an incompatible version
+		return nil, false
+	}
+
+	// Mark the entry as recently used for eviction
+	now := time.Now()
+	os.Chtimes(name, now, now)
+	return vector, true
+}
+
+// Put stores the embedding for k, evicting old entries if the cache grows
+// beyond its cap.
+func (c *Cache) Put(k Key, vector []float64) error {
+	data, err := encodeEntry(entryHeader{Provider: k.Provider, Model: k.Model, Chunking: k.Chunking, Dims: len(vector)}, vector)
+	if err != nil {
+		return err
+	}
+
+	name := c.entryPath(k)
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+	var previous int64
+	if info, err := os.Stat(name); err == nil {
+		previous = info.Size()
+	}
+
+	// Write to a temporary file first so readers never see partial entries
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.size += int64(len(data)) - previous
+	if c.size > c.maxBytes {
+		return c.evict()
+	}
+	return nil
+}
+
+// Touch marks a file written into the cache directory by its user, such as a
+// vector index, as recently used, so that eviction keeps it.
+func (c *Cache) Touch(name string) {
+	now := time.Now()
+	os.Chtimes(name, now, now)
+}
+
+// Refresh recounts the size of the cache after its user wrote files into
+// it, such as vector indexes, and evicts old files if it grew beyond its cap.
+func (c *Cache) Refresh() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.evict()
+}
+
+// evict removes the least recently used files until the cache is at 90%
+// of its cap, leaving room for new entries before the next eviction. The
+// caller holds c.mu.
+func (c *Cache) evict() error {
+	entries, err := c.list()
+	if err != nil {
+		return err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].modTime.Before(entries[j].modTime) })
+
+	c.size = 0
+	for _, e := range entries {
+		c.size += e.size
+	}
+	target := c.maxBytes / 10 * 9
+	for _, e := range entries {
+		if c.size <= target {
+			break
+		}
+		if err := os.Remove(e.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		c.size -= e.size
+	}
+	return nil
+}
+
+// cacheEntry is an entry file or vector index found on disk.
+type cacheEntry struct {
+	path    string
+	size    int64
+	modTime time.Time
+	index   bool // A vector index rather than an embedding
+}
+
+// list returns every entry file and vector index.
+func (c *Cache) list() ([]cacheEntry, error) {
+	var entries []cacheEntry
+	for _, dir := range []struct {
+		path string
+		ext  string
+	}{{c.entriesDir(), ".vec"}, {c.vectorsDir(), ".hnsw"}} {
+		err := filepath.WalkDir(dir.path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if d.IsDir() || filepath.Ext(p) != dir.ext {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil // Removed by another process
+			}
+			entries = append(entries, cacheEntry{path: p, size: info.Size(), modTime: info.ModTime(), index: dir.ext == ".hnsw"})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// Stats describes the content of a cache.
+type Stats struct {
+	Dir        string         // Root directory of the cache
+	Entries    int            // Number of cached embeddings
+	Indexes    int            // Number of vector indexes
+	Bytes      int64          // Total size of the entries and vector indexes, compared with MaxBytes
+	IndexBytes int64          // Size of the vector indexes alone
+	MaxBytes   int64          // Size cap
+	Oldest     time.Time      // Least recent use of an entry
+	Newest     time.Time      // Most recent use of an entry
+	ByModel    map[string]int // Entries per "provider/model"
+}
+
+// Stats reads every entry header and summarizes the cache.
+func (c *Cache) Stats() (Stats, error) {
+	stats := Stats{Dir: c.dir, MaxBytes: c.maxBytes, ByModel: make(map[string]int)}
+	entries, err := c.list()
+	if err != nil {
+		return stats, err
+	}
+	for _, e := range entries {
+		stats.Bytes += e.size
+		if e.index {
+			stats.Indexes++
+			stats.IndexBytes += e.size
+			continue
+		}
+		stats.Entries++
+		if stats.Oldest.IsZero() || e.modTime.Before(stats.Oldest) {
+			stats.Oldest = e.modTime
+		}
+		if e.modTime.After(stats.Newest) {
+			stats.Newest = e.modTime
+		}
+		data, err := os.ReadFile(e.path)
+		if err != nil {
+			continue
+		}
+		if header, _, err := decodeEntry(data); err == nil {
+			stats.ByModel[header.Provider+"/"+header.Model]++
+		}
+	}
+	return stats, nil
+}
+
+// Clear removes every cached embedding and vector index.
+func (c *Cache) Clear() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := os.RemoveAll(c.vectorsDir()); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(c.entriesDir()); err != nil {
+		return err
+	}
+	c.size = 0
+	return os.MkdirAll(c.entriesDir(), 0o755)
+}
+
+// fileExists reports whether name exists.
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+// encodeEntry serializes a header and a vector.
+func encodeEntry(header entryHeader, vector []float64) ([]byte, error) {
+	meta, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.WriteString(entryMagic)
+	buf.WriteByte(entryVersion)
+	binary.Write(&buf, binary.LittleEndian, uint16(len(meta)))
+	buf.Write(meta)
+	for _, v := range vector {
+		binary.Write(&buf, binary.LittleEndian, math.Float32bits(float32(v)))
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeEntry parses an entry file.
+func decodeEntry(data []byte) (entryHeader, []float64, error) {
+	var header entryHeader
+	if len(data) < len(entryMagic)+3 || string(data[:len(entryMagic)]) != entryMagic || data[len(entryMagic)] != entryVersion {
+		return header, nil, fmt.Errorf("not an embedding cache entry")
+	}
+	data = data[len(entryMagic)+1:]
+	metaLen := int(binary.LittleEndian.Uint16(data))
+	data = data[2:]
+	if len(data) < metaLen {
+		return header, nil, fmt.Errorf("truncated embedding cache entry")
+	}
+	if err := json.Unmarshal(data[:metaLen], &header); err != nil {
+		return header, nil, err
+	}
+	data = data[metaLen:]
+	if len(data) != header.Dims*4 {
+		return header, nil, fmt.Errorf("truncated embedding cache entry")
+	}
+
+	vector := make([]float64, header.Dims)
+	for i := range vector {
+		vector[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(data[i*4:])))
+	}
+	return header, vector, nil
+}
@@ -0,0 +1,78 @@
+package embedcache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeIndex writes a vector index of the given size into the cache, last
+// used at modTime.
+func writeIndex(t *testing.T, c *Cache, name string, size int, modTime time.Time) string {
+	t.Helper()
+	p := filepath.Join(c.Dir(), VectorsDir, name)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, make([]byte, size), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(p, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestVectorIndexesCountTowardTheCap(t *testing.T) {
+	dir := t.TempDir()
+	c, err := Open(dir, 10_000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := NewKey("func main() {}", "ollama", "m", "chunks:v1")
+	if err := c.Put(key, make([]float64, 16)); err != nil {
+		t.Fatal(err)
+	}
+
+	old := writeIndex(t, c, "old.hnsw", 4000, time.Now().Add(-time.Hour))
+	stats, err := c.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Entries != 1 || stats.Indexes != 1 || stats.IndexBytes != 4000 || stats.Bytes <= 4000 {
+		t.Errorf("stats = %+v, want 1 entry and a 4000 byte index in the size", stats)
+	}
+
+	// A new index pushes the cache over its cap; the least recently used
+	// file, the old index, goes first
+	current := writeIndex(t, c, "current.hnsw", 6000, time.Now())
+	if err := c.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Errorf("old index still cached (stat error %v)", err)
+	}
+	if _, err := os.Stat(current); err != nil {
+		t.Errorf("current index evicted: %v", err)
+	}
+	if _, ok := c.Get(key); !ok {
+		t.Error("recently used embedding evicted")
+	}
+
+	// Reopening counts the indexes too
+	reopened, err := Open(dir, 10_000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.size != c.size || c.size <= 6000 {
+		t.Errorf("reopened size = %d, cache size = %d, want equal and above 6000", reopened.size, c.size)
+	}
+
+	if err := c.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(current); !os.IsNotExist(err) {
+		t.Errorf("index survived Clear (stat error %v)", err)
+	}
+}
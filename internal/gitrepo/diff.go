@@ -0,0 +1,325 @@
+package gitrepo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Status describes how a file changed.
+type Status string
+
+const (
+	StatusAdded    Status = "added"
+	StatusModified Status = "modified"
+	StatusRenamed  Status = "renamed"
+	StatusDeleted  Status = "deleted"
+)
+
+// Change is a single changed file.
+type Change struct {
+	Path    string // Slash-separated path relative to the work tree
+	OldPath string // Previous path for renames
+	Status  Status
+
+	hash Hash // Blob id of the added or deleted content, for rename detection
+}
+
+// TrackedFiles returns the paths of every file in the index, sorted.
+// Submodules are excluded.
+func (r *Repo) TrackedFiles() ([]string, error) {
+	entries, err := r.ReadIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var paths []string
+	for _, e := range entries {
+		if e.IsSubmodule() || seen[e.Path] {
+			continue // Conflicted files appear once per stage
+		}
+		seen[e.Path] = true
+		paths = append(paths, e.Path)
+	}
+	sort.Strings(paths)
+
+	return paths, nil
+}
+
+// MergeBase returns a best common ancestor of two commits, as used by the
+// "base...head" revision range syntax.
+func (r *Repo) MergeBase(a, b Hash) (Hash, error) {
+	// Collect every ancestor of a
+	ancestors := make(map[Hash]bool)
+	queue := []Hash{a}
+	for len(queue) > 0 {
+		h := queue[0]
+		queue = queue[1:]
+		if ancestors[h] {
+			continue
+		}
+		ancestors[h] = true
+		commit, err := r.ReadCommit(h)
+		if err != nil {
+			return ZeroHash, err
+		}
+		queue = append(queue, commit.Parents...)
+	}
+
+	// Breadth-first from b finds the closest shared ancestor
+	visited := make(map[Hash]bool)
+	queue = []Hash{b}
+	for len(queue) > 0 {
+		h := queue[0]
+		queue = queue[1:]
+		if ancestors[h] {
+			return h, nil
+		}
+		if visited[h] {
+			continue
+		}
+		visited[h] = true
+		commit, err := r.ReadCommit(h)
+		if err != nil {
+			return ZeroHash, err
+		}
+		queue = append(queue, commit.Parents...)
+	}
+
+	return ZeroHash, fmt.Errorf("commits %s and %s have no common ancestor", a, b)
+}
+
+// DiffCommits lists the files that differ between the trees of two commits.
+// Exact renames (identical content under a new path) are detected.
+func (r *Repo) DiffCommits(base, head Hash) ([]Change, error) {
+	baseCommit, err := r.ReadCommit(base)
+	if err != nil {
+		return nil, err
+	}
+	headCommit, err := r.ReadCommit(head)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []Change
+	if err := r.diffTrees(baseCommit.Tree, headCommit.Tree, "", &changes); err != nil {
+		return nil, err
+	}
+
+	return detectRenames(changes), nil
+}
+
+// diffTrees compares two trees recursively, skipping identical subtrees.
+// A zero hash stands for a tree that does not exist on that side.
+func (r *Repo) diffTrees(oldTree, newTree Hash, prefix string, changes *[]Change) error {
+	if oldTree == newTree {
+		return nil
+	}
+
+	oldEntries, err := r.readTreeMap(oldTree)
+	if err != nil {
+		return err
+	}
+	newEntries, err := r.readTreeMap(newTree)
+	if err != nil {
+		return err
+	}
+
+	names := make(map[string]bool)
+	for name := range oldEntries {
+		names[name] = true
+	}
+	for name := range newEntries {
+		names[name] = true
+	}
+
+	for name := range names {
+		oldEntry, inOld := oldEntries[name]
+		newEntry, inNew := newEntries[name]
+		path := prefix + name
+
+		oldIsDir := inOld && oldEntry.IsDir()
+		newIsDir := inNew && newEntry.IsDir()
+
+		// Recurse into directories present on either side
+		if oldIsDir || newIsDir {
+			var oldSub, newSub Hash
+			if oldIsDir {
+				oldSub = oldEntry.Hash
+			}
+			if newIsDir {
+				newSub = newEntry.Hash
+			}
+			if err := r.diffTrees(oldSub, newSub, path+"/", changes); err != nil {
+				return err
+			}
+		}
+
+		oldIsFile := inOld && !oldIsDir && !oldEntry.IsSubmodule()
+		newIsFile := inNew && !newIsDir && !newEntry.IsSubmodule()
+		switch {
+		case oldIsFile && newIsFile:
+			if oldEntry.Hash != newEntry.Hash || oldEntry.Mode != newEntry.Mode {
+				*changes = append(*changes, Change{Path: path, Status: StatusModified})
+			}
+		case newIsFile:
+			*changes = append(*changes, Change{Path: path, Status: StatusAdded, hash: newEntry.Hash})
+		case oldIsFile:
+			*changes = append(*changes, Change{Path: path, Status: StatusDeleted, hash: oldEntry.Hash})
+		}
+	}
+
+	return nil
+}
+
+// readTreeMap reads a tree into a name-indexed map; the zero hash is empty.
+func (r *Repo) readTreeMap(tree Hash) (map[string]TreeEntry, error) {
+	entries := make(map[string]TreeEntry)
+	if tree.IsZero() {
+		return entries, nil
+	}
+	list, err := r.ReadTree(tree)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range list {
+		entries[e.Name] = e
+	}
+	return entries, nil
+}
+
+// detectRenames pairs deleted and added files with identical content and
+// returns the remaining changes sorted by path.
+func detectRenames(changes []Change) []Change {
+	// Sort first so that pairing is deterministic when contents repeat
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+
+	deletedByHash := make(map[Hash][]int)
+	for i, c := range changes {
+		if c.Status == StatusDeleted && !c.hash.IsZero() {
+			deletedByHash[c.hash] = append(deletedByHash[c.hash], i)
+		}
+	}
+
+	consumed := make(map[int]bool)
+	for i := range changes {
+		c := &changes[i]
+		if c.Status != StatusAdded || c.hash.IsZero() {
+			continue
+		}
+		if candidates := deletedByHash[c.hash]; len(candidates) > 0 {
+			deletedByHash[c.hash] = candidates[1:]
+			consumed[candidates[0]] = true
+			c.Status = StatusRenamed
+			c.OldPath = changes[candidates[0]].Path
+		}
+	}
+
+	var result []Change
+	for i, c := range changes {
+		if !consumed[i] {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// WorktreeChanges lists tracked files whose working tree content differs from
+// HEAD, including staged additions and renames. Untracked files are not
+// reported; callers walking the tree can treat them as added.
+func (r *Repo) WorktreeChanges() ([]Change, error) {
+	headFiles := make(map[string]TreeEntry)
+	if head, err := r.ResolveRevision("HEAD"); err == nil {
+		commit, err := r.ReadCommit(head)
+		if err != nil {
+			return nil, err
+		}
+		if headFiles, err = r.TreeFiles(commit.Tree); err != nil {
+			return nil, err
+		}
+	} // An unborn HEAD compares against an empty tree
+
+	entries, err := r.ReadIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []Change
+	inIndex := make(map[string]bool)
+	for _, e := range entries {
+		if e.IsSubmodule() || inIndex[e.Path] {
+			continue
+		}
+		inIndex[e.Path] = true
+
+		headEntry, inHead := headFiles[e.Path]
+		if e.Stage != 0 {
+			// Unresolved merge conflicts are always worth looking at
+			changes = append(changes, Change{Path: e.Path, Status: StatusModified})
+			continue
+		}
+
+		hash, exists, err := r.worktreeHash(e)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case !exists && inHead:
+			changes = append(changes, Change{Path: e.Path, Status: StatusDeleted, hash: headEntry.Hash})
+		case !exists:
+			// Staged and then removed from disk; nothing left to scan
+		case !inHead:
+			changes = append(changes, Change{Path: e.Path, Status: StatusAdded, hash: hash})
+		case hash != headEntry.Hash:
+			changes = append(changes, Change{Path: e.Path, Status: StatusModified})
+		}
+	}
+
+	// Files removed from the index entirely (git rm) are deletions too
+	for path, entry := range headFiles {
+		if !inIndex[path] {
+			changes = append(changes, Change{Path: path, Status: StatusDeleted, hash: entry.Hash})
+		}
+	}
+
+	return detectRenames(changes), nil
+}
+
+// worktreeHash returns the blob id of the working tree copy of an index entry.
+// The index stat data is trusted when size and mtime are unchanged.
+func (r *Repo) worktreeHash(e IndexEntry) (Hash, bool, error) {
+	fullPath := filepath.Join(r.WorkTree, filepath.FromSlash(e.Path))
+	info, err := os.Lstat(fullPath)
+	if os.IsNotExist(err) {
+		return ZeroHash, false, nil
+	}
+	if err != nil {
+		return ZeroHash, false, fmt.Errorf("error reading %s: %w", e.Path, err)
+	}
+
+	mtime := info.ModTime()
+	if uint32(info.Size()) == e.Size &&
+		uint32(mtime.Unix()) == e.MTimeSec &&
+		uint32(mtime.Nanosecond()) == e.MTimeNsec {
+		return e.Hash, true, nil
+	}
+
+	var content []byte
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(fullPath)
+		if err != nil {
+			return ZeroHash, false, fmt.Errorf("error reading link %s: %w", e.Path, err)
+		}
+		content = []byte(filepath.ToSlash(target))
+	} else {
+		if content, err = os.ReadFile(fullPath); err != nil {
+			return ZeroHash, false, fmt.Errorf("error reading %s: %w", e.Path, err)
+		}
+	}
+
+	return HashBlob(content), true, nil
+}
@@ -0,0 +1,133 @@
+package gitrepo
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// gitChanges runs a git diff with --name-status and returns its changes,
+// sorted by path like the Repo methods return them.
+func gitChanges(t *testing.T, dir string, args ...string) []Change {
+	t.Helper()
+	args = append([]string{"diff", "--name-status", "--no-renames"}, args...)
+	if strings.HasPrefix(args[len(args)-1], "-M") {
+		args[2] = args[len(args)-1] // Rename detection replaces --no-renames
+		args = args[:len(args)-1]
+	}
+	var changes []Change
+	for _, line := range gitLines(t, dir, args...) {
+		fields := strings.Split(line, "\t")
+		switch status := fields[0]; {
+		case status == "A":
+			changes = append(changes, Change{Path: fields[1], Status: StatusAdded})
+		case status == "M" || status == "T":
+			changes = append(changes, Change{Path: fields[1], Status: StatusModified})
+		case status == "D":
+			changes = append(changes, Change{Path: fields[1], Status: StatusDeleted})
+		case strings.HasPrefix(status, "R"):
+			changes = append(changes, Change{Path: fields[2], OldPath: fields[1], Status: StatusRenamed})
+		default:
+			t.Fatalf("unexpected git diff line %q", line)
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+// publicChanges drops the unexported fields of changes for comparisons.
+func publicChanges(changes []Change) []Change {
+	result := make([]Change, len(changes))
+	for i, c := range changes {
+		result[i] = Change{Path: c.Path, OldPath: c.OldPath, Status: c.Status}
+	}
+	return result
+}
+
+func TestMergeBaseMatchesGit(t *testing.T) {
+	for _, storage := range storages {
+		t.Run(storage, func(t *testing.T) {
+			dir := newTestRepo(t, storage)
+			repo := openTestRepo(t, dir)
+			for _, pair := range [][2]string{{"main", "feature"}, {"feature", "main"}, {"feature~1", "feature"}, {"v1", "lw"}} {
+				want := strings.TrimSpace(runGit(t, dir, "merge-base", pair[0], pair[1]))
+				got, err := repo.MergeBase(mustResolve(t, repo, pair[0]), mustResolve(t, repo, pair[1]))
+				if err != nil || got.String() != want {
+					t.Errorf("MergeBase(%s, %s) = %s, %v, want %s", pair[0], pair[1], got, err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDiffCommitsMatchesGit(t *testing.T) {
+	for _, storage := range storages {
+		t.Run(storage, func(t *testing.T) {
+			dir := newTestRepo(t, storage)
+			repo := openTestRepo(t, dir)
+			for _, pair := range [][2]string{{"main", "feature"}, {"feature", "main"}, {"feature~1", "feature"}, {"v1", "main"}, {"main", "main"}} {
+				want := gitChanges(t, dir, pair[0], pair[1], "-M100%")
+				got, err := repo.DiffCommits(mustResolve(t, repo, pair[0]), mustResolve(t, repo, pair[1]))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(publicChanges(got), publicChanges(want)) {
+					t.Errorf("DiffCommits(%s, %s) = %v, want %v", pair[0], pair[1], publicChanges(got), want)
+				}
+			}
+		})
+	}
+}
+
+func TestDiffCommitsDetectsExactRenamesOnly(t *testing.T) {
+	dir := newTestRepo(t, "loose")
+	runGit(t, dir, "checkout", "-q", "feature")
+	runGit(t, dir, "mv", "f.txt", "g.txt")       // Exact rename
+	runGit(t, dir, "mv", "a.txt", "renamed.txt") // Renamed and edited
+	writeFiles(t, dir, map[string]string{"renamed.txt": "alpha, changed again\n"})
+	runGit(t, dir, "commit", "-q", "-am", "renames")
+
+	repo := openTestRepo(t, dir)
+	got, err := repo.DiffCommits(mustResolve(t, repo, "feature~1"), mustResolve(t, repo, "feature"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Change{
+		{Path: "a.txt", Status: StatusDeleted},
+		{Path: "g.txt", OldPath: "f.txt", Status: StatusRenamed},
+		{Path: "renamed.txt", Status: StatusAdded},
+	}
+	if !reflect.DeepEqual(publicChanges(got), want) {
+		t.Errorf("DiffCommits = %v, want %v", publicChanges(got), want)
+	}
+	if gitWant := gitChanges(t, dir, "feature~1", "feature", "-M100%"); !reflect.DeepEqual(want, gitWant) {
+		t.Errorf("git diff reports %v, want %v", gitWant, want)
+	}
+}
+
+func TestWorktreeChangesMatchesGit(t *testing.T) {
+	dir := newTestRepo(t, "packed")
+	writeFiles(t, dir, map[string]string{
+		"a.txt":       "alpha, edited in the work tree\n",
+		"staged.txt":  "staged\n",
+		"untracked.x": "untracked\n",
+	})
+	if err := os.Remove(filepath.Join(dir, "dir", "sub", "c.md")); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, dir, "mv", "dir/b.go", "dir/moved.go")
+	runGit(t, dir, "add", "staged.txt")
+
+	repo := openTestRepo(t, dir)
+	got, err := repo.WorktreeChanges()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := gitChanges(t, dir, "HEAD", "-M100%")
+	if !reflect.DeepEqual(publicChanges(got), want) {
+		t.Errorf("WorktreeChanges = %v, want %v", publicChanges(got), want)
+	}
+}
@@ -0,0 +1,111 @@
+package gitrepo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// IndexEntry is a single file recorded in the git index (staging area).
+type IndexEntry struct {
+	Path      string // Slash-separated path relative to the work tree
+	Hash      Hash   // Blob id of the staged content
+	Mode      uint32 // File mode (e.g. 0100644, 0120000 for symlinks)
+	Size      uint32 // Size of the file when it was staged (truncated to 32 bits)
+	MTimeSec  uint32 // Modification time seconds when it was staged
+	MTimeNsec uint32 // Modification time nanoseconds when it was staged
+	Stage     int    // Merge stage; non-zero for conflicted entries
+}
+
+// IsSubmodule reports whether the entry is a gitlink.
+func (e IndexEntry) IsSubmodule() bool {
+	return e.Mode&0o170000 == 0o160000
+}
+
+// IsSymlink reports whether the entry is a symbolic link.
+func (e IndexEntry) IsSymlink() bool {
+	return e.Mode&0o170000 == 0o120000
+}
+
+// ReadIndex parses the repository index. Versions 2, 3 and 4 are supported.
+// A repository without an index yields no entries.
+func (r *Repo) ReadIndex() ([]IndexEntry, error) {
+	data, err := os.ReadFile(filepath.Join(r.GitDir, "index"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading git index: %w", err)
+	}
+	return parseIndex(data)
+}
+
+// parseIndex decodes the binary index format described in gitformat-index(5).
+func parseIndex(data []byte) ([]IndexEntry, error) {
+	if len(data) < 12 || !bytes.Equal(data[:4], []byte("DIRC")) {
+		return nil, fmt.Errorf("invalid git index signature")
+	}
+	version := binary.BigEndian.Uint32(data[4:8])
+	if version < 2 || version > 4 {
+		return nil, fmt.Errorf("unsupported git index version %d", version)
+	}
+	count := int(binary.BigEndian.Uint32(data[8:12]))
+
+	entries := make([]IndexEntry, 0, count)
+	pos := 12
+	prevPath := ""
+	for i := 0; i < count; i++ {
+		start := pos
+		// Fixed part: ctime(8) mtime(8) dev ino mode uid gid size (4 each) id(20) flags(2)
+		if len(data) < pos+62 {
+			return nil, fmt.Errorf("truncated git index entry %d", i)
+		}
+
+		entry := IndexEntry{
+			MTimeSec:  binary.BigEndian.Uint32(data[pos+8:]),
+			MTimeNsec: binary.BigEndian.Uint32(data[pos+12:]),
+			Mode:      binary.BigEndian.Uint32(data[pos+24:]),
+			Size:      binary.BigEndian.Uint32(data[pos+36:]),
+		}
+		copy(entry.Hash[:], data[pos+40:pos+60])
+		flags := binary.BigEndian.Uint16(data[pos+60:])
+		entry.Stage = int(flags>>12) & 0x3
+		pos += 62
+
+		// Version 3+ entries may carry a second flags word
+		if flags&0x4000 != 0 && version >= 3 {
+			pos += 2
+		}
+
+		if version == 4 {
+			// Path is prefix-compressed against the previous entry
+			strip, n := binary.Uvarint(data[pos:])
+			if n <= 0 || int(strip) > len(prevPath) {
+				return nil, fmt.Errorf("invalid path compression in git index entry %d", i)
+			}
+			pos += n
+			end := bytes.IndexByte(data[pos:], 0)
+			if end < 0 {
+				return nil, fmt.Errorf("truncated git index entry %d", i)
+			}
+			entry.Path = prevPath[:len(prevPath)-int(strip)] + string(data[pos:pos+end])
+			pos += end + 1
+		} else {
+			end := bytes.IndexByte(data[pos:], 0)
+			if end < 0 {
+				return nil, fmt.Errorf("truncated git index entry %d", i)
+			}
+			entry.Path = string(data[pos : pos+end])
+			// Entries are NUL padded to a multiple of eight bytes
+			entryLen := pos + end - start
+			pos = start + (entryLen+8)&^7
+		}
+
+		prevPath = entry.Path
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,66 @@
+package gitrepo
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestReadIndexMatchesGit(t *testing.T) {
+	for _, version := range []string{"2", "3", "4"} {
+		t.Run("v"+version, func(t *testing.T) {
+			dir := newTestRepo(t, "loose")
+			// Long shared prefixes exercise the path compression of version 4
+			writeFiles(t, dir, map[string]string{
+				"dir/sub/deeper/nested/one.txt": "1\n",
+				"dir/sub/deeper/nested/two.txt": "2\n",
+				"dir/sub/deeper/three.txt":      "3\n",
+				"intent.txt":                    "intent\n",
+			})
+			runGit(t, dir, "add", "dir")
+			if version == "3" {
+				runGit(t, dir, "add", "-N", "intent.txt") // Sets the extended flags
+			}
+			runGit(t, dir, "update-index", "--index-version", version)
+
+			repo := openTestRepo(t, dir)
+			entries, err := repo.ReadIndex()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, e := range entries {
+				got = append(got, fmt.Sprintf("%06o %s %d\t%s", e.Mode, e.Hash, e.Stage, e.Path))
+			}
+			want := gitLines(t, dir, "ls-files", "-s")
+			if strings.Join(got, "\n") != strings.Join(want, "\n") {
+				t.Errorf("ReadIndex =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+			}
+
+			tracked, err := repo.TrackedFiles()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := gitLines(t, dir, "ls-files"); strings.Join(tracked, "\n") != strings.Join(want, "\n") {
+				t.Errorf("TrackedFiles = %v, want %v", tracked, want)
+			}
+		})
+	}
+}
+
+func TestParseIndexRejectsCorruptData(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"empty", ""},
+		{"bad signature", "DIRX\x00\x00\x00\x02\x00\x00\x00\x00"},
+		{"unsupported version", "DIRC\x00\x00\x00\x05\x00\x00\x00\x00"},
+		{"truncated entry", "DIRC\x00\x00\x00\x02\x00\x00\x00\x01" + strings.Repeat("\x00", 30)},
+	}
+	for _, tt := range tests {
+		if _, err := parseIndex([]byte(tt.data)); err == nil {
+			t.Errorf("%s: parseIndex succeeded", tt.name)
+		}
+	}
+}
@@ -0,0 +1,340 @@
+package gitrepo
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// objectType identifies the kind of a git object.
+type objectType int
+
+const (
+	objCommit   objectType = 1
+	objTree     objectType = 2
+	objBlob     objectType = 3
+	objTag      objectType = 4
+	objOfsDelta objectType = 6 // Pack-only: delta against an object at an offset
+	objRefDelta objectType = 7 // Pack-only: delta against an object by id
+)
+
+// String returns the name git uses for the object type.
+func (t objectType) String() string {
+	switch t {
+	case objCommit:
+		return "commit"
+	case objTree:
+		return "tree"
+	case objBlob:
+		return "blob"
+	case objTag:
+		return "tag"
+	case objOfsDelta:
+		return "ofs-delta"
+	case objRefDelta:
+		return "ref-delta"
+	default:
+		return "unknown"
+	}
+}
+
+// parseObjectType converts a loose object header type name to an objectType.
+func parseObjectType(name string) (objectType, error) {
+	switch name {
+	case "commit":
+		return objCommit, nil
+	case "tree":
+		return objTree, nil
+	case "blob":
+		return objBlob, nil
+	case "tag":
+		return objTag, nil
+	default:
+		return 0, fmt.Errorf("unknown object type %q", name)
+	}
+}
+
+// HashBlob computes the object id git would assign to content stored as a blob.
+func HashBlob(content []byte) Hash {
+	h := sha1.New()
+	fmt.Fprintf(h, "blob %d\x00", len(content))
+	h.Write(content)
+
+	var out Hash
+	copy(out[:], h.Sum(nil))
+	return out
+}
+
+// readObject reads and fully decompresses an object, resolving pack deltas.
+func (r *Repo) readObject(hash Hash) (objectType, []byte, error) {
+	typ, data, err := r.readLooseObject(hash)
+	if err == nil {
+		return typ, data, nil
+	}
+	if !os.IsNotExist(err) {
+		return 0, nil, err
+	}
+
+	packs, err := r.loadPacks()
+	if err != nil {
+		return 0, nil, err
+	}
+	for _, p := range packs {
+		if offset, ok := p.idx.lookup(hash); ok {
+			return p.readAt(r, offset)
+		}
+	}
+
+	return 0, nil, fmt.Errorf("object %s not found", hash)
+}
+
+// readLooseObject reads an object stored under objects/xx/yyyy.
+func (r *Repo) readLooseObject(hash Hash) (objectType, []byte, error) {
+	hexHash := hash.String()
+	path := filepath.Join(r.CommonDir, "objects", hexHash[:2], hexHash[2:])
+
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer f.Close()
+
+	zr, err := zlib.NewReader(f)
+	if err != nil {
+		return 0, nil, fmt.Errorf("error decompressing object %s: %w", hexHash, err)
+	}
+	defer zr.Close()
+
+	raw, err := io.ReadAll(zr)
+	if err != nil {
+		return 0, nil, fmt.Errorf("error decompressing object %s: %w", hexHash, err)
+	}
+
+	// Header is "<type> <size>\0"
+	header, body, ok := bytes.Cut(raw, []byte{0})
+	if !ok {
+		return 0, nil, fmt.Errorf("malformed object %s", hexHash)
+	}
+	typeName, sizeStr, ok := bytes.Cut(header, []byte(" "))
+	if !ok {
+		return 0, nil, fmt.Errorf("malformed object header in %s", hexHash)
+	}
+	typ, err := parseObjectType(string(typeName))
+	if err != nil {
+		return 0, nil, fmt.Errorf("object %s: %w", hexHash, err)
+	}
+	if size, err := strconv.Atoi(string(sizeStr)); err != nil || size != len(body) {
+		return 0, nil, fmt.Errorf("object %s has inconsistent size", hexHash)
+	}
+
+	return typ, body, nil
+}
+
+// ObjectSize returns the size of an object's content from its header,
+// without decompressing the content or resolving pack deltas.
+func (r *Repo) ObjectSize(hash Hash) (int64, error) {
+	size, err := r.looseObjectSize(hash)
+	if err == nil {
+		return size, nil
+	}
+	if !os.IsNotExist(err) {
+		return 0, err
+	}
+
+	packs, err := r.loadPacks()
+	if err != nil {
+		return 0, err
+	}
+	for _, p := range packs {
+		if offset, ok := p.idx.lookup(hash); ok {
+			return p.sizeAt(offset)
+		}
+	}
+
+	return 0, fmt.Errorf("object %s not found", hash)
+}
+
+// looseObjectSize reads the size from the "<type> <size>\0" header of a loose object.
+func (r *Repo) looseObjectSize(hash Hash) (int64, error) {
+	hexHash := hash.String()
+	f, err := os.Open(filepath.Join(r.CommonDir, "objects", hexHash[:2], hexHash[2:]))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	zr, err := zlib.NewReader(f)
+	if err != nil {
+		return 0, fmt.Errorf("error decompressing object %s: %w", hexHash, err)
+	}
+	defer zr.Close()
+
+	header, err := bufio.NewReader(zr).ReadString(0)
+	if err != nil {
+		return 0, fmt.Errorf("malformed object %s", hexHash)
+	}
+	_, sizeStr, ok := strings.Cut(strings.TrimSuffix(header, "\x00"), " ")
+	size, err := strconv.ParseInt(sizeStr, 10, 64)
+	if !ok || err != nil {
+		return 0, fmt.Errorf("malformed object header in %s", hexHash)
+	}
+	return size, nil
+}
+
+// ReadBlob returns the content of a blob object.
+func (r *Repo) ReadBlob(hash Hash) ([]byte, error) {
+	typ, data, err := r.readObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	if typ != objBlob {
+		return nil, fmt.Errorf("object %s is a %s, not a blob", hash, typ)
+	}
+	return data, nil
+}
+
+// --- Commits and Trees ---
+
+// Commit holds the parts of a commit object needed for diffing.
+type Commit struct {
+	Hash    Hash
+	Tree    Hash
+	Parents []Hash
+	Time    time.Time // Committer timestamp
+}
+
+// ReadCommit parses the commit object with the given id.
+func (r *Repo) ReadCommit(hash Hash) (*Commit, error) {
+	typ, data, err := r.readObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	if typ != objCommit {
+		return nil, fmt.Errorf("object %s is a %s, not a commit", hash, typ)
+	}
+
+	commit := &Commit{Hash: hash}
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(line) == 0 {
+			break // Headers end at the first blank line
+		}
+		key, value, _ := bytes.Cut(line, []byte(" "))
+		switch string(key) {
+		case "tree":
+			if commit.Tree, err = ParseHash(string(value)); err != nil {
+				return nil, err
+			}
+		case "parent":
+			parent, err := ParseHash(string(value))
+			if err != nil {
+				return nil, err
+			}
+			commit.Parents = append(commit.Parents, parent)
+		case "committer":
+			// "Name <email> <unix seconds> <tz offset>"
+			fields := bytes.Fields(value)
+			if len(fields) >= 2 {
+				if sec, err := strconv.ParseInt(string(fields[len(fields)-2]), 10, 64); err == nil {
+					commit.Time = time.Unix(sec, 0)
+				}
+			}
+		}
+	}
+
+	if commit.Tree.IsZero() {
+		return nil, fmt.Errorf("commit %s has no tree", hash)
+	}
+	return commit, nil
+}
+
+// TreeEntry is a single entry of a tree object.
+type TreeEntry struct {
+	Name string
+	Mode uint32
+	Hash Hash
+}
+
+// IsDir reports whether the entry refers to a subtree.
+func (e TreeEntry) IsDir() bool {
+	return e.Mode&0o170000 == 0o040000
+}
+
+// IsSubmodule reports whether the entry is a gitlink to another repository.
+func (e TreeEntry) IsSubmodule() bool {
+	return e.Mode&0o170000 == 0o160000
+}
+
+// ReadTree parses the tree object with the given id.
+func (r *Repo) ReadTree(hash Hash) ([]TreeEntry, error) {
+	typ, data, err := r.readObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	if typ != objTree {
+		return nil, fmt.Errorf("object %s is a %s, not a tree", hash, typ)
+	}
+
+	var entries []TreeEntry
+	for len(data) > 0 {
+		// Each entry is "<octal mode> <name>\0<20 byte id>"
+		modeStr, rest, ok := bytes.Cut(data, []byte(" "))
+		if !ok {
+			return nil, fmt.Errorf("malformed tree %s", hash)
+		}
+		name, rest, ok := bytes.Cut(rest, []byte{0})
+		if !ok || len(rest) < 20 {
+			return nil, fmt.Errorf("malformed tree %s", hash)
+		}
+		mode, err := strconv.ParseUint(string(modeStr), 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("malformed mode in tree %s: %w", hash, err)
+		}
+
+		entry := TreeEntry{Name: string(name), Mode: uint32(mode)}
+		copy(entry.Hash[:], rest[:20])
+		entries = append(entries, entry)
+		data = rest[20:]
+	}
+
+	return entries, nil
+}
+
+// TreeFiles flattens a tree into a map of slash-separated paths to entries.
+// Submodules are skipped because their content lives in another repository.
+func (r *Repo) TreeFiles(tree Hash) (map[string]TreeEntry, error) {
+	files := make(map[string]TreeEntry)
+	if err := r.collectTree(tree, "", files); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// collectTree recursively adds the blobs below tree to files.
+func (r *Repo) collectTree(tree Hash, prefix string, files map[string]TreeEntry) error {
+	entries, err := r.ReadTree(tree)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		path := prefix + e.Name
+		switch {
+		case e.IsDir():
+			if err := r.collectTree(e.Hash, path+"/", files); err != nil {
+				return err
+			}
+		case e.IsSubmodule():
+			continue
+		default:
+			files[path] = e
+		}
+	}
+	return nil
+}
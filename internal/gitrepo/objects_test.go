@@ -0,0 +1,111 @@
+package gitrepo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestObjectsMatchGit(t *testing.T) {
+	for _, storage := range storages {
+		t.Run(storage, func(t *testing.T) {
+			dir := newTestRepo(t, storage)
+			repo := openTestRepo(t, dir)
+
+			objects := gitLines(t, dir, "cat-file", "--batch-all-objects", "--batch-check")
+			if len(objects) == 0 {
+				t.Fatal("git lists no objects")
+			}
+			for _, line := range objects {
+				fields := strings.Fields(line) // "<id> <type> <size>"
+				hash, err := ParseHash(fields[0])
+				if err != nil {
+					t.Fatal(err)
+				}
+				size, _ := strconv.ParseInt(fields[2], 10, 64)
+				if got, err := repo.ObjectSize(hash); err != nil || got != size {
+					t.Errorf("ObjectSize(%s) = %d, %v, want %d", hash, got, err, size)
+				}
+
+				switch fields[1] {
+				case "blob":
+					want := runGit(t, dir, "cat-file", "blob", fields[0])
+					if got, err := repo.ReadBlob(hash); err != nil || string(got) != want {
+						t.Errorf("ReadBlob(%s) = %q, %v, want %q", hash, got, err, want)
+					}
+				case "tree":
+					want := strings.Join(gitLines(t, dir, "ls-tree", fields[0]), "\n")
+					entries, err := repo.ReadTree(hash)
+					if err != nil {
+						t.Errorf("ReadTree(%s): %v", hash, err)
+						continue
+					}
+					var got []string
+					for _, e := range entries {
+						kind := "blob"
+						switch {
+						case e.IsDir():
+							kind = "tree"
+						case e.IsSubmodule():
+							kind = "commit"
+						}
+						got = append(got, fmt.Sprintf("%06o %s %s\t%s", e.Mode, kind, e.Hash, e.Name))
+					}
+					if strings.Join(got, "\n") != want {
+						t.Errorf("ReadTree(%s) =\n%s\nwant\n%s", hash, strings.Join(got, "\n"), want)
+					}
+				case "commit":
+					want := strings.TrimSpace(runGit(t, dir, "show", "-s", "--format=%T %P", fields[0]))
+					commit, err := repo.ReadCommit(hash)
+					if err != nil {
+						t.Errorf("ReadCommit(%s): %v", hash, err)
+						continue
+					}
+					got := commit.Tree.String()
+					for _, parent := range commit.Parents {
+						got += " " + parent.String()
+					}
+					if got != want {
+						t.Errorf("ReadCommit(%s) tree and parents = %q, want %q", hash, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestTreeFilesMatchGit(t *testing.T) {
+	dir := newTestRepo(t, "packed")
+	repo := openTestRepo(t, dir)
+	for _, rev := range []string{"main", "feature"} {
+		commit, err := repo.ReadCommit(mustResolve(t, repo, rev))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files, err := repo.TreeFiles(commit.Tree)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := gitLines(t, dir, "ls-tree", "-r", "--format=%(objectname) %(path)", rev)
+		if len(files) != len(want) {
+			t.Errorf("%s: TreeFiles has %d files, git lists %d", rev, len(files), len(want))
+		}
+		for _, line := range want {
+			hash, path, _ := strings.Cut(line, " ")
+			if entry, ok := files[path]; !ok || entry.Hash.String() != hash {
+				t.Errorf("%s: TreeFiles[%s] = %v, want blob %s", rev, path, entry, hash)
+			}
+		}
+	}
+}
+
+// mustResolve resolves a revision or fails the test.
+func mustResolve(t *testing.T, repo *Repo, rev string) Hash {
+	t.Helper()
+	hash, err := repo.ResolveRevision(rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
@@ -0,0 +1,395 @@
+package gitrepo
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// maxCachedBases bounds the number of delta bases kept in memory per pack.
+const maxCachedBases = 256
+
+// packIndex is a parsed version 2 pack .idx file.
+type packIndex struct {
+	fanout  [256]uint32
+	hashes  []Hash
+	offsets []int64
+}
+
+// packFile is an opened pack with its index.
+type packFile struct {
+	path string
+	file *os.File
+	idx  *packIndex
+
+	mu    sync.Mutex
+	cache map[int64]packObject // Resolved objects by offset, used as delta bases
+}
+
+// packObject is a fully resolved object read from a pack.
+type packObject struct {
+	typ  objectType
+	data []byte
+}
+
+// loadPacks opens every pack in objects/pack the first time it is called.
+func (r *Repo) loadPacks() ([]*packFile, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.pkSet {
+		return r.packs, r.pkErr
+	}
+	r.pkSet = true
+
+	idxFiles, _ := filepath.Glob(filepath.Join(r.CommonDir, "objects", "pack", "*.idx"))
+	sort.Strings(idxFiles)
+	for _, idxPath := range idxFiles {
+		idx, err := readPackIndex(idxPath)
+		if err != nil {
+			r.pkErr = err
+			return nil, err
+		}
+
+		packPath := strings.TrimSuffix(idxPath, ".idx") + ".pack"
+		f, err := os.Open(packPath)
+		if err != nil {
+			r.pkErr = fmt.Errorf("error opening pack %s: %w", packPath, err)
+			return nil, r.pkErr
+		}
+
+		r.packs = append(r.packs, &packFile{
+			path:  packPath,
+			file:  f,
+			idx:   idx,
+			cache: make(map[int64]packObject),
+		})
+	}
+
+	return r.packs, nil
+}
+
+// readPackIndex parses a version 2 pack index.
+func readPackIndex(path string) (*packIndex, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading pack index %s: %w", path, err)
+	}
+	if len(data) < 8+256*4 || !bytes.Equal(data[:4], []byte{0xff, 't', 'O', 'c'}) {
+		return nil, fmt.Errorf("unsupported pack index format in %s", path)
+	}
+	if version := binary.BigEndian.Uint32(data[4:8]); version != 2 {
+		return nil, fmt.Errorf("unsupported pack index version %d in %s", version, path)
+	}
+
+	idx := &packIndex{}
+	pos := 8
+	for i := 0; i < 256; i++ {
+		idx.fanout[i] = binary.BigEndian.Uint32(data[pos:])
+		pos += 4
+	}
+	count := int(idx.fanout[255])
+
+	// Layout: hashes, CRCs, 32-bit offsets, optional 64-bit offsets
+	hashStart := pos
+	crcStart := hashStart + count*20
+	offStart := crcStart + count*4
+	bigStart := offStart + count*4
+	if len(data) < bigStart {
+		return nil, fmt.Errorf("truncated pack index %s", path)
+	}
+
+	idx.hashes = make([]Hash, count)
+	idx.offsets = make([]int64, count)
+	for i := 0; i < count; i++ {
+		copy(idx.hashes[i][:], data[hashStart+i*20:])
+
+		off := binary.BigEndian.Uint32(data[offStart+i*4:])
+		if off&0x80000000 == 0 {
+			idx.offsets[i] = int64(off)
+			continue
+		}
+		bigPos := bigStart + int(off&0x7fffffff)*8
+		if len(data) < bigPos+8 {
+			return nil, fmt.Errorf("truncated pack index %s", path)
+		}
+		idx.offsets[i] = int64(binary.BigEndian.Uint64(data[bigPos:]))
+	}
+
+	return idx, nil
+}
+
+// lookup returns the pack offset of hash, if the pack contains it.
+func (idx *packIndex) lookup(hash Hash) (int64, bool) {
+	lo := 0
+	if hash[0] > 0 {
+		lo = int(idx.fanout[hash[0]-1])
+	}
+	hi := int(idx.fanout[hash[0]])
+
+	i := lo + sort.Search(hi-lo, func(i int) bool {
+		return bytes.Compare(idx.hashes[lo+i][:], hash[:]) >= 0
+	})
+	if i < hi && idx.hashes[i] == hash {
+		return idx.offsets[i], true
+	}
+	return 0, false
+}
+
+// findPrefix returns every object id in the pack starting with the hex prefix.
+func (idx *packIndex) findPrefix(prefix string) []Hash {
+	var matches []Hash
+	first, err := hex.DecodeString(prefix[:2])
+	if err != nil {
+		return nil
+	}
+
+	lo := 0
+	if first[0] > 0 {
+		lo = int(idx.fanout[first[0]-1])
+	}
+	hi := int(idx.fanout[first[0]])
+	for i := lo; i < hi; i++ {
+		if strings.HasPrefix(idx.hashes[i].String(), prefix) {
+			matches = append(matches, idx.hashes[i])
+		}
+	}
+	return matches
+}
+
+// close releases the pack file handle.
+func (p *packFile) close() error {
+	return p.file.Close()
+}
+
+// readAt reads and resolves the object stored at offset.
+func (p *packFile) readAt(repo *Repo, offset int64) (objectType, []byte, error) {
+	p.mu.Lock()
+	if obj, ok := p.cache[offset]; ok {
+		p.mu.Unlock()
+		return obj.typ, obj.data, nil
+	}
+	p.mu.Unlock()
+
+	br := bufio.NewReader(io.NewSectionReader(p.file, offset, 1<<62))
+
+	typ, _, err := readEntryHeader(br)
+	if err != nil {
+		return 0, nil, fmt.Errorf("error reading pack %s at %d: %w", p.path, offset, err)
+	}
+
+	var baseType objectType
+	var baseData []byte
+	switch typ {
+	case objOfsDelta:
+		// Base offset uses git's "offset encoding" with an implicit +1 per byte
+		c, err := br.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		rel := int64(c & 0x7f)
+		for c&0x80 != 0 {
+			if c, err = br.ReadByte(); err != nil {
+				return 0, nil, err
+			}
+			rel = ((rel + 1) << 7) | int64(c&0x7f)
+		}
+		if rel <= 0 || rel >= offset {
+			return 0, nil, fmt.Errorf("invalid delta base offset %d in pack %s at %d", rel, p.path, offset)
+		}
+		if baseType, baseData, err = p.readAt(repo, offset-rel); err != nil {
+			return 0, nil, err
+		}
+	case objRefDelta:
+		var base Hash
+		if _, err := io.ReadFull(br, base[:]); err != nil {
+			return 0, nil, err
+		}
+		if baseType, baseData, err = repo.readObject(base); err != nil {
+			return 0, nil, err
+		}
+	case objCommit, objTree, objBlob, objTag:
+	default:
+		return 0, nil, fmt.Errorf("invalid object type %d in pack %s at %d", typ, p.path, offset)
+	}
+
+	zr, err := zlib.NewReader(br)
+	if err != nil {
+		return 0, nil, fmt.Errorf("error decompressing pack %s at %d: %w", p.path, offset, err)
+	}
+	data, err := io.ReadAll(zr)
+	zr.Close()
+	if err != nil {
+		return 0, nil, fmt.Errorf("error decompressing pack %s at %d: %w", p.path, offset, err)
+	}
+
+	if baseData != nil {
+		if data, err = applyDelta(baseData, data); err != nil {
+			return 0, nil, fmt.Errorf("pack %s at %d: %w", p.path, offset, err)
+		}
+		typ = baseType
+	}
+
+	p.mu.Lock()
+	if len(p.cache) >= maxCachedBases {
+		p.cache = make(map[int64]packObject)
+	}
+	p.cache[offset] = packObject{typ: typ, data: data}
+	p.mu.Unlock()
+
+	return typ, data, nil
+}
+
+// readEntryHeader reads the header of a pack entry: the type in bits 4-6 of
+// the first byte, and the size of the (possibly delta) data as a varint
+// starting with the low 4 bits.
+func readEntryHeader(br io.ByteReader) (objectType, int64, error) {
+	c, err := br.ReadByte()
+	if err != nil {
+		return 0, 0, err
+	}
+	typ := objectType((c >> 4) & 0x7)
+	size := int64(c & 0x0f)
+	for shift := 4; c&0x80 != 0; shift += 7 {
+		if c, err = br.ReadByte(); err != nil {
+			return 0, 0, err
+		}
+		size |= int64(c&0x7f) << shift
+	}
+	return typ, size, nil
+}
+
+// sizeAt returns the size of the object stored at offset. Deltas store the
+// size of the object they produce at the start of their data, so only that
+// much is decompressed.
+func (p *packFile) sizeAt(offset int64) (int64, error) {
+	p.mu.Lock()
+	if obj, ok := p.cache[offset]; ok {
+		p.mu.Unlock()
+		return int64(len(obj.data)), nil
+	}
+	p.mu.Unlock()
+
+	br := bufio.NewReader(io.NewSectionReader(p.file, offset, 1<<62))
+	typ, size, err := readEntryHeader(br)
+	if err != nil {
+		return 0, fmt.Errorf("error reading pack %s at %d: %w", p.path, offset, err)
+	}
+	switch typ {
+	case objCommit, objTree, objBlob, objTag:
+		return size, nil
+	case objOfsDelta:
+		for c := byte(0x80); c&0x80 != 0; {
+			if c, err = br.ReadByte(); err != nil {
+				return 0, fmt.Errorf("error reading pack %s at %d: %w", p.path, offset, err)
+			}
+		}
+	case objRefDelta:
+		if _, err := br.Discard(len(Hash{})); err != nil {
+			return 0, fmt.Errorf("error reading pack %s at %d: %w", p.path, offset, err)
+		}
+	default:
+		return 0, fmt.Errorf("invalid object type %d in pack %s at %d", typ, p.path, offset)
+	}
+
+	zr, err := zlib.NewReader(br)
+	if err != nil {
+		return 0, fmt.Errorf("error decompressing pack %s at %d: %w", p.path, offset, err)
+	}
+	defer zr.Close()
+	delta := bufio.NewReader(zr)
+	var dstSize int64
+	for i := 0; i < 2; i++ { // Base size, then result size
+		dstSize = 0
+		for shift, c := 0, byte(0x80); c&0x80 != 0; shift += 7 {
+			if c, err = delta.ReadByte(); err != nil {
+				return 0, fmt.Errorf("error decompressing pack %s at %d: %w", p.path, offset, err)
+			}
+			dstSize |= int64(c&0x7f) << shift
+		}
+	}
+	return dstSize, nil
+}
+
+// applyDelta reconstructs an object from its base and a git delta.
+func applyDelta(base, delta []byte) ([]byte, error) {
+	srcSize, delta := readDeltaSize(delta)
+	if srcSize != len(base) {
+		return nil, fmt.Errorf("delta base size mismatch (%d != %d)", srcSize, len(base))
+	}
+	dstSize, delta := readDeltaSize(delta)
+
+	out := make([]byte, 0, dstSize)
+	for len(delta) > 0 {
+		op := delta[0]
+		delta = delta[1:]
+
+		if op&0x80 != 0 {
+			// Copy from base: offset and size bytes are present per bit flag
+			var offset, size int
+			for i := 0; i < 4; i++ {
+				if op&(1<<i) != 0 {
+					if len(delta) == 0 {
+						return nil, fmt.Errorf("truncated delta")
+					}
+					offset |= int(delta[0]) << (8 * i)
+					delta = delta[1:]
+				}
+			}
+			for i := 0; i < 3; i++ {
+				if op&(0x10<<i) != 0 {
+					if len(delta) == 0 {
+						return nil, fmt.Errorf("truncated delta")
+					}
+					size |= int(delta[0]) << (8 * i)
+					delta = delta[1:]
+				}
+			}
+			if size == 0 {
+				size = 0x10000
+			}
+			if offset+size > len(base) {
+				return nil, fmt.Errorf("delta copy out of range")
+			}
+			out = append(out, base[offset:offset+size]...)
+		} else if op != 0 {
+			// Insert the next op bytes literally
+			if int(op) > len(delta) {
+				return nil, fmt.Errorf("truncated delta")
+			}
+			out = append(out, delta[:op]...)
+			delta = delta[op:]
+		} else {
+			return nil, fmt.Errorf("invalid delta opcode 0")
+		}
+	}
+
+	if len(out) != dstSize {
+		return nil, fmt.Errorf("delta result size mismatch (%d != %d)", len(out), dstSize)
+	}
+	return out, nil
+}
+
+// readDeltaSize decodes a little-endian base-128 size from a delta header.
+func readDeltaSize(data []byte) (int, []byte) {
+	size, shift := 0, 0
+	for len(data) > 0 {
+		c := data[0]
+		data = data[1:]
+		size |= int(c&0x7f) << shift
+		shift += 7
+		if c&0x80 == 0 {
+			break
+		}
+	}
+	return size, data
+}
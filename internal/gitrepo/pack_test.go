@@ -0,0 +1,65 @@
+package gitrepo
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadAtRejectsOutOfRangeDeltaBase(t *testing.T) {
+	tests := []struct {
+		name string
+		rel  []byte // Offset encoding of the distance to the base
+	}{
+		{"base at the entry itself", []byte{0x0c}},
+		{"base before the pack", []byte{0x0d}},
+		{"base far before the pack", []byte{0xff, 0x7f}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// An ofs-delta entry of size 0 at offset 12, right after the header
+			data := append([]byte("PACK\x00\x00\x00\x02\x00\x00\x00\x01\x60"), tt.rel...)
+			path := filepath.Join(t.TempDir(), "corrupt.pack")
+			if err := os.WriteFile(path, data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			file, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+
+			p := &packFile{path: path, file: file, cache: make(map[int64]packObject)}
+			// Without the range check the base is read from the header or
+			// from before the pack, and fails later on whatever is there
+			_, _, err = p.readAt(nil, 12)
+			if err == nil || !strings.Contains(err.Error(), "invalid delta base offset") {
+				t.Errorf("readAt error = %v, want an invalid delta base offset", err)
+			}
+		})
+	}
+}
+
+func TestApplyDeltaRejectsCorruptDeltas(t *testing.T) {
+	base := []byte("hello world")
+	tests := []struct {
+		name  string
+		delta []byte
+	}{
+		{"base size mismatch", []byte{5, 5, 0x05, 'h', 'e', 'l', 'l', 'o'}},
+		{"copy past the base", []byte{11, 5, 0x91, 8, 5}},
+		{"result size mismatch", []byte{11, 6, 0x05, 'h', 'e', 'l', 'l', 'o'}},
+	}
+	for _, tt := range tests {
+		if _, err := applyDelta(base, tt.delta); err == nil {
+			t.Errorf("%s: applyDelta succeeded", tt.name)
+		}
+	}
+
+	// Copy "world", then insert "!"
+	got, err := applyDelta(base, []byte{11, 6, 0x91, 6, 5, 0x01, '!'})
+	if err != nil || string(got) != "world!" {
+		t.Errorf("applyDelta = %q, %v, want %q", got, err, "world!")
+	}
+}
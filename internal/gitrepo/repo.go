@@ -0,0 +1,368 @@
+// Package gitrepo reads git repositories directly from the .git directory,
+// without shelling out to the git binary. It understands the index, loose and
+// packed objects, refs and packed-refs, which is enough to list tracked files
+// and to compute the files changed between commits or in the working tree.
+package gitrepo
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Hash is a SHA-1 object id.
+type Hash [20]byte
+
+// ZeroHash is the all-zero object id, used for missing objects.
+var ZeroHash Hash
+
+// String returns the hexadecimal form of the hash.
+func (h Hash) String() string {
+	return hex.EncodeToString(h[:])
+}
+
+// IsZero reports whether h is the zero hash.
+func (h Hash) IsZero() bool {
+	return h == ZeroHash
+}
+
+// ParseHash parses a 40 character hexadecimal object id.
+func ParseHash(s string) (Hash, error) {
+	var h Hash
+	if len(s) != 40 {
+		return h, fmt.Errorf("invalid object id %q", s)
+	}
+	if _, err := hex.Decode(h[:], []byte(s)); err != nil {
+		return h, fmt.Errorf("invalid object id %q: %w", s, err)
+	}
+	return h, nil
+}
+
+// Repo is an opened git repository.
+type Repo struct {
+	WorkTree  string // Root of the working tree
+	GitDir    string // The .git directory (per-worktree for linked worktrees)
+	CommonDir string // Directory holding objects and shared refs
+
+	mu    sync.Mutex  // Guards pack loading
+	packs []*packFile // Lazily loaded pack files
+	pkErr error       // Error encountered while loading packs
+	pkSet bool        // Whether packs have been loaded
+}
+
+// Open locates the repository containing path by searching upwards for a
+// .git directory (or a .git file pointing at a linked worktree).
+func Open(path string) (*Repo, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving %s: %w", path, err)
+	}
+
+	dir := absPath
+	for {
+		dotGit := filepath.Join(dir, ".git")
+		info, err := os.Stat(dotGit)
+		if err == nil {
+			if info.IsDir() {
+				return newRepo(dir, dotGit)
+			}
+			gitDir, err := readGitFile(dotGit)
+			if err != nil {
+				return nil, err
+			}
+			return newRepo(dir, gitDir)
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, fmt.Errorf("no git repository found at or above %s", absPath)
+		}
+		dir = parent
+	}
+}
+
+// readGitFile resolves a ".git" file of the form "gitdir: <path>".
+func readGitFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("error reading %s: %w", path, err)
+	}
+	line := strings.TrimSpace(string(data))
+	if !strings.HasPrefix(line, "gitdir:") {
+		return "", fmt.Errorf("invalid .git file %s", path)
+	}
+	gitDir := strings.TrimSpace(strings.TrimPrefix(line, "gitdir:"))
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(filepath.Dir(path), gitDir)
+	}
+	return gitDir, nil
+}
+
+// newRepo builds a Repo and validates that its object format is supported.
+func newRepo(workTree, gitDir string) (*Repo, error) {
+	repo := &Repo{
+		WorkTree:  workTree,
+		GitDir:    gitDir,
+		CommonDir: gitDir,
+	}
+
+	// Linked worktrees keep objects and shared refs in the common directory
+	if data, err := os.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+		commonDir := strings.TrimSpace(string(data))
+		if !filepath.IsAbs(commonDir) {
+			commonDir = filepath.Join(gitDir, commonDir)
+		}
+		repo.CommonDir = filepath.Clean(commonDir)
+	}
+
+	if data, err := os.ReadFile(filepath.Join(repo.CommonDir, "config")); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			fields := strings.Fields(strings.ToLower(line))
+			if len(fields) == 3 && fields[0] == "objectformat" && fields[2] != "sha1" {
+				return nil, fmt.Errorf("unsupported git object format %q", fields[2])
+			}
+		}
+	}
+
+	return repo, nil
+}
+
+// Close releases any open pack files.
+func (r *Repo) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var firstErr error
+	for _, p := range r.packs {
+		if err := p.close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	r.packs = nil
+	r.pkSet = false
+	return firstErr
+}
+
+// --- Ref Resolution ---
+
+// ResolveRevision resolves a revision such as "HEAD", "main", "v1.2",
+// "origin/main", a full or abbreviated object id, optionally followed by
+// "~N", "^" or "^N" suffixes, to a commit hash.
+func (r *Repo) ResolveRevision(rev string) (Hash, error) {
+	// Split the base name from any ancestry suffixes
+	base := rev
+	suffix := ""
+	if i := strings.IndexAny(rev, "~^"); i >= 0 {
+		base, suffix = rev[:i], rev[i:]
+	}
+	if base == "" || base == "@" {
+		base = "HEAD"
+	}
+
+	hash, err := r.resolveName(base)
+	if err != nil {
+		return ZeroHash, err
+	}
+	hash, err = r.peelToCommit(hash)
+	if err != nil {
+		return ZeroHash, fmt.Errorf("resolving %s: %w", rev, err)
+	}
+
+	for suffix != "" {
+		op := suffix[0]
+		suffix = suffix[1:]
+
+		// Read an optional numeric argument
+		n := 1
+		digits := 0
+		for digits < len(suffix) && suffix[digits] >= '0' && suffix[digits] <= '9' {
+			digits++
+		}
+		if digits > 0 {
+			n, _ = strconv.Atoi(suffix[:digits])
+			suffix = suffix[digits:]
+		}
+
+		switch op {
+		case '~':
+			for i := 0; i < n; i++ {
+				if hash, err = r.nthParent(hash, 1); err != nil {
+					return ZeroHash, fmt.Errorf("resolving %s: %w", rev, err)
+				}
+			}
+		case '^':
+			if n == 0 {
+				continue // "^0" is the commit itself
+			}
+			if hash, err = r.nthParent(hash, n); err != nil {
+				return ZeroHash, fmt.Errorf("resolving %s: %w", rev, err)
+			}
+		default:
+			return ZeroHash, fmt.Errorf("unsupported revision syntax %q", rev)
+		}
+	}
+
+	return hash, nil
+}
+
+// nthParent returns the n-th (1-based) parent of a commit.
+func (r *Repo) nthParent(hash Hash, n int) (Hash, error) {
+	commit, err := r.ReadCommit(hash)
+	if err != nil {
+		return ZeroHash, err
+	}
+	if n > len(commit.Parents) {
+		return ZeroHash, fmt.Errorf("commit %s has no parent %d", hash, n)
+	}
+	return commit.Parents[n-1], nil
+}
+
+// resolveName resolves a symbolic name or object id to a hash.
+func (r *Repo) resolveName(name string) (Hash, error) {
+	if len(name) == 40 {
+		if h, err := ParseHash(name); err == nil {
+			return h, nil
+		}
+	}
+
+	// Same lookup order as git rev-parse
+	candidates := []string{
+		name,
+		"refs/" + name,
+		"refs/tags/" + name,
+		"refs/heads/" + name,
+		"refs/remotes/" + name,
+		"refs/remotes/" + name + "/HEAD",
+	}
+	for _, ref := range candidates {
+		if h, err := r.resolveRef(ref, 0); err == nil {
+			return h, nil
+		}
+	}
+
+	// Fall back to an abbreviated object id
+	if len(name) >= 4 && isHex(name) {
+		return r.resolvePrefix(strings.ToLower(name))
+	}
+
+	return ZeroHash, fmt.Errorf("unknown revision %q", name)
+}
+
+// resolveRef resolves a fully qualified ref, following symbolic refs.
+func (r *Repo) resolveRef(ref string, depth int) (Hash, error) {
+	if depth > 10 {
+		return ZeroHash, fmt.Errorf("symbolic ref loop at %s", ref)
+	}
+
+	// HEAD and other per-worktree refs live in GitDir, the rest in CommonDir
+	for _, dir := range []string{r.GitDir, r.CommonDir} {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(ref)))
+		if err != nil {
+			continue
+		}
+		content := strings.TrimSpace(string(data))
+		if strings.HasPrefix(content, "ref:") {
+			return r.resolveRef(strings.TrimSpace(strings.TrimPrefix(content, "ref:")), depth+1)
+		}
+		return ParseHash(content)
+	}
+
+	return r.lookupPackedRef(ref)
+}
+
+// lookupPackedRef searches the packed-refs file for ref.
+func (r *Repo) lookupPackedRef(ref string) (Hash, error) {
+	data, err := os.ReadFile(filepath.Join(r.CommonDir, "packed-refs"))
+	if err != nil {
+		return ZeroHash, fmt.Errorf("ref %s not found", ref)
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" || line[0] == '#' || line[0] == '^' {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[1] == ref {
+			return ParseHash(fields[0])
+		}
+	}
+
+	return ZeroHash, fmt.Errorf("ref %s not found", ref)
+}
+
+// resolvePrefix finds the unique object whose id starts with prefix.
+func (r *Repo) resolvePrefix(prefix string) (Hash, error) {
+	matches := make(map[Hash]bool)
+
+	// Loose objects are stored as objects/xx/yyyy...
+	entries, _ := os.ReadDir(filepath.Join(r.CommonDir, "objects", prefix[:2]))
+	for _, e := range entries {
+		full := prefix[:2] + e.Name()
+		if strings.HasPrefix(full, prefix) {
+			if h, err := ParseHash(full); err == nil {
+				matches[h] = true
+			}
+		}
+	}
+
+	packs, err := r.loadPacks()
+	if err != nil {
+		return ZeroHash, err
+	}
+	for _, p := range packs {
+		for _, h := range p.idx.findPrefix(prefix) {
+			matches[h] = true
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return ZeroHash, fmt.Errorf("unknown revision %q", prefix)
+	case 1:
+		for h := range matches {
+			return h, nil
+		}
+	}
+	return ZeroHash, fmt.Errorf("ambiguous object id prefix %q", prefix)
+}
+
+// peelToCommit dereferences annotated tags until a commit is reached.
+func (r *Repo) peelToCommit(hash Hash) (Hash, error) {
+	for i := 0; i < 10; i++ {
+		typ, data, err := r.readObject(hash)
+		if err != nil {
+			return ZeroHash, err
+		}
+		switch typ {
+		case objCommit:
+			return hash, nil
+		case objTag:
+			line, _, _ := bytes.Cut(data, []byte("\n"))
+			target, ok := bytes.CutPrefix(line, []byte("object "))
+			if !ok {
+				return ZeroHash, fmt.Errorf("malformed tag object %s", hash)
+			}
+			if hash, err = ParseHash(string(target)); err != nil {
+				return ZeroHash, err
+			}
+		default:
+			return ZeroHash, fmt.Errorf("object %s is a %s, not a commit", hash, typ)
+		}
+	}
+	return ZeroHash, fmt.Errorf("tag chain too deep at %s", hash)
+}
+
+// isHex reports whether s consists only of hexadecimal digits.
+func isHex(s string) bool {
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
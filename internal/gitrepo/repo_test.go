@@ -0,0 +1,200 @@
+package gitrepo
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runGit runs git in dir and returns its output.
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_CONFIG_NOSYSTEM=1",
+		"GIT_CONFIG_GLOBAL="+os.DevNull,
+		"GIT_AUTHOR_NAME=Test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=Test", "GIT_COMMITTER_EMAIL=test@example.com",
+		"GIT_AUTHOR_DATE=2024-01-02T03:04:05Z", "GIT_COMMITTER_DATE=2024-01-02T03:04:05Z",
+	)
+	out, err := cmd.Output()
+	if err != nil {
+		stderr := ""
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			stderr = string(exitErr.Stderr)
+		}
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, stderr)
+	}
+	return string(out)
+}
+
+// gitLines runs git and splits its output into lines.
+func gitLines(t *testing.T, dir string, args ...string) []string {
+	t.Helper()
+	out := strings.TrimRight(runGit(t, dir, args...), "\n")
+	if out == "" {
+		return nil
+	}
+	return strings.Split(out, "\n")
+}
+
+// writeFiles writes files relative to dir, creating directories as needed.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// largeText returns a text of many lines, so that git stores versions of it
+// that differ in one line as deltas once packed.
+func largeText(changed string) string {
+	var b strings.Builder
+	for i := range 300 {
+		if i == 150 {
+			b.WriteString(changed + "\n")
+			continue
+		}
+		fmt.Fprintf(&b, "line %d of a file long enough to be stored as a delta\n", i)
+	}
+	return b.String()
+}
+
+// newTestRepo creates a repository with this history:
+//
+//	main:    c1 (tag v1) -- c3 (tag lw)
+//	           \
+//	feature:    c2 -- c4
+//
+// storage is "loose" (objects as committed), "packed" (git gc: ofs-deltas
+// and packed-refs) or "ref-delta" (a pack with ref-deltas only).
+func newTestRepo(t *testing.T, storage string) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	runGit(t, dir, "init", "-q", "-b", "main")
+
+	writeFiles(t, dir, map[string]string{
+		"a.txt":         "alpha\n",
+		"dir/b.go":      "package dir\n\nfunc B() {}\n",
+		"dir/sub/c.md":  "# C\n",
+		"dir/sub/d.md":  "# D\n",
+		"dir/sub/dd.md": "# DD\n",
+		"large.txt":     largeText("original"),
+		"exec.sh":       "#!/bin/sh\necho hi\n",
+	})
+	if err := os.Chmod(filepath.Join(dir, "exec.sh"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("a.txt", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, dir, "add", "-A")
+	runGit(t, dir, "commit", "-q", "-m", "c1")
+	runGit(t, dir, "tag", "-a", "v1", "-m", "version 1")
+
+	runGit(t, dir, "checkout", "-q", "-b", "feature")
+	writeFiles(t, dir, map[string]string{
+		"a.txt":     "alpha, changed\n",
+		"new/e.txt": "new file\n",
+		"large.txt": largeText("changed"),
+	})
+	runGit(t, dir, "mv", "dir/b.go", "dir/b2.go")
+	runGit(t, dir, "rm", "-q", "dir/sub/c.md")
+	if err := os.Chmod(filepath.Join(dir, "exec.sh"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, dir, "add", "-A")
+	runGit(t, dir, "commit", "-q", "-m", "c2")
+	writeFiles(t, dir, map[string]string{"f.txt": "f\n"})
+	runGit(t, dir, "add", "-A")
+	runGit(t, dir, "commit", "-q", "-m", "c4")
+
+	runGit(t, dir, "checkout", "-q", "main")
+	writeFiles(t, dir, map[string]string{"dir/sub/d.md": "# D, changed on main\n"})
+	runGit(t, dir, "commit", "-q", "-am", "c3")
+	runGit(t, dir, "tag", "lw")
+
+	switch storage {
+	case "loose":
+	case "packed":
+		runGit(t, dir, "gc", "-q", "--aggressive", "--prune=now")
+	case "ref-delta":
+		runGit(t, dir, "-c", "repack.useDeltaBaseOffset=false", "repack", "-q", "-a", "-d", "-f")
+		runGit(t, dir, "prune-packed")
+		runGit(t, dir, "pack-refs", "--all")
+	default:
+		t.Fatalf("unknown storage %q", storage)
+	}
+	return dir
+}
+
+// storages are the ways newTestRepo can store objects and refs.
+var storages = []string{"loose", "packed", "ref-delta"}
+
+// openTestRepo opens a repository created by newTestRepo.
+func openTestRepo(t *testing.T, dir string) *Repo {
+	t.Helper()
+	repo, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	return repo
+}
+
+func TestResolveRevisionMatchesGit(t *testing.T) {
+	for _, storage := range storages {
+		t.Run(storage, func(t *testing.T) {
+			dir := newTestRepo(t, storage)
+			repo := openTestRepo(t, dir)
+
+			short := strings.TrimSpace(runGit(t, dir, "rev-parse", "--short=8", "feature~1"))
+			for _, rev := range []string{
+				"HEAD", "@", "main", "feature", "feature~1", "feature^", "feature~2", "main^0",
+				"v1", "lw", "refs/heads/feature", "tags/v1", short,
+			} {
+				want := strings.TrimSpace(runGit(t, dir, "rev-parse", rev+"^{commit}"))
+				got, err := repo.ResolveRevision(rev)
+				if err != nil {
+					t.Errorf("ResolveRevision(%q): %v", rev, err)
+					continue
+				}
+				if got.String() != want {
+					t.Errorf("ResolveRevision(%q) = %s, want %s", rev, got, want)
+				}
+			}
+
+			for _, rev := range []string{"missing", "feature~9", "main^2"} {
+				if got, err := repo.ResolveRevision(rev); err == nil {
+					t.Errorf("ResolveRevision(%q) = %s, want an error", rev, got)
+				}
+			}
+		})
+	}
+}
+
+func TestOpenFindsRepositoryFromSubdirectory(t *testing.T) {
+	dir := newTestRepo(t, "loose")
+	repo, err := Open(filepath.Join(dir, "dir", "sub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+	want, _ := filepath.EvalSymlinks(dir)
+	if got, _ := filepath.EvalSymlinks(repo.WorkTree); got != want {
+		t.Errorf("WorkTree = %s, want %s", repo.WorkTree, dir)
+	}
+}
@@ -0,0 +1,224 @@
+package gitrepo
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CommitFS returns a read-only fs.FS over the tree of the given revision, so
+// a commit can be scanned without checking it out. Every entry reports the
+// commit's timestamp as its modification time; submodules are omitted.
+func (r *Repo) CommitFS(rev string) (fs.FS, error) {
+	hash, err := r.ResolveRevision(rev)
+	if err != nil {
+		return nil, err
+	}
+	commit, err := r.ReadCommit(hash)
+	if err != nil {
+		return nil, err
+	}
+	return &treeFS{
+		repo:    r,
+		root:    commit.Tree,
+		modTime: commit.Time,
+		trees:   make(map[Hash][]TreeEntry),
+		sizes:   make(map[Hash]int64),
+	}, nil
+}
+
+// treeFS implements fs.FS on top of git tree and blob objects.
+type treeFS struct {
+	repo    *Repo
+	root    Hash
+	modTime time.Time
+
+	mu    sync.Mutex
+	trees map[Hash][]TreeEntry // Parsed trees, shared by concurrent readers
+	sizes map[Hash]int64       // Blob sizes read from object headers
+}
+
+// readTree returns the entries of a tree, without submodules.
+func (t *treeFS) readTree(hash Hash) ([]TreeEntry, error) {
+	t.mu.Lock()
+	entries, ok := t.trees[hash]
+	t.mu.Unlock()
+	if ok {
+		return entries, nil
+	}
+
+	all, err := t.repo.ReadTree(hash)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range all {
+		if !e.IsSubmodule() {
+			entries = append(entries, e)
+		}
+	}
+
+	t.mu.Lock()
+	t.trees[hash] = entries
+	t.mu.Unlock()
+	return entries, nil
+}
+
+// blobSize returns the size of a blob without reading its content.
+func (t *treeFS) blobSize(hash Hash) (int64, error) {
+	t.mu.Lock()
+	size, ok := t.sizes[hash]
+	t.mu.Unlock()
+	if ok {
+		return size, nil
+	}
+
+	size, err := t.repo.ObjectSize(hash)
+	if err != nil {
+		return 0, err
+	}
+
+	t.mu.Lock()
+	t.sizes[hash] = size
+	t.mu.Unlock()
+	return size, nil
+}
+
+// Open implements fs.FS.
+func (t *treeFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	entry := TreeEntry{Name: ".", Mode: 0o040000, Hash: t.root}
+	if name != "." {
+		for _, comp := range strings.Split(name, "/") {
+			if !entry.IsDir() {
+				return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+			}
+			entries, err := t.readTree(entry.Hash)
+			if err != nil {
+				return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+			}
+			found := false
+			for _, e := range entries {
+				if e.Name == comp {
+					entry, found = e, true
+					break
+				}
+			}
+			if !found {
+				return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+			}
+		}
+	}
+
+	info := &treeFileInfo{entry: entry, modTime: t.modTime}
+	if entry.IsDir() {
+		entries, err := t.readTree(entry.Hash)
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		info.name = path.Base(name)
+		return &treeDir{fsys: t, info: info, entries: entries}, nil
+	}
+
+	data, err := t.repo.ReadBlob(entry.Hash)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	info.name = entry.Name
+	info.size = int64(len(data))
+	return &treeFile{info: info, Reader: bytes.NewReader(data)}, nil
+}
+
+// treeFileInfo describes a tree entry. It implements fs.FileInfo and fs.DirEntry.
+type treeFileInfo struct {
+	name    string
+	entry   TreeEntry
+	size    int64 // Blob size
+	modTime time.Time
+	fsys    *treeFS // Set on directory entries, whose size Info looks up
+}
+
+func (i *treeFileInfo) Name() string       { return i.name }
+func (i *treeFileInfo) Size() int64        { return i.size }
+func (i *treeFileInfo) ModTime() time.Time { return i.modTime }
+func (i *treeFileInfo) IsDir() bool        { return i.entry.IsDir() }
+func (i *treeFileInfo) Sys() any           { return i.entry }
+func (i *treeFileInfo) Type() fs.FileMode  { return i.Mode().Type() }
+
+// Info implements fs.DirEntry. The size of a blob listed in a directory is
+// read from its object header, so that size limits can be applied before
+// the content is read.
+func (i *treeFileInfo) Info() (fs.FileInfo, error) {
+	if i.fsys == nil || i.entry.IsDir() {
+		return i, nil
+	}
+	size, err := i.fsys.blobSize(i.entry.Hash)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: i.name, Err: err}
+	}
+	info := *i
+	info.size, info.fsys = size, nil
+	return &info, nil
+}
+
+// Mode maps git's file modes onto fs.FileMode.
+func (i *treeFileInfo) Mode() fs.FileMode {
+	switch i.entry.Mode & 0o170000 {
+	case 0o040000:
+		return fs.ModeDir | 0o755
+	case 0o120000:
+		return fs.ModeSymlink | 0o777
+	}
+	if i.entry.Mode&0o111 != 0 {
+		return 0o755
+	}
+	return 0o644
+}
+
+// treeFile is an open blob.
+type treeFile struct {
+	info *treeFileInfo
+	*bytes.Reader
+}
+
+func (f *treeFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *treeFile) Close() error               { return nil }
+
+// treeDir is an open tree.
+type treeDir struct {
+	fsys    *treeFS
+	info    *treeFileInfo
+	entries []TreeEntry
+	offset  int
+}
+
+func (d *treeDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *treeDir) Close() error               { return nil }
+
+func (d *treeDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: fs.ErrInvalid}
+}
+
+// ReadDir implements fs.ReadDirFile. Blob sizes are looked up by Info.
+func (d *treeDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	remaining := d.entries[d.offset:]
+	if n > 0 && len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	if n > 0 && n < len(remaining) {
+		remaining = remaining[:n]
+	}
+	d.offset += len(remaining)
+
+	list := make([]fs.DirEntry, len(remaining))
+	for i, e := range remaining {
+		list[i] = &treeFileInfo{name: e.Name, entry: e, modTime: d.fsys.modTime, fsys: d.fsys}
+	}
+	return list, nil
+}
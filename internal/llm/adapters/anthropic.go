@@ -42,22 +42,6 @@ type AnthropicResponse struct {
 
 // GenerateSummary generates a summary using Anthropic's Claude
 func (a *AnthropicAdapter) GenerateSummary(query string, fileContent string, filePath string) (string, error) {
-	if a.APIKey == "" {
-		return "", fmt.Errorf("Anthropic API key is required")
-	}
-
-	// Set default endpoint if not provided
-	endpoint := "https://api.anthropic.com/v1/messages"
-	if a.Endpoint != "" {
-		endpoint = a.Endpoint
-	}
-
-	// Set default model if not provided
-	model := "claude-3-opus-20240229"
-	if a.ModelName != "" {
-		model = a.ModelName
-	}
-
 	// Construct the prompt
 	prompt := fmt.Sprintf(`
 Analyze the following code file and respond to the user's query:
@@ -74,6 +58,27 @@ Include relevant details such as functions, classes, or patterns that relate to
 Keep your response under 500 words.
 `, filePath, query, fileContent)
 
+	return a.Complete("You are a helpful assistant that summarizes code based on specific queries.", prompt)
+}
+
+// Complete sends a prompt to Claude with a system prompt and returns the answer
+func (a *AnthropicAdapter) Complete(system string, prompt string) (string, error) {
+	if a.APIKey == "" {
+		return "", fmt.Errorf("Anthropic API key is required")
+	}
+
+	// Set default endpoint if not provided
+	endpoint := "https://api.anthropic.com/v1/messages"
+	if a.Endpoint != "" {
+		endpoint = a.Endpoint
+	}
+
+	// Set default model if not provided
+	model := "claude-3-opus-20240229"
+	if a.ModelName != "" {
+		model = a.ModelName
+	}
+
 	// Create the request body
 	requestBody := AnthropicRequest{
 		Model: model,
@@ -84,7 +89,7 @@ Keep your response under 500 words.
 			},
 		},
 		MaxTokens: 1500, // Reasonable limit for summaries
-		System:    "You are a helpful assistant that summarizes code based on specific queries.",
+		System:    system,
 	}
 
 	requestJSON, err := json.Marshal(requestBody)
@@ -47,22 +47,6 @@ type DeepSeekResponse struct {
 
 // GenerateSummary generates a summary using DeepSeek's models
 func (d *DeepSeekAdapter) GenerateSummary(query string, fileContent string, filePath string) (string, error) {
-	if d.APIKey == "" {
-		return "", fmt.Errorf("DeepSeek API key is required")
-	}
-
-	// Set default endpoint if not provided
-	endpoint := "https://api.deepseek.com/chat/completions"
-	if d.Endpoint != "" {
-		endpoint = d.Endpoint
-	}
-
-	// Set default model if not provided
-	model := "deepseek-chat"
-	if d.ModelName != "" {
-		model = d.ModelName
-	}
-
 	// Construct the prompt
 	prompt := fmt.Sprintf(`
 Analyze the following code file and respond to the user's query:
@@ -79,13 +63,34 @@ Include relevant details such as functions, classes, or patterns that relate to
 Keep your response under 500 words.
 `, filePath, query, fileContent)
 
+	return d.Complete("You are a helpful assistant that summarizes code based on specific queries.", prompt)
+}
+
+// Complete sends a prompt to DeepSeek with a system prompt and returns the answer
+func (d *DeepSeekAdapter) Complete(system string, prompt string) (string, error) {
+	if d.APIKey == "" {
+		return "", fmt.Errorf("DeepSeek API key is required")
+	}
+
+	// Set default endpoint if not provided
+	endpoint := "https://api.deepseek.com/chat/completions"
+	if d.Endpoint != "" {
+		endpoint = d.Endpoint
+	}
+
+	// Set default model if not provided
+	model := "deepseek-chat"
+	if d.ModelName != "" {
+		model = d.ModelName
+	}
+
 	// Create the request body
 	requestBody := DeepSeekRequest{
 		Model: model,
 		Messages: []DeepSeekMessage{
 			{
 				Role:    "system",
-				Content: "You are a helpful assistant that summarizes code based on specific queries.",
+				Content: system,
 			},
 			{
 				Role:    "user",
@@ -17,6 +17,26 @@ type GeminiAdapter struct {
 
 // GenerateSummary generates a summary using Google's Gemini via the Go SDK
 func (g *GeminiAdapter) GenerateSummary(query string, fileContent string, filePath string) (string, error) {
+	// Construct the prompt
+	prompt := fmt.Sprintf(`Analyze the following code file and respond to the user's query:
+
+FILE PATH: %s
+
+USER QUERY: %s
+
+CODE CONTENT:
+%s
+
+Provide a concise summary focusing specifically on the user's query.
+Include relevant details such as functions, classes, or patterns that relate to the query.
+Keep your response under 500 words.`, filePath, query, fileContent)
+
+	return g.Complete("You are a helpful assistant that summarizes code based on specific queries.", prompt)
+}
+
+// Complete sends a prompt to Gemini, preceded by the system prompt, and
+// returns the answer
+func (g *GeminiAdapter) Complete(system string, prompt string) (string, error) {
 	if g.APIKey == "" {
 		return "", fmt.Errorf("Google API key is required")
 	}
@@ -46,24 +66,8 @@ func (g *GeminiAdapter) GenerateSummary(query string, fileContent string, filePa
 	model.GenerationConfig.TopP = genai.Ptr[float32](0.95)
 	model.GenerationConfig.TopK = genai.Ptr[int32](40) // Note: TopK might not be supported by all models or configurations
 
-	// Construct the prompt
-	prompt := fmt.Sprintf(`You are a helpful assistant that summarizes code based on specific queries.
-
-Analyze the following code file and respond to the user's query:
-
-FILE PATH: %s
-
-USER QUERY: %s
-
-CODE CONTENT:
-%s
-
-Provide a concise summary focusing specifically on the user's query.
-Include relevant details such as functions, classes, or patterns that relate to the query.
-Keep your response under 500 words.`, filePath, query, fileContent)
-
 	// Generate content using the SDK
-	resp, err := model.GenerateContent(ctx, genai.Text(prompt))
+	resp, err := model.GenerateContent(ctx, genai.Text(system+"\n\n"+prompt))
 	if err != nil {
 		return "", fmt.Errorf("error generating content via Gemini SDK: %w", err)
 	}
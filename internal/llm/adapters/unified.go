@@ -64,6 +64,12 @@ Include relevant details such as functions, classes, or patterns that relate to
 Keep your response under 500 words.
 `, filePath, query, fileContent)
 
+	return a.Complete("You are a helpful assistant that summarizes code based on specific queries.", prompt)
+}
+
+// Complete sends a prompt with a system prompt through the unified API and
+// returns the answer. Completion models only get the prompt.
+func (a *UnifiedAdapter) Complete(system string, prompt string) (string, error) {
 	// Determine if we're using a chat-based or completion-based model
 	var isChatModel bool = true // Default to chat model
 	if strings.Contains(a.ModelName, "completion") || strings.Contains(a.ModelName, "text-") {
@@ -84,7 +90,7 @@ Keep your response under 500 words.
 		request.Messages = []Message{
 			{
 				Role:    "system",
-				Content: "You are a helpful assistant that summarizes code based on specific queries.",
+				Content: system,
 			},
 			{
 				Role:    "user",
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/fs"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -19,6 +20,14 @@ type Provider interface {
 	GenerateSummary(query string, fileContent string, filePath string) (string, error)
 }
 
+// Completer is a Provider that also answers free-form prompts, which tasks
+// other than summaries (such as reranking files) need. Every provider but the
+// placeholder implements it.
+type Completer interface {
+	Provider
+	Complete(system string, prompt string) (string, error)
+}
+
 // Config holds the configuration for the LLM service
 type Config struct {
 	APIKey    string
@@ -105,20 +114,6 @@ type OpenAIResponse struct {
 
 // GenerateSummary generates a summary of a file based on the query
 func (p *OpenAIProvider) GenerateSummary(query string, fileContent string, filePath string) (string, error) {
-	if p.APIKey == "" {
-		return "", fmt.Errorf("OpenAI API key is required")
-	}
-
-	endpoint := "https://api.openai.com/v1/chat/completions"
-	if p.Endpoint != "" {
-		endpoint = p.Endpoint
-	}
-
-	model := "gpt-3.5-turbo"
-	if p.ModelName != "" {
-		model = p.ModelName
-	}
-
 	// Construct the prompt
 	prompt := fmt.Sprintf(`
 You are a code summarizer. Analyze the following code file and respond to the user's query:
@@ -135,13 +130,32 @@ Include relevant details such as functions, classes, or patterns that relate to
 Keep your response under 500 words.
 `, filePath, query, fileContent)
 
+	return p.Complete("You are a helpful assistant that summarizes code based on specific queries.", prompt)
+}
+
+// Complete sends a prompt to OpenAI with a system prompt and returns the answer
+func (p *OpenAIProvider) Complete(system string, prompt string) (string, error) {
+	if p.APIKey == "" {
+		return "", fmt.Errorf("OpenAI API key is required")
+	}
+
+	endpoint := "https://api.openai.com/v1/chat/completions"
+	if p.Endpoint != "" {
+		endpoint = p.Endpoint
+	}
+
+	model := "gpt-3.5-turbo"
+	if p.ModelName != "" {
+		model = p.ModelName
+	}
+
 	// Create the request body
 	requestBody := OpenAIRequest{
 		Model: model,
 		Messages: []Message{
 			{
 				Role:    "system",
-				Content: "You are a helpful assistant that summarizes code based on specific queries.",
+				Content: system,
 			},
 			{
 				Role:    "user",
@@ -225,23 +239,6 @@ type OllamaChatResponse struct {
 // GenerateSummary generates a summary using a locally hosted model
 func (p *LocalProvider) GenerateSummary(query string, fileContent string, filePath string) (string, error) {
 	fmt.Println("=== OLLAMA DEBUGGING ===")
-	fmt.Println("Attempting to connect to Ollama...")
-
-	// Use the newer chat API format which is more stable
-	chatEndpoint := "http://localhost:11434/api/chat"
-	if p.Endpoint != "" {
-		chatEndpoint = p.Endpoint
-		fmt.Println("Using custom endpoint:", chatEndpoint)
-	} else {
-		fmt.Println("Using default endpoint:", chatEndpoint)
-	}
-
-	if p.ModelName == "" {
-		p.ModelName = "llama2"
-		fmt.Println("Using default model:", p.ModelName)
-	} else {
-		fmt.Println("Using specified model:", p.ModelName)
-	}
 
 	// Construct the prompt
 	fmt.Println("Creating prompt for file:", filePath)
@@ -263,17 +260,53 @@ DO NOT include recommendations, suggestions, or any advice on how to improve the
 DO NOT suggest tests that should be written.
 Focus ONLY on describing what the code does related to the query.`, filePath, query, fileContent)
 
+	summary, err := p.Complete("You are a helpful assistant that summarizes code based on specific queries.", userPrompt)
+	if err == nil {
+		fmt.Println("Successfully received valid chat response!")
+		fmt.Println("=== END DEBUGGING ===")
+		return summary, nil
+	}
+	fmt.Println(err)
+
+	fmt.Println("Falling back to placeholder provider")
+	fmt.Println("=== END DEBUGGING ===")
+
+	placeholder := &PlaceholderProvider{}
+	return placeholder.GenerateSummary(query, fileContent, filePath)
+}
+
+// Complete sends a prompt to the local model with a system prompt and
+// returns the answer
+func (p *LocalProvider) Complete(system string, prompt string) (string, error) {
+	fmt.Println("Attempting to connect to Ollama...")
+
+	// Use the newer chat API format which is more stable
+	chatEndpoint := "http://localhost:11434/api/chat"
+	if p.Endpoint != "" {
+		chatEndpoint = p.Endpoint
+		fmt.Println("Using custom endpoint:", chatEndpoint)
+	} else {
+		fmt.Println("Using default endpoint:", chatEndpoint)
+	}
+
+	if p.ModelName == "" {
+		p.ModelName = "llama2"
+		fmt.Println("Using default model:", p.ModelName)
+	} else {
+		fmt.Println("Using specified model:", p.ModelName)
+	}
+
 	// Create the request body for Ollama chat
 	chatRequestBody := map[string]interface{}{
 		"model": p.ModelName,
 		"messages": []map[string]string{
 			{
 				"role":    "system",
-				"content": "You are a helpful assistant that summarizes code based on specific queries.",
+				"content": system,
 			},
 			{
 				"role":    "user",
-				"content": userPrompt,
+				"content": prompt,
 			},
 		},
 		"stream": false,
@@ -284,76 +317,56 @@ Focus ONLY on describing what the code does related to the query.`, filePath, qu
 
 	chatRequestJSON, err := json.Marshal(chatRequestBody)
 	if err != nil {
-		fmt.Println("Error marshaling chat request:", err)
-		goto fallback
+		return "", fmt.Errorf("error marshaling chat request: %w", err)
 	}
 
 	// Make direct HTTP request
-	{
-		fmt.Println("Sending request to Ollama...")
-
-		client := &http.Client{Timeout: 300 * time.Second} // Increase timeout to 5 minutes
-		req, err := http.NewRequest("POST", chatEndpoint, bytes.NewBuffer(chatRequestJSON))
-		if err != nil {
-			fmt.Println("Error creating request:", err)
-			goto fallback
-		}
-
-		req.Header.Set("Content-Type", "application/json")
+	fmt.Println("Sending request to Ollama...")
 
-		fmt.Println("Waiting for Ollama response...")
-		resp, err := client.Do(req)
-		if err != nil {
-			fmt.Println("Error connecting to Ollama:", err)
-			goto fallback
-		}
-		defer resp.Body.Close()
+	client := &http.Client{Timeout: 300 * time.Second} // Increase timeout to 5 minutes
+	req, err := http.NewRequest("POST", chatEndpoint, bytes.NewBuffer(chatRequestJSON))
+	if err != nil {
+		return "", fmt.Errorf("error creating request: %w", err)
+	}
 
-		// Read the response
-		respBody, err := io.ReadAll(resp.Body)
-		if err != nil {
-			fmt.Println("Error reading response:", err)
-			goto fallback
-		}
+	req.Header.Set("Content-Type", "application/json")
 
-		fmt.Println("HTTP Status:", resp.StatusCode)
+	fmt.Println("Waiting for Ollama response...")
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error connecting to Ollama: %w", err)
+	}
+	defer resp.Body.Close()
 
-		if resp.StatusCode != http.StatusOK {
-			fmt.Println("API error:", string(respBody))
-			goto fallback
-		}
+	// Read the response
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("error reading response: %w", err)
+	}
 
-		// Show a preview of the response
-		if len(respBody) > 100 {
-			fmt.Println("Response received (truncated):", string(respBody[:100]), "...")
-		} else {
-			fmt.Println("Response received:", string(respBody))
-		}
+	fmt.Println("HTTP Status:", resp.StatusCode)
 
-		// Try to parse as Ollama chat response
-		var ollamaChatResp OllamaChatResponse
-		if err := json.Unmarshal(respBody, &ollamaChatResp); err != nil {
-			fmt.Println("Error parsing chat response:", err)
-			fmt.Println("Full response:", string(respBody))
-			goto fallback
-		}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("API error: %s", string(respBody))
+	}
 
-		if ollamaChatResp.Message.Content != "" {
-			fmt.Println("Successfully received valid chat response!")
-			fmt.Println("=== END DEBUGGING ===")
-			return ollamaChatResp.Message.Content, nil
-		} else {
-			fmt.Println("Response was empty or invalid")
-			fmt.Println("Full response:", string(respBody))
-		}
+	// Show a preview of the response
+	if len(respBody) > 100 {
+		fmt.Println("Response received (truncated):", string(respBody[:100]), "...")
+	} else {
+		fmt.Println("Response received:", string(respBody))
 	}
 
-fallback:
-	fmt.Println("Falling back to placeholder provider")
-	fmt.Println("=== END DEBUGGING ===")
+	// Try to parse as Ollama chat response
+	var ollamaChatResp OllamaChatResponse
+	if err := json.Unmarshal(respBody, &ollamaChatResp); err != nil {
+		return "", fmt.Errorf("error parsing chat response: %w (full response: %s)", err, string(respBody))
+	}
 
-	placeholder := &PlaceholderProvider{}
-	return placeholder.GenerateSummary(query, fileContent, filePath)
+	if ollamaChatResp.Message.Content == "" {
+		return "", fmt.Errorf("response was empty or invalid (full response: %s)", string(respBody))
+	}
+	return ollamaChatResp.Message.Content, nil
 }
 
 // Helper function to truncate long strings for logging
@@ -421,13 +434,17 @@ func (p *PlaceholderProvider) GenerateSummary(query string, fileContent string,
 
 // GenerateSummaries processes multiple files to generate summaries based on the query
 func GenerateSummaries(provider Provider, query string, targetPath string, relevantFiles []string) (map[string]string, error) {
+	return GenerateSummariesFS(provider, query, os.DirFS(targetPath), relevantFiles)
+}
+
+// GenerateSummariesFS is like GenerateSummaries but reads the files from fsys,
+// which may be an archive or a git tree rather than a directory on disk.
+func GenerateSummariesFS(provider Provider, query string, fsys fs.FS, relevantFiles []string) (map[string]string, error) {
 	summaries := make(map[string]string)
 
 	for _, filePath := range relevantFiles {
-		fullPath := filepath.Join(targetPath, filePath)
-
 		// Read file content
-		content, err := os.ReadFile(fullPath)
+		content, err := fs.ReadFile(fsys, filepath.ToSlash(filePath))
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Warning: Could not read file %s: %v\n", filePath, err)
 			summaries[filePath] = fmt.Sprintf("Error: Could not read file: %v", err)
@@ -3,12 +3,25 @@ package output
 import (
 	"fmt"
 	"os"
-	"path/filepath"
 	"sort"
 	"strings"
 	"time"
 )
 
+// FileMeta carries per-file details shown next to each summary.
+type FileMeta struct {
+	GitStatus string   // "added", "modified" or "renamed" in git-aware modes
+	OldPath   string   // Previous path for renamed files
+	Language  string   // Detected language
+	Size      int64    // Size in bytes
+	Lines     int      // Number of lines
+	Tests     []string // Test files covering this file
+	Module    string   // Module owning the file (e.g. "api (services/api)"); files are grouped by it
+	Matches   []string // Line ranges that matched the query best (e.g. "L120-L180")
+
+	Explanation string // Markdown explaining why the file was selected, in --explain mode
+}
+
 // GenerateMarkdown generates a Markdown file with the analysis results
 func GenerateMarkdown(
 	outputFileName string,
@@ -17,6 +30,7 @@ func GenerateMarkdown(
 	includeTree bool,
 	treeString string,
 	summaries map[string]string,
+	fileMeta map[string]FileMeta,
 ) error {
 	// Create or truncate the output file
 	outputFile, err := os.Create(outputFileName)
@@ -51,20 +65,96 @@ func GenerateMarkdown(
 	}
 	sort.Strings(filePaths)
 
+	// Group the summaries by module when the files were tagged with one
+	groups := make(map[string][]string)
 	for _, filePath := range filePaths {
-		summary := summaries[filePath]
+		module := fileMeta[filePath].Module
+		groups[module] = append(groups[module], filePath)
+	}
+	if _, untagged := groups[""]; len(groups) == 1 && untagged {
+		for _, filePath := range filePaths {
+			writeFileSummary(outputFile, filePath, summaries[filePath], fileMeta[filePath])
+		}
+		return nil
+	}
 
-		// Add a section for each file
-		fmt.Fprintf(outputFile, "### %s\n\n", filePath)
-		fmt.Fprintf(outputFile, "%s\n\n", summary)
+	var modules []string
+	for module := range groups {
+		if module != "" {
+			modules = append(modules, module)
+		}
+	}
+	sort.Strings(modules)
+	if _, untagged := groups[""]; untagged {
+		modules = append(modules, "") // Files outside any module come last
+	}
 
-		// Add a line break between file summaries
-		fmt.Fprintf(outputFile, "---\n\n")
+	for _, module := range modules {
+		if module == "" {
+			fmt.Fprintf(outputFile, "## Other Files\n\n")
+		} else {
+			fmt.Fprintf(outputFile, "## Module: %s\n\n", module)
+		}
+		for _, filePath := range groups[module] {
+			writeFileSummary(outputFile, filePath, summaries[filePath], fileMeta[filePath])
+		}
 	}
 
 	return nil
 }
 
+// writeFileSummary writes the section for one file.
+func writeFileSummary(file *os.File, filePath string, summary string, meta FileMeta) {
+	fmt.Fprintf(file, "### %s\n\n", filePath)
+	if details := formatFileMeta(meta); details != "" {
+		fmt.Fprintf(file, "%s\n\n", details)
+	}
+	if meta.Explanation != "" {
+		fmt.Fprintf(file, "%s\n\n", meta.Explanation)
+	}
+	fmt.Fprintf(file, "%s\n\n", summary)
+
+	// Add a line break between file summaries
+	fmt.Fprintf(file, "---\n\n")
+}
+
+// formatFileMeta renders the details line shown under a file heading.
+func formatFileMeta(meta FileMeta) string {
+	var parts []string
+	if meta.GitStatus != "" {
+		status := fmt.Sprintf("**Status:** %s", meta.GitStatus)
+		if meta.OldPath != "" {
+			status += fmt.Sprintf(" (from `%s`)", meta.OldPath)
+		}
+		parts = append(parts, status)
+	}
+	if meta.Language != "" {
+		parts = append(parts, fmt.Sprintf("**Language:** %s", meta.Language))
+	}
+	if meta.Size > 0 {
+		parts = append(parts, fmt.Sprintf("**Size:** %s, %d lines", formatSize(meta.Size), meta.Lines))
+	}
+	if len(meta.Tests) > 0 {
+		parts = append(parts, fmt.Sprintf("**Tests:** `%s`", strings.Join(meta.Tests, "`, `")))
+	}
+	if len(meta.Matches) > 0 {
+		parts = append(parts, fmt.Sprintf("**Best matches:** %s", strings.Join(meta.Matches, ", ")))
+	}
+	return strings.Join(parts, " | ")
+}
+
+// formatSize renders a byte count in human-readable units.
+func formatSize(size int64) string {
+	switch {
+	case size >= 1024*1024:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1024*1024))
+	case size >= 1024:
+		return fmt.Sprintf("%.1f KB", float64(size)/1024)
+	default:
+		return fmt.Sprintf("%d B", size)
+	}
+}
+
 // generateSingleServiceOutput creates output for a single service/directory
 func generateSingleServiceOutput(
 	file *os.File,
@@ -102,73 +192,3 @@ func generateSingleServiceOutput(
 		fmt.Fprintln(file)
 	}
 }
-
-// generateMultiServiceOutput organizes output by service (immediate subdirectories)
-func generateMultiServiceOutput(
-	file *os.File,
-	targetPath string,
-	showTree bool,
-	treeString string,
-	summaries map[string]string,
-) {
-	// Add tree if requested - the full tree above all services
-	if showTree {
-		fmt.Fprintln(file, "## Directory Structure")
-		fmt.Fprintln(file)
-		fmt.Fprintln(file, treeString)
-		fmt.Fprintln(file, "(* Indicates files included in the summaries below)")
-		fmt.Fprintln(file)
-		fmt.Fprintln(file, "---")
-		fmt.Fprintln(file)
-	}
-
-	// Group files by immediate subdirectory
-	serviceFiles := make(map[string][]string)
-	rootFiles := []string{}
-
-	for filePath := range summaries {
-		parts := strings.Split(filepath.ToSlash(filePath), "/")
-		if len(parts) == 1 {
-			// This is a file in the root directory
-			rootFiles = append(rootFiles, filePath)
-		} else {
-			// This is a file in a subdirectory
-			service := parts[0]
-			serviceFiles[service] = append(serviceFiles[service], filePath)
-		}
-	}
-
-	// Sort service names for consistent output
-	var services []string
-	for service := range serviceFiles {
-		services = append(services, service)
-	}
-	sort.Strings(services)
-
-	// Add root files first if any
-	if len(rootFiles) > 0 {
-		fmt.Fprintln(file, "## Root Directory")
-		fmt.Fprintln(file)
-
-		sort.Strings(rootFiles)
-		for _, filePath := range rootFiles {
-			fmt.Fprintf(file, "### `%s`\n", filePath)
-			fmt.Fprintln(file, summaries[filePath])
-			fmt.Fprintln(file)
-		}
-	}
-
-	// Add each service's files
-	for _, service := range services {
-		fmt.Fprintf(file, "## Service: %s\n", service)
-		fmt.Fprintln(file)
-
-		// Sort files within this service
-		sort.Strings(serviceFiles[service])
-		for _, filePath := range serviceFiles[service] {
-			fmt.Fprintf(file, "### `%s`\n", filePath)
-			fmt.Fprintln(file, summaries[filePath])
-			fmt.Fprintln(file)
-		}
-	}
-}
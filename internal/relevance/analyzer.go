@@ -0,0 +1,230 @@
+package relevance
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// QueryTerm is a search term taken from a query.
+type QueryTerm struct {
+	Term   string  // Stemmed term, in the form files are indexed in (see Tokenize)
+	Word   string  // Query word, or synonym, the term comes from
+	Weight float64 // 1 for the query's own terms, SynonymWeight for synonyms
+}
+
+// SynonymWeight is how much a term added as a synonym counts, relative to
+// the terms of the query itself.
+const SynonymWeight = 0.5
+
+// String formats the term for logs, e.g. "login (synonym)".
+func (t QueryTerm) String() string {
+	if t.Weight < 1 {
+		return t.Word + " (synonym)"
+	}
+	return t.Word
+}
+
+// Analyzer turns queries into weighted search terms. Words are split at
+// identifier boundaries and stemmed like the indexed files (see Tokenize),
+// stopwords are dropped unless they are written as acronyms ("IT", "OR"),
+// and the synonyms of each term are added with a lower weight. Every
+// relevance approach analyzes queries with the same Analyzer.
+type Analyzer struct {
+	Stopwords map[string]bool     // Lowercase query words that are ignored
+	Synonyms  map[string][]string // Words added to queries, by the term they expand (see AddSynonyms)
+}
+
+// defaultStopwords are English function words, and words that questions
+// about code use without saying anything about what to look for.
+const defaultStopwords = `
+a about above after again against all also am an and any are as at be because been before
+being below between both but by can could did do does doing don down during each either
+etc even ever every few for from further had has have having he her here hers herself him
+himself his how however i if in into is it its itself just let lets like may me might more
+most must my myself neither no nor not now of off on once only or other ought our ours
+ourselves out over own please same shall she should so some such than that the their
+theirs them themselves then there these they this those through thus to too under until up
+upon us very via was we were what whatever when whenever where whereas wherever whether
+which while who whom whose why will with within without would yet you your yours yourself
+yourselves
+
+code codebase defined describe explain file files find handled implemented implementation
+know located logic look looking need part responsible show tell thing things used using
+want way work works`
+
+// defaultSynonyms expand common abbreviations and acronyms of code into the
+// words they stand for, and a few concepts into the names they usually go by.
+var defaultSynonyms = map[string][]string{
+	"auth":     {"authentication", "authorization", "login", "jwt", "session", "token", "credential"},
+	"login":    {"signin", "authentication", "session"},
+	"db":       {"database", "sql", "repository", "store"},
+	"database": {"db", "sql", "repository"},
+	"config":   {"configuration", "settings", "options", "env"},
+	"cfg":      {"config", "configuration"},
+	"repo":     {"repository"},
+	"env":      {"environment"},
+	"err":      {"error"},
+	"msg":      {"message"},
+	"req":      {"request"},
+	"res":      {"response"},
+	"ctx":      {"context"},
+	"pkg":      {"package"},
+	"impl":     {"implementation"},
+	"util":     {"utility", "helper"},
+	"k8s":      {"kubernetes"},
+	"i18n":     {"internationalization", "localization", "translation", "locale"},
+	"ui":       {"frontend", "view", "component"},
+	"api":      {"endpoint", "handler", "route"},
+}
+
+// DefaultAnalyzer returns an analyzer with the built-in stopwords and
+// synonyms, which callers may extend.
+func DefaultAnalyzer() *Analyzer {
+	a := &Analyzer{Stopwords: make(map[string]bool), Synonyms: make(map[string][]string)}
+	for _, word := range strings.Fields(defaultStopwords) {
+		a.Stopwords[word] = true
+	}
+	for term, words := range defaultSynonyms {
+		a.AddSynonyms(term, words...)
+	}
+	return a
+}
+
+// defaultAnalyzer is used by the functions given no Analyzer.
+var defaultAnalyzer = DefaultAnalyzer()
+
+// analyzerOrDefault returns a, or the default analyzer when a is nil.
+func analyzerOrDefault(a *Analyzer) *Analyzer {
+	if a == nil {
+		return defaultAnalyzer
+	}
+	return a
+}
+
+// AddSynonyms adds words to the queries containing term. Words may be
+// identifiers ("userRepository"); they are analyzed like the query.
+func (a *Analyzer) AddSynonyms(term string, words ...string) {
+	key := synonymKey(term)
+	if key == "" {
+		return
+	}
+	a.Synonyms[key] = append(a.Synonyms[key], words...)
+}
+
+// synonymKey returns the term under which the synonyms of a word are kept:
+// the stem of the word with its identifier parts joined, as Tokenize emits
+// it for the whole identifier.
+func synonymKey(word string) string {
+	term, _ := normalizeTerm(strings.Join(splitIdentifier(strings.TrimSpace(word)), ""))
+	return term
+}
+
+// LoadSynonyms reads a synonym dictionary from a JSON file such as
+//
+//	{"auth": ["login", "jwt", "session"], "db": ["sql", "repository"]}
+func LoadSynonyms(path string) (map[string][]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var synonyms map[string][]string
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if err := decoder.Decode(&synonyms); err != nil {
+		return nil, fmt.Errorf("error reading synonyms %s: %w", path, err)
+	}
+	return synonyms, nil
+}
+
+// ParseSynonyms parses synonyms given as "auth=login,jwt,session".
+func ParseSynonyms(value string) (string, []string, error) {
+	term, list, ok := strings.Cut(value, "=")
+	if !ok || strings.TrimSpace(term) == "" {
+		return "", nil, fmt.Errorf("invalid synonyms %q (expected term=word,word)", value)
+	}
+	var words []string
+	for _, word := range strings.Split(list, ",") {
+		if word = strings.TrimSpace(word); word != "" {
+			words = append(words, word)
+		}
+	}
+	if len(words) == 0 {
+		return "", nil, fmt.Errorf("invalid synonyms %q (no words after '=')", value)
+	}
+	return strings.TrimSpace(term), words, nil
+}
+
+// Analyze returns the search terms of a query: its own terms in order,
+// then their synonyms. Each term appears once, with its highest weight.
+func (a *Analyzer) Analyze(query string) []QueryTerm {
+	var terms []QueryTerm
+	index := make(map[string]int)
+	add := func(term string, word string, weight float64) {
+		if i, ok := index[term]; ok {
+			terms[i].Weight = max(terms[i].Weight, weight)
+			return
+		}
+		index[term] = len(terms)
+		terms = append(terms, QueryTerm{Term: term, Word: word, Weight: weight})
+	}
+
+	for _, word := range splitWords(query) {
+		parts := splitIdentifier(word)
+		for _, part := range parts {
+			if a.Stopwords[strings.ToLower(part)] && !isAcronym(part) {
+				continue
+			}
+			if term, ok := normalizeTerm(part); ok {
+				add(term, strings.ToLower(part), 1)
+			}
+		}
+		if len(parts) > 1 {
+			if term, ok := normalizeTerm(strings.Join(parts, "")); ok {
+				add(term, strings.ToLower(word), 1)
+			}
+		}
+	}
+
+	// Expand the query's own terms; synonyms of synonyms are not added
+	for _, own := range append([]QueryTerm(nil), terms...) {
+		for _, synonym := range a.Synonyms[own.Term] {
+			for _, word := range splitWords(synonym) {
+				for _, term := range Tokenize(word) {
+					add(term, strings.ToLower(word), SynonymWeight)
+				}
+			}
+		}
+	}
+	return terms
+}
+
+// Describe lists the terms of a query for logs, e.g.
+// "auth, login (synonym), session (synonym)".
+func (a *Analyzer) Describe(query string) string {
+	var parts []string
+	for _, term := range a.Analyze(query) {
+		parts = append(parts, term.String())
+	}
+	if len(parts) == 0 {
+		return "(none)"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// isAcronym reports whether a word is written as an acronym: at least two
+// capital letters and nothing else, but for a plural "s" ("APIs").
+func isAcronym(word string) bool {
+	word = strings.TrimSuffix(word, "s")
+	if len(word) < 2 {
+		return false
+	}
+	for _, r := range word {
+		if !unicode.IsUpper(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,99 @@
+package relevance
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAnalyze(t *testing.T) {
+	a := &Analyzer{
+		Stopwords: map[string]bool{"where": true, "is": true, "the": true, "it": true, "or": true},
+		Synonyms:  map[string][]string{},
+	}
+	a.AddSynonyms("auth", "login", "sessionToken")
+	a.AddSynonyms("login", "signin", "session")
+	a.AddSynonyms("userRepository", "userStore")
+	a.AddSynonyms("api", "endpoint")
+
+	own := func(term, word string) QueryTerm { return QueryTerm{Term: term, Word: word, Weight: 1} }
+	synonym := func(term, word string) QueryTerm { return QueryTerm{Term: term, Word: word, Weight: SynonymWeight} }
+	tests := []struct {
+		name  string
+		query string
+		want  []QueryTerm
+	}{
+		{"stopwords are dropped", "where is the parser", []QueryTerm{own("parser", "parser")}},
+		{"only stopwords", "where is it", nil},
+		{"acronyms are kept", "where is IT or OR", []QueryTerm{own("it", "it"), own("or", "or")}},
+		{"plural acronyms", "list APIs", []QueryTerm{own("list", "list"), own("api", "apis"), synonym("endpoint", "endpoint")}},
+		{"single capitals are not acronyms", "I", nil},
+		{
+			"identifiers are split and joined", "userRepository",
+			[]QueryTerm{
+				own("user", "user"), own("repositori", "repository"), own("userrepositori", "userrepository"),
+				synonym("store", "userstore"), synonym("userstor", "userstore"),
+			},
+		},
+		{
+			"synonyms are not expanded again", "auth",
+			[]QueryTerm{
+				own("auth", "auth"), synonym("login", "login"),
+				synonym("session", "sessiontoken"), synonym("token", "sessiontoken"), synonym("sessiontoken", "sessiontoken"),
+			},
+		},
+		{
+			"own terms keep their weight", "auth login",
+			[]QueryTerm{
+				own("auth", "auth"), own("login", "login"),
+				synonym("session", "sessiontoken"), synonym("token", "sessiontoken"), synonym("sessiontoken", "sessiontoken"),
+				synonym("signin", "signin"),
+			},
+		},
+		{"repeated terms appear once", "parser Parsers parsing", []QueryTerm{own("parser", "parser"), own("pars", "parsing")}},
+	}
+	for _, tt := range tests {
+		if got := a.Analyze(tt.query); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Analyze(%q) =\n%v\nwant\n%v", tt.name, tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestDefaultAnalyzer(t *testing.T) {
+	a := DefaultAnalyzer()
+	if got := a.Describe("how is the auth handled"); got != "auth, authentication (synonym), authorization (synonym), login (synonym), jwt (synonym), session (synonym), token (synonym), credential (synonym)" {
+		t.Errorf("Describe = %q", got)
+	}
+	if got := a.Describe("where is it"); got != "(none)" {
+		t.Errorf("Describe of stopwords = %q, want (none)", got)
+	}
+}
+
+func TestParseSynonyms(t *testing.T) {
+	term, words, err := ParseSynonyms(" auth = login, jwt ,,session ")
+	if err != nil || term != "auth" || !reflect.DeepEqual(words, []string{"login", "jwt", "session"}) {
+		t.Errorf("ParseSynonyms = %q, %q, %v", term, words, err)
+	}
+	for _, value := range []string{"auth", "=login", "auth=", "auth= , "} {
+		if _, _, err := ParseSynonyms(value); err == nil {
+			t.Errorf("ParseSynonyms(%q) succeeded", value)
+		}
+	}
+}
+
+func TestExtractQueryKeyword(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"Where is the rate limiter configured?", "configured"},
+		{"how is the auth handled", "auth"}, // Synonyms are not the query's words
+		{"Which files use the UserRepository?", "userrepository"},
+		{"what does IT do", "it"},
+		{"where is it", "query"},
+	}
+	for _, tt := range tests {
+		if got := ExtractQueryKeyword(tt.query); got != tt.want {
+			t.Errorf("ExtractQueryKeyword(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package relevance
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BatchEmbeddingAdapter is an EmbeddingAdapter that can embed several texts
+// in one request.
+type BatchEmbeddingAdapter interface {
+	EmbeddingAdapter
+	// GenerateEmbeddings returns the embeddings of texts, in the same order.
+	GenerateEmbeddings(ctx context.Context, texts []string) ([][]float64, error)
+}
+
+// GenerateEmbeddings embeds texts with adapter, in one call when it supports
+// batches and one text at a time otherwise.
+func GenerateEmbeddings(ctx context.Context, adapter EmbeddingAdapter, texts []string) ([][]float64, error) {
+	if batcher, ok := adapter.(BatchEmbeddingAdapter); ok {
+		return batcher.GenerateEmbeddings(ctx, texts)
+	}
+	return embedOneByOne(ctx, adapter, texts)
+}
+
+// embedOneByOne embeds texts with one GenerateEmbedding call each.
+func embedOneByOne(ctx context.Context, adapter EmbeddingAdapter, texts []string) ([][]float64, error) {
+	embeddings := make([][]float64, len(texts))
+	for i, text := range texts {
+		embedding, err := adapter.GenerateEmbedding(ctx, text)
+		if err != nil {
+			return nil, err
+		}
+		embeddings[i] = embedding
+	}
+	return embeddings, nil
+}
+
+// BatchOptions controls how many texts are embedded per request, how many
+// requests run at once and how fast requests are sent.
+type BatchOptions struct {
+	BatchSize   int     // Texts per request (0 = 32)
+	Concurrency int     // Requests in flight (0 = 4)
+	RateLimit   float64 // Requests per second to the provider (0 = provider default, negative = unlimited)
+}
+
+// DefaultBatchOptions returns the default batching settings.
+func DefaultBatchOptions() BatchOptions {
+	return BatchOptions{BatchSize: 32, Concurrency: 4}
+}
+
+// defaultRateLimits are the request rates used for hosted providers when
+// none is configured, in requests per second. They stay below the lowest
+// published quotas; local servers are not limited.
+var defaultRateLimits = map[string]float64{
+	"gemini": 1.5,
+	"openai": 50,
+}
+
+// withDefaults fills unset fields.
+func (o BatchOptions) withDefaults(provider string) BatchOptions {
+	d := DefaultBatchOptions()
+	if o.BatchSize <= 0 {
+		o.BatchSize = d.BatchSize
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = d.Concurrency
+	}
+	if o.RateLimit == 0 {
+		o.RateLimit = defaultRateLimits[strings.ToLower(provider)]
+	}
+	return o
+}
+
+// --- Rate Limiting ---
+
+// RateLimiter is a token bucket: it allows burst requests at once and refills
+// at rate requests per second. A nil RateLimiter does not limit.
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns a limiter allowing rate requests per second on
+// average and burst requests at once. A rate of 0 or less returns nil.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// Wait blocks until a request may be sent or ctx is done.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+		l.last = now
+		if l.tokens >= 1 {
+			l.tokens--
+			l.mu.Unlock()
+			return nil
+		}
+		wait := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+		l.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// providerLimiters holds one limiter per provider, shared by every adapter
+// of the process so that concurrent callers respect a single quota.
+var providerLimiters = struct {
+	sync.Mutex
+	byProvider map[string]*RateLimiter
+}{byProvider: make(map[string]*RateLimiter)}
+
+// limiterFor returns the shared limiter of a provider, adjusted to rate.
+func limiterFor(provider string, rate float64) *RateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	providerLimiters.Lock()
+	defer providerLimiters.Unlock()
+	provider = strings.ToLower(provider)
+	limiter := providerLimiters.byProvider[provider]
+	if limiter == nil {
+		limiter = NewRateLimiter(rate, max(1, int(rate)))
+		providerLimiters.byProvider[provider] = limiter
+	} else {
+		limiter.mu.Lock()
+		limiter.rate, limiter.burst = rate, float64(max(1, int(rate)))
+		limiter.mu.Unlock()
+	}
+	return limiter
+}
+
+// rateLimitedAdapter waits for its limiter before every request.
+type rateLimitedAdapter struct {
+	adapter EmbeddingAdapter
+	limiter *RateLimiter
+}
+
+func (a *rateLimitedAdapter) GenerateEmbedding(ctx context.Context, text string) ([]float64, error) {
+	if err := a.limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+	return a.adapter.GenerateEmbedding(ctx, text)
+}
+
+func (a *rateLimitedAdapter) GenerateEmbeddings(ctx context.Context, texts []string) ([][]float64, error) {
+	if _, ok := a.adapter.(BatchEmbeddingAdapter); !ok {
+		return embedOneByOne(ctx, a, texts) // One request, and one wait, per text
+	}
+	if err := a.limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+	return GenerateEmbeddings(ctx, a.adapter, texts)
+}
+
+// withRateLimit wraps adapter so that its requests respect the provider's
+// shared rate limit.
+func withRateLimit(adapter EmbeddingAdapter, opts EmbeddingOptions) EmbeddingAdapter {
+	limiter := limiterFor(opts.Provider, opts.Batch.RateLimit)
+	if limiter == nil {
+		return adapter
+	}
+	return &rateLimitedAdapter{adapter: adapter, limiter: limiter}
+}
+
+// --- Worker Pool ---
+
+// embedTexts embeds texts in batches on a bounded number of concurrent
+// workers. It returns the embeddings in the order of texts, with an error for
+// each text whose batch failed (nil otherwise).
+func embedTexts(ctx context.Context, adapter EmbeddingAdapter, texts []string, opts BatchOptions) ([][]float64, []error) {
+	embeddings := make([][]float64, len(texts))
+	errs := make([]error, len(texts))
+
+	batches := make(chan [2]int)
+	var wg sync.WaitGroup
+	for range min(opts.Concurrency, (len(texts)+opts.BatchSize-1)/opts.BatchSize) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for b := range batches {
+				batch, err := GenerateEmbeddings(ctx, adapter, texts[b[0]:b[1]])
+				if err == nil && len(batch) != b[1]-b[0] {
+					err = fmt.Errorf("expected %d embeddings, got %d", b[1]-b[0], len(batch))
+				}
+				for i := b[0]; i < b[1]; i++ {
+					if err != nil {
+						errs[i] = err
+					} else {
+						embeddings[i] = batch[i-b[0]]
+					}
+				}
+			}
+		}()
+	}
+	for start := 0; start < len(texts); start += opts.BatchSize {
+		batches <- [2]int{start, min(start+opts.BatchSize, len(texts))}
+	}
+	close(batches)
+	wg.Wait()
+	return embeddings, errs
+}
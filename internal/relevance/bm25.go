@@ -0,0 +1,365 @@
+package relevance
+
+import (
+	"container/heap"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Field is a part of a document that is scored separately by BM25F.
+type Field int
+
+const (
+	FieldPath     Field = iota // Directory and file name
+	FieldSymbols               // Declared names (functions, types, classes, ...)
+	FieldComments              // Comments and docstrings
+	FieldBody                  // Code outside comments
+	numFields
+)
+
+// BM25Params tunes the BM25F scoring.
+type BM25Params struct {
+	K1      float64            // Term frequency saturation
+	B       [numFields]float64 // Length normalization per field (0 = none, 1 = full)
+	Weights [numFields]float64 // Boost per field
+}
+
+// DefaultBM25Params favors matches in names (path and symbols) over matches
+// in comments and code.
+var DefaultBM25Params = BM25Params{
+	K1:      1.2,
+	B:       [numFields]float64{FieldPath: 0.3, FieldSymbols: 0.5, FieldComments: 0.75, FieldBody: 0.75},
+	Weights: [numFields]float64{FieldPath: 3.0, FieldSymbols: 2.5, FieldComments: 1.2, FieldBody: 1.0},
+}
+
+// Index is an inverted index of files for BM25F ranking. Files can be added
+// and removed at any time, so long-running callers (watch mode) can keep one
+// up to date instead of rebuilding it. An Index is not safe for concurrent use.
+type Index struct {
+	Params BM25Params
+
+	docs     map[string]*indexedDoc           // By path
+	postings map[string]map[string]*termFreqs // Term -> path -> frequencies
+	totalLen [numFields]int                   // Summed field lengths of all documents
+}
+
+// indexedDoc is the per-file data needed for scoring and removal.
+type indexedDoc struct {
+	length [numFields]int // Number of terms per field
+	terms  []string       // Distinct terms, for removal
+}
+
+// termFreqs counts the occurrences of a term in each field of a document.
+type termFreqs [numFields]int
+
+// Hit is a file matched by a search.
+type Hit struct {
+	Path  string
+	Score float64
+}
+
+// NewIndex returns an empty index using DefaultBM25Params.
+func NewIndex() *Index {
+	return &Index{
+		Params:   DefaultBM25Params,
+		docs:     make(map[string]*indexedDoc),
+		postings: make(map[string]map[string]*termFreqs),
+	}
+}
+
+// BuildIndex indexes the given files of fsys. Files that cannot be read are
+// reported as warnings and skipped.
+func BuildIndex(fsys fs.FS, paths []string) *Index {
+	ix := NewIndex()
+	for _, filePath := range paths {
+		content, err := fs.ReadFile(fsys, filepath.ToSlash(filePath))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Error indexing file %s: %v\n", filePath, err)
+			continue
+		}
+		ix.Add(filePath, content)
+	}
+	return ix
+}
+
+// Len returns the number of indexed files.
+func (ix *Index) Len() int {
+	return len(ix.docs)
+}
+
+// DocFreq returns the number of indexed files containing a term.
+func (ix *Index) DocFreq(term string) int {
+	return len(ix.postings[term])
+}
+
+// Contains reports whether a file is indexed.
+func (ix *Index) Contains(filePath string) bool {
+	_, ok := ix.docs[filePath]
+	return ok
+}
+
+// Add indexes a file, replacing any previous version of it.
+func (ix *Index) Add(filePath string, content []byte) {
+	ix.Remove(filePath)
+
+	doc := &indexedDoc{}
+	freqs := make(map[string]*termFreqs)
+	for field, terms := range extractFields(filePath, content) {
+		doc.length[field] = len(terms)
+		ix.totalLen[field] += len(terms)
+		for _, term := range terms {
+			tf, ok := freqs[term]
+			if !ok {
+				tf = &termFreqs{}
+				freqs[term] = tf
+				doc.terms = append(doc.terms, term)
+			}
+			tf[field]++
+		}
+	}
+
+	for term, tf := range freqs {
+		list, ok := ix.postings[term]
+		if !ok {
+			list = make(map[string]*termFreqs)
+			ix.postings[term] = list
+		}
+		list[filePath] = tf
+	}
+	ix.docs[filePath] = doc
+}
+
+// Remove drops a file from the index. Removing a file that is not indexed
+// does nothing.
+func (ix *Index) Remove(filePath string) {
+	doc, ok := ix.docs[filePath]
+	if !ok {
+		return
+	}
+	for _, term := range doc.terms {
+		delete(ix.postings[term], filePath)
+		if len(ix.postings[term]) == 0 {
+			delete(ix.postings, term)
+		}
+	}
+	for field := range doc.length {
+		ix.totalLen[field] -= doc.length[field]
+	}
+	delete(ix.docs, filePath)
+}
+
+// Scores returns the BM25F score of every file matching at least one of the
+// terms, each term counting by its weight. Only the posting lists of the
+// terms are visited.
+func (ix *Index) Scores(terms []QueryTerm) map[string]float64 {
+	scores := make(map[string]float64)
+	n := float64(len(ix.docs))
+	if n == 0 {
+		return scores
+	}
+
+	var avgLen [numFields]float64
+	for field := range avgLen {
+		avgLen[field] = math.Max(float64(ix.totalLen[field])/n, 1)
+	}
+
+	p := ix.Params
+	for _, term := range terms {
+		list := ix.postings[term.Term]
+		if len(list) == 0 {
+			continue
+		}
+		df := float64(len(list))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+
+		for filePath, tf := range list {
+			doc := ix.docs[filePath]
+
+			// BM25F: length-normalize and weight each field's frequency,
+			// then saturate the combined frequency once
+			var weighted float64
+			for field, count := range tf {
+				if count == 0 {
+					continue
+				}
+				norm := 1 - p.B[field] + p.B[field]*float64(doc.length[field])/avgLen[field]
+				weighted += p.Weights[field] * float64(count) / norm
+			}
+			scores[filePath] += term.Weight * idf * weighted * (p.K1 + 1) / (p.K1 + weighted)
+		}
+	}
+	return scores
+}
+
+// Search returns the k best matching files for the terms, best first, using
+// a bounded heap instead of sorting every match. A k of 0 or less returns all
+// matches.
+func (ix *Index) Search(terms []QueryTerm, k int) []Hit {
+	scores := ix.Scores(terms)
+	if k <= 0 || k > len(scores) {
+		k = len(scores)
+	}
+
+	h := make(hitHeap, 0, k)
+	for filePath, score := range scores {
+		hit := Hit{Path: filePath, Score: score}
+		if len(h) < k {
+			heap.Push(&h, hit)
+		} else if k > 0 && h.less(h[0], hit) {
+			h[0] = hit
+			heap.Fix(&h, 0)
+		}
+	}
+
+	hits := make([]Hit, len(h))
+	for i := len(hits) - 1; i >= 0; i-- {
+		hits[i] = heap.Pop(&h).(Hit)
+	}
+	return hits
+}
+
+// hitHeap is a min-heap of hits: the root is the worst hit kept so far.
+type hitHeap []Hit
+
+// less orders hits by score, breaking ties by path so results are stable.
+func (h hitHeap) less(a, b Hit) bool {
+	if a.Score != b.Score {
+		return a.Score < b.Score
+	}
+	return a.Path > b.Path
+}
+
+func (h hitHeap) Len() int           { return len(h) }
+func (h hitHeap) Less(i, j int) bool { return h.less(h[i], h[j]) }
+func (h hitHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *hitHeap) Push(x any)        { *h = append(*h, x.(Hit)) }
+func (h *hitHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// --- Field extraction ---
+
+// commentSyntax describes how a language marks comments.
+type commentSyntax struct {
+	line   []string    // Line comment markers
+	blocks [][2]string // Block comment start and end markers
+}
+
+var (
+	cStyleComments = commentSyntax{line: []string{"//"}, blocks: [][2]string{{"/*", "*/"}}}
+	hashComments   = commentSyntax{line: []string{"#"}}
+	pythonComments = commentSyntax{line: []string{"#"}, blocks: [][2]string{{`"""`, `"""`}, {"'''", "'''"}}}
+	dashComments   = commentSyntax{line: []string{"--"}, blocks: [][2]string{{"/*", "*/"}}}
+	markupComments = commentSyntax{blocks: [][2]string{{"<!--", "-->"}}}
+)
+
+// commentSyntaxByExt maps file extensions to their comment syntax; other
+// files use C-style comments.
+var commentSyntaxByExt = map[string]commentSyntax{
+	".py": pythonComments, ".rb": hashComments, ".sh": hashComments, ".bash": hashComments,
+	".zsh": hashComments, ".pl": hashComments, ".r": hashComments, ".yaml": hashComments,
+	".yml": hashComments, ".toml": hashComments, ".tf": hashComments, ".ps1": hashComments,
+	".ex": hashComments, ".exs": hashComments, ".cmake": hashComments, ".jl": hashComments,
+	".sql": dashComments, ".lua": dashComments, ".hs": dashComments,
+	".html": markupComments, ".xml": markupComments, ".md": markupComments, ".vue": markupComments,
+}
+
+// declarationPatterns capture the names introduced by common declarations.
+var declarationPatterns = []*regexp.Regexp{
+	// func Name, func (r *T) Name, def name, class Name, fn name, type Name, ...
+	regexp.MustCompile(`\b(?:func|function|def|class|struct|interface|enum|trait|fn|type|module|object|record|protocol|impl|namespace)\s+(?:\([^)]*\)\s*)?([A-Za-z_$][\w$]*)`),
+	// const name = ..., let name = ..., var name = ... (JavaScript/TypeScript/Go)
+	regexp.MustCompile(`\b(?:const|let|var|val)\s+([A-Za-z_$][\w$]*)\s*(?:[:=]|$)`),
+	// Java/C#/Kotlin style methods: modifiers, a return type and a name
+	regexp.MustCompile(`\b(?:public|private|protected|internal|static|override|async)\s+(?:[\w<>\[\],.?]+\s+)*([A-Za-z_]\w*)\s*\(`),
+}
+
+// extractFields splits a file into the terms of each field.
+func extractFields(filePath string, content []byte) [numFields][]string {
+	var fields [numFields][]string
+	fields[FieldPath] = Tokenize(filePath)
+
+	syntax, ok := commentSyntaxByExt[strings.ToLower(path.Ext(filepath.ToSlash(filePath)))]
+	if !ok {
+		syntax = cStyleComments
+	}
+
+	blockEnd := "" // Set while inside a block comment
+	for _, line := range strings.Split(string(content), "\n") {
+		var code, comment strings.Builder
+		rest := line
+		for rest != "" {
+			if blockEnd != "" {
+				i := strings.Index(rest, blockEnd)
+				if i < 0 {
+					comment.WriteString(rest)
+					break
+				}
+				comment.WriteString(rest[:i])
+				rest = rest[i+len(blockEnd):]
+				blockEnd = ""
+				continue
+			}
+
+			pos, marker, end := nextComment(rest, syntax)
+			if pos < 0 {
+				code.WriteString(rest)
+				break
+			}
+			code.WriteString(rest[:pos])
+			if end == "" {
+				comment.WriteString(rest[pos+len(marker):])
+				break
+			}
+			blockEnd = end
+			rest = rest[pos+len(marker):]
+		}
+
+		codeText := code.String()
+		fields[FieldBody] = append(fields[FieldBody], Tokenize(codeText)...)
+		fields[FieldComments] = append(fields[FieldComments], Tokenize(comment.String())...)
+		for _, pattern := range declarationPatterns {
+			for _, m := range pattern.FindAllStringSubmatch(codeText, -1) {
+				fields[FieldSymbols] = append(fields[FieldSymbols], Tokenize(m[1])...)
+			}
+		}
+	}
+	return fields
+}
+
+// nextComment finds the first comment marker in s. It returns the position,
+// the marker and, for block comments, the end marker.
+func nextComment(s string, syntax commentSyntax) (int, string, string) {
+	pos, marker, end := -1, "", ""
+	consider := func(i int, m, e string) {
+		if i >= 0 && (pos < 0 || i < pos) {
+			pos, marker, end = i, m, e
+		}
+	}
+	for _, m := range syntax.line {
+		i := strings.Index(s, m)
+		// "//" right after a colon is most likely a URL, not a comment
+		for i > 0 && m == "//" && s[i-1] == ':' {
+			next := strings.Index(s[i+2:], m)
+			if next < 0 {
+				i = -1
+				break
+			}
+			i += 2 + next
+		}
+		consider(i, m, "")
+	}
+	for _, b := range syntax.blocks {
+		consider(strings.Index(s, b[0]), b[0], b[1])
+	}
+	return pos, marker, end
+}
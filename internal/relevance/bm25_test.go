@@ -0,0 +1,143 @@
+package relevance
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// terms returns unweighted query terms for words.
+func terms(words ...string) []QueryTerm {
+	var result []QueryTerm
+	for _, word := range words {
+		for _, term := range Tokenize(word) {
+			result = append(result, QueryTerm{Term: term, Word: word, Weight: 1})
+		}
+	}
+	return result
+}
+
+// hitPaths returns the paths of hits, in order.
+func hitPaths(hits []Hit) []string {
+	var paths []string
+	for _, h := range hits {
+		paths = append(paths, h.Path)
+	}
+	return paths
+}
+
+func TestIndexAddRemoveBookkeeping(t *testing.T) {
+	files := map[string]string{
+		"a.go": "package a\n// cache entries\nfunc Get() {}\n",
+		"b.go": "package b\nfunc Put(cache string) {}\n",
+		"c.py": "def load():\n    pass  # cache\n",
+	}
+	ix := NewIndex()
+	for _, name := range []string{"a.go", "b.go", "c.py"} {
+		ix.Add(name, []byte(files[name]))
+	}
+
+	// Removing and adding files back in another order, or re-adding one,
+	// leaves the same index as building it at once
+	ix.Remove("b.go")
+	ix.Remove("missing.go")
+	ix.Add("a.go", []byte(files["a.go"]))
+	ix.Add("b.go", []byte(files["b.go"]))
+	rebuilt := NewIndex()
+	for _, name := range []string{"b.go", "c.py", "a.go"} {
+		rebuilt.Add(name, []byte(files[name]))
+	}
+	if ix.totalLen != rebuilt.totalLen {
+		t.Errorf("totalLen = %v, want %v", ix.totalLen, rebuilt.totalLen)
+	}
+	if !reflect.DeepEqual(ix.postings, rebuilt.postings) {
+		t.Errorf("postings differ from a rebuilt index")
+	}
+	if ix.Len() != 3 || ix.DocFreq("cach") != 3 {
+		t.Errorf("Len, DocFreq(cach) = %d, %d, want 3, 3", ix.Len(), ix.DocFreq("cach"))
+	}
+
+	// Replacing a file drops its old terms
+	ix.Add("b.go", []byte("package b\n"))
+	if got := ix.DocFreq("cach"); got != 2 {
+		t.Errorf("DocFreq(cach) = %d after replacing b.go, want 2", got)
+	}
+	if _, ok := ix.postings["put"]; ok {
+		t.Error("term only in the old b.go still has postings")
+	}
+
+	// Removing every file leaves nothing behind
+	for _, name := range []string{"a.go", "b.go", "c.py"} {
+		ix.Remove(name)
+	}
+	if ix.Len() != 0 || len(ix.postings) != 0 || ix.totalLen != [numFields]int{} {
+		t.Errorf("index not empty: %d docs, %d postings, totalLen %v", ix.Len(), len(ix.postings), ix.totalLen)
+	}
+	if scores := ix.Scores(terms("cache")); len(scores) != 0 {
+		t.Errorf("empty index scored %v", scores)
+	}
+}
+
+func TestIndexSearchOrder(t *testing.T) {
+	ix := NewIndex()
+	// Identical contents under different paths score the same
+	for _, name := range []string{"d.go", "b.go", "a.go", "c.go"} {
+		ix.Add("pkg/"+name, []byte("package pkg\n// token storage\n"))
+	}
+	ix.Add("token/token.go", []byte("package token\n// token token token\nfunc Token() {}\n"))
+	ix.Add("other.go", []byte("package other\n"))
+
+	all := ix.Search(terms("token"), 0)
+	want := []string{"token/token.go", "pkg/a.go", "pkg/b.go", "pkg/c.go", "pkg/d.go"}
+	if got := hitPaths(all); !reflect.DeepEqual(got, want) {
+		t.Errorf("Search = %v, want %v", got, want)
+	}
+	for i := 1; i < len(all); i++ {
+		if all[i].Score > all[i-1].Score {
+			t.Errorf("hits not sorted by score at %d: %v", i, all)
+		}
+	}
+
+	// The top k are the first k of the full ranking, ties included
+	for k := 1; k <= len(want)+1; k++ {
+		got := hitPaths(ix.Search(terms("token"), k))
+		if n := min(k, len(want)); !reflect.DeepEqual(got, want[:n]) {
+			t.Errorf("Search(k=%d) = %v, want %v", k, got, want[:n])
+		}
+	}
+	if hits := ix.Search(terms("absent"), 5); len(hits) != 0 {
+		t.Errorf("Search for an absent term = %v", hits)
+	}
+}
+
+func TestIndexRanksNamesAboveBody(t *testing.T) {
+	ix := NewIndex()
+	ix.Add("auth/session.go", []byte("package auth\n\nfunc Start() {}\n"))
+	ix.Add("store/store.go", []byte("package store\n\nfunc NewSession() {}\n"))
+	ix.Add("http/handler.go", []byte("package http\n\nfunc Handle() {\n\tx := session\n\t_ = x\n}\n"))
+	for i := range 6 {
+		// Unrelated files keep the term rare enough to matter
+		ix.Add(fmt.Sprintf("misc/file%d.go", i), []byte("package misc\n\nfunc Do() {}\n"))
+	}
+
+	got := hitPaths(ix.Search(terms("session"), 0))
+	want := []string{"auth/session.go", "store/store.go", "http/handler.go"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Search = %v, want path, then symbol, then body matches: %v", got, want)
+	}
+}
+
+func TestIndexScoresWeightTerms(t *testing.T) {
+	ix := NewIndex()
+	ix.Add("a.go", []byte("package a\n// login\n"))
+	ix.Add("b.go", []byte("package b\n// session\n"))
+	ix.Add("c.go", []byte("package c\n"))
+
+	scores := ix.Scores([]QueryTerm{{Term: "login", Weight: 1}, {Term: "session", Weight: SynonymWeight}})
+	if len(scores) != 2 {
+		t.Fatalf("Scores = %v, want the two matching files", scores)
+	}
+	if got := scores["b.go"] / scores["a.go"]; got < SynonymWeight-1e-9 || got > SynonymWeight+1e-9 {
+		t.Errorf("synonym score ratio = %v, want %v", got, SynonymWeight)
+	}
+}
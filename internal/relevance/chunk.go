@@ -0,0 +1,232 @@
+package relevance
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Chunk is a part of a file that is embedded on its own.
+type Chunk struct {
+	Path      string
+	StartLine int    // First line, 1-based
+	EndLine   int    // Last line, inclusive
+	Text      string // Text to embed: the file path followed by the lines
+}
+
+// LineRange is a range of lines of a file and how well it matched a query.
+type LineRange struct {
+	Start int     `json:"start"` // First line, 1-based
+	End   int     `json:"end"`   // Last line, inclusive
+	Score float64 `json:"score"` // Similarity of the range to the query
+}
+
+// String formats the range as "L12-L40".
+func (r LineRange) String() string {
+	return fmt.Sprintf("L%d-L%d", r.Start, r.End)
+}
+
+// ChunkOptions controls how files are split for embedding and how chunk
+// scores are combined into a file score.
+type ChunkOptions struct {
+	MaxLines  int    // Maximum lines per chunk
+	Overlap   int    // Lines shared by consecutive windows when a block has to be cut
+	MaxChunks int    // Chunks embedded per file; later chunks are skipped
+	Aggregate string // File score from chunk scores: "max" or "topk" (mean of the TopK best)
+	TopK      int    // Chunks averaged by the "topk" aggregation
+}
+
+// DefaultChunkOptions returns the default chunking settings.
+func DefaultChunkOptions() ChunkOptions {
+	return ChunkOptions{MaxLines: 60, Overlap: 10, MaxChunks: 64, Aggregate: "max", TopK: 3}
+}
+
+// withDefaults fills unset fields from DefaultChunkOptions. The zero value
+// stands for the defaults as a whole; otherwise an Overlap of 0 is kept.
+func (o ChunkOptions) withDefaults() ChunkOptions {
+	d := DefaultChunkOptions()
+	if o == (ChunkOptions{}) {
+		return d
+	}
+	if o.MaxLines <= 0 {
+		o.MaxLines = d.MaxLines
+	}
+	if o.Overlap < 0 || o.Overlap >= o.MaxLines {
+		o.Overlap = 0
+	}
+	if o.MaxChunks <= 0 {
+		o.MaxChunks = d.MaxChunks
+	}
+	if o.Aggregate == "" {
+		o.Aggregate = d.Aggregate
+	}
+	if o.TopK <= 0 {
+		o.TopK = d.TopK
+	}
+	return o
+}
+
+// CacheKey describes the settings that shape chunk texts, for embedding
+// cache keys. The aggregation does not change the vectors and is left out.
+func (o ChunkOptions) CacheKey() string {
+	return fmt.Sprintf("chunks:v1:lines=%d:overlap=%d", o.MaxLines, o.Overlap)
+}
+
+// chunkBoundary matches lines that start a declaration: functions, methods,
+// classes and types in the common languages, after optional modifiers.
+var chunkBoundary = regexp.MustCompile(`^(?:export\s+(?:default\s+)?)?` +
+	`(?:(?:public|private|protected|internal|static|abstract|final|override|async|sealed|partial|virtual|unsafe|pub(?:\([^)]*\))?)\s+)*` +
+	`(?:func|function|def|class|struct|interface|enum|trait|fn|type|impl|module|object|record|namespace)\b`)
+
+// modifiedMethod matches Java/C# style methods, which need at least one
+// modifier to tell them from statements ("return foo(").
+var modifiedMethod = regexp.MustCompile(`^(?:@\w+\s+)*(?:(?:public|private|protected|internal|static|abstract|final|override|async|synchronized|virtual)\s+)+[\w<>\[\],.?]+\s+\w+\s*\(`)
+
+// arrowFunction matches JavaScript/TypeScript functions bound to constants.
+var arrowFunction = regexp.MustCompile(`^(?:export\s+)?(?:const|let)\s+\w+\s*(?::[^=]+)?=\s*(?:async\s*)?(?:\([^)]*\)|\w+)\s*=>`)
+
+// isBoundary reports whether a trimmed line starts a declaration.
+func isBoundary(trimmed string) bool {
+	return chunkBoundary.MatchString(trimmed) || modifiedMethod.MatchString(trimmed) || arrowFunction.MatchString(trimmed)
+}
+
+// isLeadingLine reports whether a trimmed line belongs to the declaration
+// below it: doc comments, decorators and attributes.
+func isLeadingLine(trimmed string) bool {
+	for _, prefix := range []string{"//", "#", "/*", "*", "@", "["} {
+		if strings.HasPrefix(trimmed, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ChunkFile splits a file into chunks along declaration boundaries. Blocks
+// longer than MaxLines are split at the declarations nested in them (methods
+// of a class), and cut into overlapping line windows when there are none.
+// Small neighbouring blocks are merged up to MaxLines.
+func ChunkFile(filePath string, content string, opts ChunkOptions) []Chunk {
+	opts = opts.withDefaults()
+	lines := strings.Split(strings.TrimRight(content, "\n"), "\n")
+	if len(lines) == 1 && strings.TrimSpace(lines[0]) == "" {
+		return nil
+	}
+
+	var ranges [][2]int // Half-open line index ranges
+	var split func(start, end int)
+	split = func(start, end int) {
+		if end-start <= opts.MaxLines {
+			ranges = append(ranges, [2]int{start, end})
+			return
+		}
+
+		// Find the outermost declarations inside the block, after the
+		// comments and the declaration the block itself starts with
+		first := start
+		for first < end-1 && isLeadingLine(strings.TrimSpace(lines[first])) {
+			first++
+		}
+		minIndent := -1
+		var boundaries []int
+		for i := first + 1; i < end; i++ {
+			trimmed := strings.TrimLeft(lines[i], " \t")
+			if !isBoundary(trimmed) {
+				continue
+			}
+			indent := len(lines[i]) - len(trimmed)
+			switch {
+			case minIndent < 0 || indent < minIndent:
+				minIndent = indent
+				boundaries = []int{i}
+			case indent == minIndent:
+				boundaries = append(boundaries, i)
+			}
+		}
+		if len(boundaries) == 0 {
+			for s := start; s < end; s += opts.MaxLines - opts.Overlap {
+				e := s + opts.MaxLines
+				if e >= end {
+					ranges = append(ranges, [2]int{s, end})
+					break
+				}
+				ranges = append(ranges, [2]int{s, e})
+			}
+			return
+		}
+
+		// Comments and decorators stay with their declaration
+		for i, b := range boundaries {
+			floor := start + 1
+			if i > 0 {
+				floor = boundaries[i-1] + 1
+			}
+			for b > floor && isLeadingLine(strings.TrimSpace(lines[b-1])) {
+				b--
+			}
+			boundaries[i] = b
+		}
+
+		prev := start
+		for _, b := range append(boundaries, end) {
+			if b > prev {
+				split(prev, b)
+			}
+			prev = b
+		}
+	}
+	split(0, len(lines))
+
+	// Merge small neighbours; windows cut from one block are never merged
+	var merged [][2]int
+	for _, r := range ranges {
+		if n := len(merged); n > 0 && merged[n-1][1] == r[0] && r[1]-merged[n-1][0] <= opts.MaxLines {
+			merged[n-1][1] = r[1]
+			continue
+		}
+		merged = append(merged, r)
+	}
+
+	var chunks []Chunk
+	for _, r := range merged {
+		text := strings.Join(lines[r[0]:r[1]], "\n")
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		chunks = append(chunks, Chunk{
+			Path:      filePath,
+			StartLine: r[0] + 1,
+			EndLine:   r[1],
+			Text:      filePath + "\n" + text,
+		})
+		if len(chunks) == opts.MaxChunks {
+			break
+		}
+	}
+	return chunks
+}
+
+// aggregateChunkScores turns the scores of a file's chunks into a file score
+// and returns the best matching ranges, best first (at most TopK).
+func aggregateChunkScores(ranges []LineRange, opts ChunkOptions) (float64, []LineRange) {
+	opts = opts.withDefaults()
+	if len(ranges) == 0 {
+		return 0, nil
+	}
+
+	ranked := append([]LineRange(nil), ranges...)
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].Score > ranked[j].Score })
+	if len(ranked) > opts.TopK {
+		ranked = ranked[:opts.TopK]
+	}
+
+	score := ranked[0].Score
+	if opts.Aggregate == "topk" {
+		var sum float64
+		for _, r := range ranked {
+			sum += r.Score
+		}
+		score = sum / float64(len(ranked))
+	}
+	return score, ranked
+}
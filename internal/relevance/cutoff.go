@@ -0,0 +1,154 @@
+package relevance
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+)
+
+// CutoffOptions selects how many of the ranked files make it into the report.
+type CutoffOptions struct {
+	// Strategy is "fixed" (always MaxFiles), "threshold" (files scoring at
+	// least Score), "elbow" (cut at the largest drop between consecutive
+	// scores), "relative" (files scoring at least Ratio times the best score)
+	// or "tokens" (files fitting in TokenBudget).
+	Strategy    string
+	MinFiles    int     // Files kept whatever their score, when there are that many, up to MaxFiles (0 = none)
+	MaxFiles    int     // Files kept at most (0 = 20, or no limit for "tokens")
+	Score       float64 // Lowest score kept by "threshold"
+	Ratio       float64 // Share of the best score kept by "relative" (0 = 0.5)
+	TokenBudget int     // Estimated tokens of file content kept by "tokens" (0 = 32000)
+}
+
+// DefaultCutoffOptions returns the default cutoff settings: the best 20 files.
+func DefaultCutoffOptions() CutoffOptions {
+	return CutoffOptions{Strategy: "fixed", MinFiles: 3, MaxFiles: 20, Score: 0.5, Ratio: 0.5, TokenBudget: 32000}
+}
+
+// withDefaults fills unset fields from DefaultCutoffOptions. MinFiles 0 and
+// Score 0 are kept, and so is MaxFiles 0 for "tokens".
+func (o CutoffOptions) withDefaults() CutoffOptions {
+	d := DefaultCutoffOptions()
+	if o.Strategy == "" {
+		o.Strategy = d.Strategy
+	}
+	if o.MaxFiles <= 0 && o.Strategy != "tokens" {
+		o.MaxFiles = d.MaxFiles
+	}
+	if o.Ratio <= 0 {
+		o.Ratio = d.Ratio
+	}
+	if o.TokenBudget <= 0 {
+		o.TokenBudget = d.TokenBudget
+	}
+	return o
+}
+
+// Validate reports unknown strategies and settings out of range. A MinFiles
+// above MaxFiles is not an error; MaxFiles wins.
+func (o CutoffOptions) Validate() error {
+	o = o.withDefaults()
+	switch o.Strategy {
+	case "fixed", "threshold", "elbow", "relative", "tokens":
+	default:
+		return fmt.Errorf("unknown cutoff strategy %q (expected 'fixed', 'threshold', 'elbow', 'relative' or 'tokens')", o.Strategy)
+	}
+	if o.MinFiles < 0 {
+		return fmt.Errorf("minimum number of files %d must not be negative", o.MinFiles)
+	}
+	if o.Ratio > 1 {
+		return fmt.Errorf("cutoff ratio %g must be at most 1", o.Ratio)
+	}
+	return nil
+}
+
+// String describes the cutoff for logs, e.g. "elbow, 3-20 files".
+func (o CutoffOptions) String() string {
+	o = o.withDefaults()
+	switch o.Strategy {
+	case "fixed":
+		return fmt.Sprintf("fixed, %d files", o.MaxFiles)
+	case "threshold":
+		return fmt.Sprintf("score >= %g, %d-%d files", o.Score, o.MinFiles, o.MaxFiles)
+	case "relative":
+		return fmt.Sprintf("score >= %g x best, %d-%d files", o.Ratio, o.MinFiles, o.MaxFiles)
+	case "tokens":
+		if o.MaxFiles <= 0 {
+			return fmt.Sprintf("%d tokens, at least %d files", o.TokenBudget, o.MinFiles)
+		}
+		return fmt.Sprintf("%d tokens, %d-%d files", o.TokenBudget, o.MinFiles, o.MaxFiles)
+	default:
+		return fmt.Sprintf("%s, %d-%d files", o.Strategy, o.MinFiles, o.MaxFiles)
+	}
+}
+
+// bytesPerToken is the rough size of a token in source code, used to
+// estimate how much of the LLM context a file takes.
+const bytesPerToken = 4
+
+// SelectFiles keeps the first files of a ranking, best first, that the
+// cutoff strategy accepts: never more than MaxFiles, if set, and when there are
+// enough files, never fewer than MinFiles. The files are taken in order, so
+// the selection is always a prefix of the ranking. File sizes for "tokens"
+// come from the walker metadata, or from fsys.
+func SelectFiles(fsys fs.FS, files []FileInfo, opts CutoffOptions) []FileInfo {
+	opts = opts.withDefaults()
+	limit := len(files)
+	if opts.MaxFiles > 0 {
+		limit = min(opts.MaxFiles, limit)
+	}
+	floor := min(opts.MinFiles, limit)
+
+	n := limit
+	switch opts.Strategy {
+	case "threshold":
+		n = firstRejected(files, floor, limit, func(file FileInfo) bool { return file.Score >= opts.Score })
+
+	case "relative":
+		var best float64
+		for _, file := range files {
+			best = max(best, file.Score)
+		}
+		n = firstRejected(files, floor, limit, func(file FileInfo) bool { return file.Score >= opts.Ratio*best })
+
+	case "elbow":
+		// Cut where the score drops the most, between files floor and limit;
+		// when every file scores the same there is no elbow
+		var largestDrop float64
+		for i := max(floor, 1); i < limit; i++ {
+			if drop := files[i-1].Score - files[i].Score; drop > largestDrop {
+				largestDrop, n = drop, i
+			}
+		}
+
+	case "tokens":
+		tokens := 0
+		n = firstRejected(files, floor, limit, func(file FileInfo) bool {
+			tokens += (fileSize(fsys, file) + bytesPerToken - 1) / bytesPerToken
+			return tokens <= opts.TokenBudget
+		})
+	}
+	return files[:n]
+}
+
+// firstRejected returns the position of the first file from floor on that
+// keep rejects, or limit. keep sees every file in order.
+func firstRejected(files []FileInfo, floor int, limit int, keep func(FileInfo) bool) int {
+	for i, file := range files[:limit] {
+		if !keep(file) && i >= floor {
+			return i
+		}
+	}
+	return limit
+}
+
+// fileSize returns the size of a file in bytes, or 0 when it is unknown.
+func fileSize(fsys fs.FS, file FileInfo) int {
+	if file.Meta.Size > 0 {
+		return int(file.Meta.Size)
+	}
+	if info, err := fs.Stat(fsys, filepath.ToSlash(file.Path)); err == nil {
+		return int(info.Size())
+	}
+	return 0
+}
@@ -1,23 +1,29 @@
 package relevance
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/fs"
 	"math"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
-	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"google.golang.org/api/option"
 
 	"github.com/google/generative-ai-go/genai"
+	"github.com/waqasraz/code-context/internal/embedcache"
+	"github.com/waqasraz/code-context/internal/vectorindex"
+	"github.com/waqasraz/code-context/internal/walker"
 )
 
 // --- Embedding Provider Abstraction ---
@@ -32,11 +38,26 @@ type EmbeddingOptions struct {
 	Provider        string   // The embedding provider (e.g., "ollama", "gemini")
 	Query           string   // The user query
 	TargetPath      string   // The root path of the search
+	FS              fs.FS    // Files to read (nil reads from TargetPath on disk)
 	CandidateFiles  []string // Potential files to analyze
 	MaxFilesToCheck int      // Maximum number of files to return
 	Model           string   // The embedding model to use
 	Endpoint        string   // The endpoint URL (for Ollama/HTTP-based providers)
 	APIKey          string   // API Key (for Gemini, OpenAI, etc.) - can be different from LLM API key
+
+	CandidateMeta     map[string]walker.Metadata // Optional walker metadata by candidate path
+	CandidateModules  map[string]string          // Optional owning module path by candidate path
+	MaxFilesPerModule int                        // Maximum number of files to return per module (0 = no limit)
+	Index             *Index                     // Optional lexical index holding the candidates, for the hybrid keyword score
+	Cache             *embedcache.Cache          // Optional on-disk cache of embeddings (nil embeds everything every run)
+	Chunking          ChunkOptions               // How files are split into embedded chunks (zero values use DefaultChunkOptions)
+	Vectors           *vectorindex.Index         // Optional vector index kept open by the caller (nil loads it from the cache, or builds one in memory)
+	Dimensions        int                        // Requested embedding size, for models that can shorten vectors (0 = model default)
+	Headers           map[string]string          // Additional HTTP headers for HTTP-based providers (OpenAI-compatible)
+	Batch             BatchOptions               // Batch size, concurrency and rate limit of embedding requests
+	Fusion            FusionOptions              // How the hybrid approach combines its signals (zero values use DefaultFusionOptions)
+	Analyzer          *Analyzer                  // Turns the query into search terms for the keyword and path scores and local-lite (nil = DefaultAnalyzer)
+	RequireEmbeddings bool                       // Fail the hybrid approach on embedding errors instead of falling back to keyword and path scores
 }
 
 // DefaultEmbeddingOptions returns default configuration values.
@@ -55,6 +76,8 @@ func DefaultEmbeddingOptions() EmbeddingOptions {
 type OllamaEmbeddingAdapter struct {
 	Model    string
 	Endpoint string
+
+	noBatch atomic.Bool // Set when the server turned out not to support /api/embed
 }
 
 // ollamaEmbeddingRequest represents the request body for the Ollama embedding API
@@ -68,6 +91,17 @@ type ollamaEmbeddingResponse struct {
 	Embedding []float64 `json:"embedding"`
 }
 
+// ollamaBatchRequest represents the request body for the Ollama /api/embed API
+type ollamaBatchRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+// ollamaBatchResponse represents the response from the Ollama /api/embed API
+type ollamaBatchResponse struct {
+	Embeddings [][]float64 `json:"embeddings"`
+}
+
 // GenerateEmbedding fetches embedding from an Ollama-like endpoint.
 func (a *OllamaEmbeddingAdapter) GenerateEmbedding(ctx context.Context, text string) ([]float64, error) {
 	if a.Endpoint == "" {
@@ -112,6 +146,65 @@ func (a *OllamaEmbeddingAdapter) GenerateEmbedding(ctx context.Context, text str
 	return embeddingResp.Embedding, nil
 }
 
+// batchEndpoint returns the URL of Ollama's /api/embed API, which embeds
+// several texts per request, or "" when Endpoint is not an Ollama URL.
+func (a *OllamaEmbeddingAdapter) batchEndpoint() string {
+	switch {
+	case strings.HasSuffix(a.Endpoint, "/api/embeddings"):
+		return strings.TrimSuffix(a.Endpoint, "/api/embeddings") + "/api/embed"
+	case strings.HasSuffix(a.Endpoint, "/api/embed"):
+		return a.Endpoint
+	}
+	return ""
+}
+
+// GenerateEmbeddings fetches the embeddings of several texts with one
+// request to /api/embed. Servers without that API (Ollama before 0.3 and
+// other endpoints) get one request per text.
+func (a *OllamaEmbeddingAdapter) GenerateEmbeddings(ctx context.Context, texts []string) ([][]float64, error) {
+	endpoint := a.batchEndpoint()
+	if endpoint == "" || a.noBatch.Load() {
+		return embedOneByOne(ctx, a, texts)
+	}
+
+	reqJSON, err := json.Marshal(ollamaBatchRequest{Model: a.Model, Input: texts})
+	if err != nil {
+		return nil, fmt.Errorf("ollama: error marshaling request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(reqJSON))
+	if err != nil {
+		return nil, fmt.Errorf("ollama: error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ollama: error making API request to %s: %w", endpoint, err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("ollama: error reading response from %s: %w", endpoint, err)
+	}
+
+	if resp.StatusCode == http.StatusNotFound && a.batchEndpoint() != a.Endpoint {
+		a.noBatch.Store(true) // Older server: remember and embed one text at a time
+		return embedOneByOne(ctx, a, texts)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ollama: API at %s returned status %d: %s", endpoint, resp.StatusCode, string(respBody))
+	}
+
+	var batchResp ollamaBatchResponse
+	if err := json.Unmarshal(respBody, &batchResp); err != nil {
+		return nil, fmt.Errorf("ollama: error parsing response from %s: %w", endpoint, err)
+	}
+	if len(batchResp.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("ollama: expected %d embeddings from %s, got %d", len(texts), endpoint, len(batchResp.Embeddings))
+	}
+	return batchResp.Embeddings, nil
+}
+
 // --- Gemini Adapter ---
 
 // GeminiEmbeddingAdapter uses the Google AI Go SDK.
@@ -196,6 +289,343 @@ func (a *GeminiEmbeddingAdapter) GenerateEmbedding(ctx context.Context, text str
 	return nil, fmt.Errorf("gemini: exhausted retries (%d attempts): %w", maxRetries, lastErr)
 }
 
+// geminiBatchLimit is the maximum number of texts per batch request.
+const geminiBatchLimit = 100
+
+// GenerateEmbeddings fetches the embeddings of several texts with batch
+// requests of up to 100 texts.
+func (a *GeminiEmbeddingAdapter) GenerateEmbeddings(ctx context.Context, texts []string) ([][]float64, error) {
+	if a.APIKey == "" {
+		return nil, fmt.Errorf("gemini: API key is required")
+	}
+	client, err := genai.NewClient(ctx, option.WithAPIKey(a.APIKey))
+	if err != nil {
+		return nil, fmt.Errorf("gemini: error creating client for embedding: %w", err)
+	}
+	defer client.Close()
+	em := client.EmbeddingModel(a.Model)
+
+	embeddings := make([][]float64, 0, len(texts))
+	for start := 0; start < len(texts); start += geminiBatchLimit {
+		chunk := texts[start:min(start+geminiBatchLimit, len(texts))]
+		batch := em.NewBatch()
+		for _, text := range chunk {
+			batch.AddContent(genai.Text(text))
+		}
+		var res *genai.BatchEmbedContentsResponse
+		for attempt := 1; ; attempt++ {
+			res, err = em.BatchEmbedContents(ctx, batch)
+			if err == nil {
+				break
+			}
+			// Retry rate limit errors a few times with exponential backoff
+			rateLimited := strings.Contains(err.Error(), "429") || strings.Contains(err.Error(), "rate") ||
+				strings.Contains(err.Error(), "Resource has been exhausted")
+			if !rateLimited || attempt == 4 {
+				return nil, fmt.Errorf("gemini: error getting batch embeddings: %w", err)
+			}
+			backoff := time.Duration(1<<(attempt-1)) * time.Second // 1s, 2s, 4s
+			fmt.Printf("Gemini embedding rate limit hit. Retrying batch (attempt %d/4) after %.1f second delay...\n", attempt+1, backoff.Seconds())
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(backoff):
+			}
+		}
+		if res == nil || len(res.Embeddings) != len(chunk) {
+			return nil, fmt.Errorf("gemini: unexpected number of batch embeddings")
+		}
+		for _, e := range res.Embeddings {
+			values := make([]float64, len(e.Values))
+			for i, v := range e.Values {
+				values[i] = float64(v)
+			}
+			embeddings = append(embeddings, values)
+		}
+	}
+	return embeddings, nil
+}
+
+// --- OpenAI Adapter ---
+
+// DefaultOpenAIBaseURL is the base URL of the OpenAI API.
+const DefaultOpenAIBaseURL = "https://api.openai.com/v1"
+
+// OpenAIEmbeddingAdapter uses the OpenAI /v1/embeddings API. Any server
+// implementing it can be used through BaseURL and Headers: vLLM, LM Studio,
+// LiteLLM or an Azure-style gateway.
+type OpenAIEmbeddingAdapter struct {
+	Model      string
+	APIKey     string            // Sent as a bearer token, unless Headers set "Authorization" or "api-key"
+	BaseURL    string            // API base URL (e.g. "http://localhost:8000/v1") or full embeddings URL; empty uses DefaultOpenAIBaseURL
+	Dimensions int               // Requested vector size (0 = model default)
+	Headers    map[string]string // Additional request headers
+	BatchSize  int               // Maximum texts per request (0 = 256)
+	Client     *http.Client      // HTTP client (nil uses one with a 60 second timeout)
+}
+
+// openAIEmbeddingRequest represents the request body for the OpenAI embedding API
+type openAIEmbeddingRequest struct {
+	Model          string   `json:"model"`
+	Input          []string `json:"input"`
+	Dimensions     int      `json:"dimensions,omitempty"`
+	EncodingFormat string   `json:"encoding_format"`
+}
+
+// openAIEmbeddingResponse represents the response from the OpenAI embedding API
+type openAIEmbeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float64 `json:"embedding"`
+	} `json:"data"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// GenerateEmbedding fetches the embedding of a single text.
+func (a *OpenAIEmbeddingAdapter) GenerateEmbedding(ctx context.Context, text string) ([]float64, error) {
+	embeddings, err := a.GenerateEmbeddings(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return embeddings[0], nil
+}
+
+// GenerateEmbeddings fetches the embeddings of several texts, in requests of
+// at most BatchSize texts. The result is in the order of texts.
+func (a *OpenAIEmbeddingAdapter) GenerateEmbeddings(ctx context.Context, texts []string) ([][]float64, error) {
+	batchSize := a.BatchSize
+	if batchSize <= 0 {
+		batchSize = 256
+	}
+	embeddings := make([][]float64, 0, len(texts))
+	for start := 0; start < len(texts); start += batchSize {
+		batch, err := a.embedBatch(ctx, texts[start:min(start+batchSize, len(texts))])
+		if err != nil {
+			return nil, err
+		}
+		embeddings = append(embeddings, batch...)
+	}
+	return embeddings, nil
+}
+
+// embeddingsURL returns the URL of the embeddings endpoint. A base URL that
+// already ends in "/embeddings" (as Azure deployment URLs do) is used as is;
+// its query string (e.g. "api-version") is kept either way.
+func (a *OpenAIEmbeddingAdapter) embeddingsURL() (string, error) {
+	base := a.BaseURL
+	if base == "" {
+		base = DefaultOpenAIBaseURL
+	}
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", fmt.Errorf("openai: invalid base URL %q: %w", base, err)
+	}
+	if !strings.HasSuffix(u.Path, "/embeddings") {
+		u.Path = strings.TrimRight(u.Path, "/") + "/embeddings"
+	}
+	return u.String(), nil
+}
+
+// embedBatch sends one request. Rate limit (429) and server errors are
+// retried a few times, honoring Retry-After when the server sends it.
+func (a *OpenAIEmbeddingAdapter) embedBatch(ctx context.Context, texts []string) ([][]float64, error) {
+	endpoint, err := a.embeddingsURL()
+	if err != nil {
+		return nil, err
+	}
+	reqJSON, err := json.Marshal(openAIEmbeddingRequest{
+		Model:          a.Model,
+		Input:          texts,
+		Dimensions:     a.Dimensions,
+		EncodingFormat: "float",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("openai: error marshaling request: %w", err)
+	}
+
+	client := a.Client
+	if client == nil {
+		client = &http.Client{Timeout: 60 * time.Second}
+	}
+
+	const maxAttempts = 4
+	for attempt := 1; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(reqJSON))
+		if err != nil {
+			return nil, fmt.Errorf("openai: error creating request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if a.APIKey != "" && !hasHeader(a.Headers, "Authorization") && !hasHeader(a.Headers, "api-key") {
+			req.Header.Set("Authorization", "Bearer "+a.APIKey)
+		}
+		for key, value := range a.Headers {
+			req.Header.Set(key, value)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("openai: error making API request to %s: %w", endpoint, err)
+		}
+		respBody, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("openai: error reading response from %s: %w", endpoint, err)
+		}
+
+		var embeddingResp openAIEmbeddingResponse
+		parseErr := json.Unmarshal(respBody, &embeddingResp)
+
+		if resp.StatusCode != http.StatusOK {
+			message := strings.TrimSpace(string(respBody))
+			if parseErr == nil && embeddingResp.Error != nil {
+				message = embeddingResp.Error.Message
+			}
+			retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+			if !retryable || attempt == maxAttempts {
+				return nil, fmt.Errorf("openai: API at %s returned status %d: %s", endpoint, resp.StatusCode, message)
+			}
+
+			backoff := time.Duration(1<<(attempt-1)) * time.Second // 1s, 2s, 4s
+			if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+				backoff = time.Duration(seconds) * time.Second
+			}
+			fmt.Printf("OpenAI embedding request failed with status %d. Retrying (attempt %d/%d) after %.1f second delay...\n",
+				resp.StatusCode, attempt+1, maxAttempts, backoff.Seconds())
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(backoff):
+			}
+			continue
+		}
+
+		if parseErr != nil {
+			return nil, fmt.Errorf("openai: error parsing response from %s: %w", endpoint, parseErr)
+		}
+		if len(embeddingResp.Data) != len(texts) {
+			return nil, fmt.Errorf("openai: expected %d embeddings from %s, got %d", len(texts), endpoint, len(embeddingResp.Data))
+		}
+		embeddings := make([][]float64, len(texts))
+		for _, item := range embeddingResp.Data {
+			if item.Index < 0 || item.Index >= len(texts) || embeddings[item.Index] != nil {
+				return nil, fmt.Errorf("openai: unexpected embedding index %d from %s", item.Index, endpoint)
+			}
+			embeddings[item.Index] = item.Embedding
+		}
+		return embeddings, nil
+	}
+}
+
+// hasHeader reports whether headers set a header, ignoring case.
+func hasHeader(headers map[string]string, name string) bool {
+	for key := range headers {
+		if strings.EqualFold(key, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// --- Cached Adapter ---
+
+// CachedEmbeddingAdapter serves embeddings from an on-disk cache and only
+// asks the wrapped adapter for text it has not embedded before. It is safe
+// for concurrent use when the wrapped adapter is.
+type CachedEmbeddingAdapter struct {
+	Adapter  EmbeddingAdapter
+	Cache    *embedcache.Cache
+	Provider string
+	Model    string
+	Chunking string // How texts are cut from their files; part of the cache key
+
+	mu     sync.Mutex
+	Hits   int // Embeddings served from the cache
+	Misses int // Embeddings requested from the adapter
+}
+
+// GenerateEmbedding returns the cached embedding of text, or generates and
+// caches it.
+func (a *CachedEmbeddingAdapter) GenerateEmbedding(ctx context.Context, text string) ([]float64, error) {
+	embeddings, err := a.GenerateEmbeddings(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return embeddings[0], nil
+}
+
+// GenerateEmbeddings returns the cached embeddings of texts, and generates
+// the missing ones with a single batch call to the wrapped adapter.
+func (a *CachedEmbeddingAdapter) GenerateEmbeddings(ctx context.Context, texts []string) ([][]float64, error) {
+	embeddings := make([][]float64, len(texts))
+	keys := make([]embedcache.Key, len(texts))
+	var missing []int
+	for i, text := range texts {
+		keys[i] = embedcache.NewKey(text, strings.ToLower(a.Provider), a.Model, a.Chunking)
+		if embedding, ok := a.Cache.Get(keys[i]); ok {
+			embeddings[i] = embedding
+		} else {
+			missing = append(missing, i)
+		}
+	}
+	a.mu.Lock()
+	a.Hits += len(texts) - len(missing)
+	a.Misses += len(missing)
+	a.mu.Unlock()
+	if len(missing) == 0 {
+		return embeddings, nil
+	}
+
+	missingTexts := make([]string, len(missing))
+	for j, i := range missing {
+		missingTexts[j] = texts[i]
+	}
+	generated, err := GenerateEmbeddings(ctx, a.Adapter, missingTexts)
+	if err != nil {
+		return nil, err
+	}
+	for j, i := range missing {
+		embeddings[i] = generated[j]
+		if err := a.Cache.Put(keys[i], generated[j]); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Could not store embedding in cache: %v\n", err)
+		}
+	}
+	return embeddings, nil
+}
+
+// withCache wraps adapter in a CachedEmbeddingAdapter when opts has a cache.
+// The in-process local-lite vectors are cheaper to compute than to look up,
+// and depend on the other files, so they are never cached.
+func withCache(adapter EmbeddingAdapter, opts EmbeddingOptions, chunking string) EmbeddingAdapter {
+	if opts.Cache == nil || strings.ToLower(opts.Provider) == LocalLiteProvider {
+		return adapter
+	}
+	return &CachedEmbeddingAdapter{
+		Adapter:  adapter,
+		Cache:    opts.Cache,
+		Provider: opts.Provider,
+		Model:    cacheModel(opts),
+		Chunking: chunking,
+	}
+}
+
+// cacheModel names the model in cache keys and vector index paths. Vectors
+// shortened to a requested size are kept apart from full-size ones.
+func cacheModel(opts EmbeddingOptions) string {
+	if opts.Dimensions > 0 {
+		return fmt.Sprintf("%s@%d", opts.Model, opts.Dimensions)
+	}
+	return opts.Model
+}
+
+// reportCacheUse prints how many embeddings came from the cache.
+func reportCacheUse(adapter EmbeddingAdapter) {
+	if cached, ok := adapter.(*CachedEmbeddingAdapter); ok {
+		fmt.Printf("Embedding cache: %d hits, %d misses\n", cached.Hits, cached.Misses)
+	}
+}
+
 // --- Provider Factory ---
 
 // NewEmbeddingProvider creates an EmbeddingAdapter based on the options.
@@ -212,8 +642,27 @@ func NewEmbeddingProvider(opts EmbeddingOptions) (EmbeddingAdapter, error) {
 			APIKey: opts.APIKey,
 		}, nil
 	case "openai":
-		// Placeholder for OpenAI adapter
-		return nil, fmt.Errorf("OpenAI embedding provider not yet implemented")
+		baseURL := opts.Endpoint
+		if baseURL == DefaultEmbeddingOptions().Endpoint {
+			baseURL = "" // The CLI passes the Ollama endpoint unless told otherwise
+		}
+		apiKey := opts.APIKey
+		if apiKey == "" {
+			apiKey = os.Getenv("OPENAI_API_KEY")
+		}
+		return &OpenAIEmbeddingAdapter{
+			Model:      opts.Model,
+			APIKey:     apiKey,
+			BaseURL:    baseURL,
+			Dimensions: opts.Dimensions,
+			Headers:    opts.Headers,
+		}, nil
+	case LocalLiteProvider:
+		index := opts.Index
+		if index == nil {
+			index = BuildIndex(sourceFS(opts.FS, opts.TargetPath), opts.CandidateFiles)
+		}
+		return &LocalLiteEmbeddingAdapter{Index: index, Dimensions: opts.Dimensions, Analyzer: opts.Analyzer}, nil
 	case "anthropic":
 		// Placeholder for Anthropic adapter
 		return nil, fmt.Errorf("Anthropic embedding provider not yet implemented")
@@ -251,32 +700,6 @@ func cosineSimilarity(a, b []float64) float64 {
 	return dotProduct / (magnitudeA * magnitudeB)
 }
 
-// readFileContent reads the content of a file, up to maxLines
-func readFileContent(filePath string, maxLines int) (string, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return "", err
-	}
-	defer file.Close()
-
-	var content strings.Builder
-	lineCount := 0
-
-	// Use a scanner to read line by line
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() && lineCount < maxLines {
-		content.WriteString(scanner.Text())
-		content.WriteString("\n")
-		lineCount++
-	}
-
-	if err := scanner.Err(); err != nil {
-		return "", err
-	}
-
-	return content.String(), nil
-}
-
 // --- Relevance Identification Functions (Using Adapters) ---
 
 // IdentifyRelevantFilesWithEmbeddings finds files using embeddings via the configured provider.
@@ -303,6 +726,10 @@ func IdentifyRelevantFilesWithEmbeddings(opts EmbeddingOptions) ([]FileInfo, err
 	if err != nil {
 		return nil, fmt.Errorf("error creating embedding provider: %w", err)
 	}
+	opts.Chunking = opts.Chunking.withDefaults()
+	opts.Batch = opts.Batch.withDefaults(opts.Provider)
+	embeddingProvider = withCache(withRateLimit(embeddingProvider, opts), opts, opts.Chunking.CacheKey())
+	defer reportCacheUse(embeddingProvider)
 
 	// Get embedding for the query
 	queryEmbedding, err := embeddingProvider.GenerateEmbedding(ctx, opts.Query)
@@ -310,58 +737,34 @@ func IdentifyRelevantFilesWithEmbeddings(opts EmbeddingOptions) ([]FileInfo, err
 		return nil, fmt.Errorf("error getting query embedding: %w", err)
 	}
 
-	// Score each file based on embedding similarity
+	// Score each file from the chunks nearest to the query in the vector index
+	fsys := sourceFS(opts.FS, opts.TargetPath)
+	chunkScores, err := embedCandidates(ctx, embeddingProvider, queryEmbedding, fsys, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error searching vector index: %w", err)
+	}
 	var scoredFiles []FileInfo
 	for _, filePath := range opts.CandidateFiles {
-		// Skip very large files
-		fullPath := filepath.Join(opts.TargetPath, filePath)
-		fileInfo, err := os.Stat(fullPath)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: Error getting file info for %s: %v\n", filePath, err)
-			continue
-		}
-
-		if fileInfo.Size() > 1024*1024 { // Skip files larger than 1MB
-			fmt.Fprintf(os.Stderr, "Warning: Skipping large file %s (%d bytes)\n", filePath, fileInfo.Size())
-			continue
-		}
-
-		// Read file content
-		content, err := readFileContent(fullPath, 500) // Limit to 500 lines
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: Error reading file %s: %v\n", filePath, err)
-			continue
-		}
-
-		// Get embedding for the file content using the adapter
-		fileEmbedding, err := embeddingProvider.GenerateEmbedding(ctx, content)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: Error getting embedding for %s: %v\n", filePath, err)
-			continue
-		}
-
-		// Calculate similarity score
-		score := cosineSimilarity(queryEmbedding, fileEmbedding)
-		if score > 0 {
+		match := chunkScores[filePath]
+		if match.score > 0 {
 			scoredFiles = append(scoredFiles, FileInfo{
-				Path:  filePath,
-				Score: score,
+				Path:    filePath,
+				Score:   match.score,
+				Meta:    opts.CandidateMeta[filePath],
+				Module:  opts.CandidateModules[filePath],
+				Matches: match.matches,
 			})
 		}
 	}
 
-	// Sort files by score (highest first)
-	sort.Slice(scoredFiles, func(i, j int) bool {
-		return scoredFiles[i].Score > scoredFiles[j].Score
-	})
-
-	// Limit the number of files to return
-	maxFiles := opts.MaxFilesToCheck
-	if maxFiles > len(scoredFiles) {
-		maxFiles = len(scoredFiles)
+	// Sort files by score (highest first, ties by path)
+	sortByScore(scoredFiles)
+	for i := range scoredFiles {
+		scoredFiles[i].Breakdown = singleSignalBreakdown("embedding", scoredFiles[i].Score, i+1)
 	}
 
-	return scoredFiles[:maxFiles], nil
+	// Limit the number of files to return
+	return limitFiles(scoredFiles, opts.MaxFilesToCheck, opts.MaxFilesPerModule), nil
 }
 
 // IdentifyRelevantFilesWithHybridApproach finds files using a mix of embeddings, keywords, and path relevance.
@@ -382,12 +785,29 @@ func IdentifyRelevantFilesWithHybridApproach(embeddingOpts EmbeddingOptions) ([]
 		embeddingOpts.Endpoint = DefaultEmbeddingOptions().Endpoint
 	}
 
+	// Rank the candidates lexically with BM25F for the keyword score; the
+	// local-lite provider takes its document frequencies from the same index
+	fsys := sourceFS(embeddingOpts.FS, embeddingOpts.TargetPath)
+	if embeddingOpts.Index == nil {
+		embeddingOpts.Index = BuildIndex(fsys, embeddingOpts.CandidateFiles)
+	}
+	terms := analyzerOrDefault(embeddingOpts.Analyzer).Analyze(embeddingOpts.Query)
+	keywordScores := embeddingOpts.Index.Scores(terms)
+
 	// Create the embedding provider
 	embeddingProvider, err := NewEmbeddingProvider(embeddingOpts)
 	if err != nil {
+		if embeddingOpts.RequireEmbeddings {
+			return nil, fmt.Errorf("failed to create embedding provider: %w", err)
+		}
 		// Don't fail entirely in hybrid mode, just warn and proceed without embeddings
 		fmt.Fprintf(os.Stderr, "Warning: Failed to create embedding provider for hybrid search: %v. Proceeding with keyword and path relevance only.\n", err)
 		embeddingProvider = nil // Set to nil to signal skipping embedding steps
+	} else {
+		embeddingOpts.Chunking = embeddingOpts.Chunking.withDefaults()
+		embeddingOpts.Batch = embeddingOpts.Batch.withDefaults(embeddingOpts.Provider)
+		embeddingProvider = withCache(withRateLimit(embeddingProvider, embeddingOpts), embeddingOpts, embeddingOpts.Chunking.CacheKey())
+		defer reportCacheUse(embeddingProvider)
 	}
 
 	// Get embedding for the query (only if provider was created)
@@ -395,6 +815,9 @@ func IdentifyRelevantFilesWithHybridApproach(embeddingOpts EmbeddingOptions) ([]
 	if embeddingProvider != nil {
 		queryEmbedding, err = embeddingProvider.GenerateEmbedding(ctx, embeddingOpts.Query)
 		if err != nil {
+			if embeddingOpts.RequireEmbeddings {
+				return nil, fmt.Errorf("failed to get query embedding: %w", err)
+			}
 			fmt.Fprintf(os.Stderr, "Warning: Failed to get query embedding for hybrid search: %v. Proceeding without embedding scores.\n", err)
 			queryEmbedding = nil // Signal to skip file embeddings
 		} else {
@@ -402,98 +825,85 @@ func IdentifyRelevantFilesWithHybridApproach(embeddingOpts EmbeddingOptions) ([]
 		}
 	}
 
-	// Extract keywords for traditional matching
-	keywords := extractKeywords(embeddingOpts.Query)
-	fmt.Printf("Keywords extracted from query: %v\n", keywords)
+	fmt.Printf("Query terms: %v\n", terms)
 
-	var scoredFiles []FileInfo
-	for _, filePath := range embeddingOpts.CandidateFiles {
-		// File skipping logic (keep existing)
-		fullPath := filepath.Join(embeddingOpts.TargetPath, filePath)
-		fileInfo, err := os.Stat(fullPath)
+	// Score the candidates from the chunks nearest to the query in the vector index
+	var chunkScores map[string]chunkMatch
+	if embeddingProvider != nil && queryEmbedding != nil {
+		chunkScores, err = embedCandidates(ctx, embeddingProvider, queryEmbedding, fsys, embeddingOpts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: Error getting file info for %s: %v\n", filePath, err)
-			continue
-		}
-		if fileInfo.Size() > 1024*1024*2 { // Skip files larger than 2MB
-			fmt.Fprintf(os.Stderr, "Warning: Skipping large file %s (%d bytes)\n", filePath, fileInfo.Size())
-			continue
-		}
-
-		// Read file content (keep existing)
-		content, err := readFileContent(fullPath, 800)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: Error reading file %s: %v\n", filePath, err)
-			continue
-		}
-
-		// --- Calculate Scores ---
-		var embeddingScore float64
-		if embeddingProvider != nil && queryEmbedding != nil { // Only calculate if provider and query embedding are valid
-			fileEmbedding, err := embeddingProvider.GenerateEmbedding(ctx, content)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Warning: Error getting embedding for file %s: %v\n", filePath, err)
-				embeddingScore = 0
-			} else {
-				embeddingScore = cosineSimilarity(queryEmbedding, fileEmbedding)
+			if embeddingOpts.RequireEmbeddings {
+				return nil, fmt.Errorf("failed to search vector index: %w", err)
 			}
-		} else {
-			embeddingScore = 0 // Assign 0 if embeddings are skipped
+			fmt.Fprintf(os.Stderr, "Warning: Failed to search vector index for hybrid search: %v. Proceeding without embedding scores.\n", err)
 		}
+	}
 
-		// Keyword score (keep existing)
-		keywordScore, _ := scoreFile(fullPath, keywords) // Ignore error for hybrid scoring
-		keywordScore = keywordScore / 10.0               // Normalize keyword score roughly
-
-		// Path relevance score (keep existing)
-		pathRelevance := getPathRelevanceScore(filePath, keywords)
-
-		// Combine scores (keep existing weights for now)
-		combinedScore := (embeddingScore * 0.7) + (keywordScore * 0.2) + (pathRelevance * 0.1)
+	var scoredFiles []FileInfo
+	for _, filePath := range embeddingOpts.CandidateFiles {
+		// File size limits are applied by the walker (walker.Options.MaxSize)
 
-		if combinedScore > 0 {
-			scoredFiles = append(scoredFiles, FileInfo{
-				Path:  filePath,
-				Score: combinedScore,
-			})
-			fmt.Printf("File: %s, Embedding: %.2f, Keyword: %.2f, Path: %.2f, Combined: %.2f\n",
-				filePath, embeddingScore, keywordScore, pathRelevance, combinedScore)
+		// --- Collect the signals ---
+		raw := SignalScores{
+			Embedding: chunkScores[filePath].score,            // 0 if embeddings are skipped or no chunk of the file is near the query
+			Keyword:   keywordScores[filePath],                // BM25F
+			Path:      getPathRelevanceScore(filePath, terms), // Query terms in the path
+		}
+		if raw.Embedding <= 0 && raw.Keyword <= 0 && raw.Path <= 0 {
+			continue // Nothing relates the file to the query
 		}
+		scoredFiles = append(scoredFiles, FileInfo{
+			Path:      filePath,
+			Meta:      embeddingOpts.CandidateMeta[filePath],
+			Module:    embeddingOpts.CandidateModules[filePath],
+			Matches:   chunkScores[filePath].matches,
+			Breakdown: &ScoreBreakdown{Approach: "hybrid", Raw: raw},
+		})
 	}
 
-	// Sort files by combined score
-	sort.Slice(scoredFiles, func(i, j int) bool {
-		return scoredFiles[i].Score > scoredFiles[j].Score
-	})
+	// Combine the signals into one score per file
+	Fuse(scoredFiles, embeddingOpts.Fusion)
 
-	// Limit the number of files
-	maxFiles := embeddingOpts.MaxFilesToCheck
-	if maxFiles > len(scoredFiles) {
-		maxFiles = len(scoredFiles)
-	}
+	// Sort files by combined score (ties by path)
+	sortByScore(scoredFiles)
 
-	return scoredFiles[:maxFiles], nil
+	// Limit the number of files
+	return limitFiles(scoredFiles, embeddingOpts.MaxFilesToCheck, embeddingOpts.MaxFilesPerModule), nil
 }
 
 // --- Helper functions used by relevance logic ---
 
 // getPathRelevanceScore calculates a score based on path matching (used by hybrid approach)
-// (Keep existing function)
-func getPathRelevanceScore(filePath string, keywords []string) float64 {
+// A term matches when the path has it among its terms, or contains the word
+// it comes from; synonyms count by their weight.
+func getPathRelevanceScore(filePath string, terms []QueryTerm) float64 {
 	pathLower := strings.ToLower(filePath)
+	baseLower := strings.ToLower(filepath.Base(filePath))
+	pathTerms := termSet(Tokenize(filePath))
+	baseTerms := termSet(Tokenize(filepath.Base(filePath)))
 	var score float64
-	for _, keyword := range keywords {
-		if containsAny(pathLower, keyword) {
-			score += 0.5 // Base score for keyword in path
+	for _, term := range terms {
+		inWord := func(s string) bool { return len(term.Word) >= 3 && containsAny(s, term.Word) }
+		if pathTerms[term.Term] || inWord(pathLower) {
+			score += 0.5 * term.Weight // Base score for keyword in path
 			// Bonus if keyword is in the filename itself
-			if containsAny(strings.ToLower(filepath.Base(filePath)), keyword) {
-				score += 0.5
+			if baseTerms[term.Term] || inWord(baseLower) {
+				score += 0.5 * term.Weight
 			}
 		}
 	}
 	return score
 }
 
+// termSet returns the set of the given terms.
+func termSet(terms []string) map[string]bool {
+	set := make(map[string]bool, len(terms))
+	for _, term := range terms {
+		set[term] = true
+	}
+	return set
+}
+
 // containsAny checks if a string contains any of the substrings
 // (Keep existing function)
 func containsAny(s string, substr ...string) bool {
@@ -504,6 +914,3 @@ func containsAny(s string, substr ...string) bool {
 	}
 	return false
 }
-
-// extractKeywords extracts meaningful keywords from a query
-// (Function definition removed, assuming it exists earlier)
@@ -0,0 +1,245 @@
+package relevance
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeOpenAI is a stand-in for an OpenAI-compatible embeddings server. The
+// embedding of a text is [length of the text, position in its request], and
+// the data items are returned in reverse order.
+type fakeOpenAI struct {
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   []openAIEmbeddingRequest
+	raw      []map[string]any // Request bodies as sent, to check omitted fields
+	failures []int            // Status codes returned, in order, before succeeding
+}
+
+func (f *fakeOpenAI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	data, err := io.ReadAll(r.Body)
+	var body openAIEmbeddingRequest
+	var raw map[string]any
+	if err == nil {
+		err = json.Unmarshal(data, &body)
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &raw)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.requests = append(f.requests, r)
+	f.bodies = append(f.bodies, body)
+	f.raw = append(f.raw, raw)
+
+	if len(f.failures) > 0 {
+		status := f.failures[0]
+		f.failures = f.failures[1:]
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `{"error": {"message": "status %d"}}`, status)
+		return
+	}
+
+	type item struct {
+		Index     int       `json:"index"`
+		Embedding []float64 `json:"embedding"`
+	}
+	var items []item
+	for i := len(body.Input) - 1; i >= 0; i-- {
+		items = append(items, item{Index: i, Embedding: []float64{float64(len(body.Input[i])), float64(i)}})
+	}
+	json.NewEncoder(w).Encode(map[string]any{"data": items})
+}
+
+// newFakeOpenAI starts a fakeOpenAI server, closed with the test.
+func newFakeOpenAI(t *testing.T) (*fakeOpenAI, *httptest.Server) {
+	t.Helper()
+	fake := &fakeOpenAI{}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return fake, server
+}
+
+func TestOpenAIEmbeddingsBatchesInOrder(t *testing.T) {
+	fake, server := newFakeOpenAI(t)
+	adapter := &OpenAIEmbeddingAdapter{Model: "m", BaseURL: server.URL + "/v1", BatchSize: 2}
+
+	texts := []string{"a", "bb", "ccc", "dddd", "eeeee"}
+	got, err := adapter.GenerateEmbeddings(context.Background(), texts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]float64{{1, 0}, {2, 1}, {3, 0}, {4, 1}, {5, 0}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("embeddings = %v, want %v", got, want)
+	}
+
+	var batches [][]string
+	for _, body := range fake.bodies {
+		batches = append(batches, body.Input)
+		if body.Model != "m" || body.EncodingFormat != "float" {
+			t.Errorf("request model, encoding_format = %q, %q", body.Model, body.EncodingFormat)
+		}
+	}
+	if want := [][]string{{"a", "bb"}, {"ccc", "dddd"}, {"eeeee"}}; !reflect.DeepEqual(batches, want) {
+		t.Errorf("batches = %v, want %v", batches, want)
+	}
+}
+
+func TestOpenAIEmbeddingsDimensions(t *testing.T) {
+	for _, dims := range []int{0, 256} {
+		fake, server := newFakeOpenAI(t)
+		adapter := &OpenAIEmbeddingAdapter{Model: "m", BaseURL: server.URL, Dimensions: dims}
+		if _, err := adapter.GenerateEmbedding(context.Background(), "text"); err != nil {
+			t.Fatal(err)
+		}
+		value, sent := fake.raw[0]["dimensions"]
+		switch {
+		case dims == 0 && sent:
+			t.Errorf("dimensions sent as %v when not configured", value)
+		case dims != 0 && value != float64(dims):
+			t.Errorf("dimensions = %v, want %d", value, dims)
+		}
+	}
+}
+
+func TestOpenAIEmbeddingsURL(t *testing.T) {
+	tests := []struct {
+		base string
+		want string
+	}{
+		{"/v1", "/v1/embeddings"},
+		{"/v1/", "/v1/embeddings"},
+		{"", "/embeddings"},
+		{"/openai/deployments/emb/embeddings", "/openai/deployments/emb/embeddings"},
+		{"/openai/deployments/emb/embeddings?api-version=2024-02-01", "/openai/deployments/emb/embeddings?api-version=2024-02-01"},
+		{"/openai/deployments/emb?api-version=2024-02-01", "/openai/deployments/emb/embeddings?api-version=2024-02-01"},
+	}
+	for _, tt := range tests {
+		fake, server := newFakeOpenAI(t)
+		adapter := &OpenAIEmbeddingAdapter{Model: "m", BaseURL: server.URL + tt.base}
+		if _, err := adapter.GenerateEmbedding(context.Background(), "text"); err != nil {
+			t.Errorf("base %q: %v", tt.base, err)
+			continue
+		}
+		if got := fake.requests[0].URL.RequestURI(); got != tt.want {
+			t.Errorf("base %q: requested %s, want %s", tt.base, got, tt.want)
+		}
+	}
+
+	if got, _ := (&OpenAIEmbeddingAdapter{}).embeddingsURL(); got != DefaultOpenAIBaseURL+"/embeddings" {
+		t.Errorf("default URL = %s, want %s/embeddings", got, DefaultOpenAIBaseURL)
+	}
+}
+
+func TestOpenAIEmbeddingsHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    map[string]string // Expected request headers; "" means absent
+	}{
+		{"bearer token", nil, map[string]string{"Authorization": "Bearer key"}},
+		{"authorization header wins", map[string]string{"authorization": "Token other"}, map[string]string{"Authorization": "Token other"}},
+		{"azure api-key", map[string]string{"api-key": "azure"}, map[string]string{"Authorization": "", "Api-Key": "azure"}},
+		{"extra headers", map[string]string{"X-Org": "org"}, map[string]string{"Authorization": "Bearer key", "X-Org": "org"}},
+	}
+	for _, tt := range tests {
+		fake, server := newFakeOpenAI(t)
+		adapter := &OpenAIEmbeddingAdapter{Model: "m", APIKey: "key", BaseURL: server.URL, Headers: tt.headers}
+		if _, err := adapter.GenerateEmbedding(context.Background(), "text"); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		header := fake.requests[0].Header
+		for name, want := range tt.want {
+			if got := header.Get(name); got != want {
+				t.Errorf("%s: header %s = %q, want %q", tt.name, name, got, want)
+			}
+		}
+	}
+}
+
+func TestOpenAIEmbeddingsRetriesRateLimits(t *testing.T) {
+	fake, server := newFakeOpenAI(t)
+	fake.failures = []int{http.StatusTooManyRequests}
+	adapter := &OpenAIEmbeddingAdapter{Model: "m", BaseURL: server.URL}
+
+	start := time.Now()
+	got, err := adapter.GenerateEmbeddings(context.Background(), []string{"a", "bb"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]float64{{1, 0}, {2, 1}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("embeddings = %v, want %v", got, want)
+	}
+	if len(fake.requests) != 2 {
+		t.Errorf("server got %d requests, want 2", len(fake.requests))
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %v, before the 1 second Retry-After", elapsed)
+	}
+}
+
+func TestOpenAIEmbeddingsErrors(t *testing.T) {
+	// Client errors are not retried
+	fake, server := newFakeOpenAI(t)
+	fake.failures = []int{http.StatusUnauthorized, http.StatusUnauthorized}
+	adapter := &OpenAIEmbeddingAdapter{Model: "m", BaseURL: server.URL}
+	_, err := adapter.GenerateEmbedding(context.Background(), "text")
+	if err == nil || !strings.Contains(err.Error(), "status 401") {
+		t.Errorf("error = %v, want the 401 message", err)
+	}
+	if len(fake.requests) != 1 {
+		t.Errorf("server got %d requests, want 1", len(fake.requests))
+	}
+
+	// Retries stop when the context is canceled
+	fake.failures = []int{http.StatusServiceUnavailable}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := adapter.GenerateEmbedding(ctx, "text"); err != context.DeadlineExceeded {
+		t.Errorf("error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestHybridRequireEmbeddings(t *testing.T) {
+	fake, server := newFakeOpenAI(t)
+	fsys, paths := testCorpus(t)
+	opts := EmbeddingOptions{
+		Provider:        "openai",
+		Model:           "m",
+		Endpoint:        server.URL,
+		APIKey:          "key",
+		Query:           "user login session",
+		FS:              fsys,
+		CandidateFiles:  paths,
+		MaxFilesToCheck: 10,
+	}
+
+	// By default a failing provider leaves the keyword and path scores
+	fake.failures = []int{http.StatusUnauthorized}
+	files, err := IdentifyRelevantFilesWithHybridApproach(opts)
+	if err != nil || len(files) == 0 {
+		t.Errorf("fallback ranking = %v, %v, want keyword matches", files, err)
+	}
+
+	fake.failures = []int{http.StatusUnauthorized}
+	opts.RequireEmbeddings = true
+	if files, err := IdentifyRelevantFilesWithHybridApproach(opts); err == nil || !strings.Contains(err.Error(), "status 401") {
+		t.Errorf("required embeddings = %v, %v, want the 401 error", files, err)
+	}
+}
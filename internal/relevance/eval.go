@@ -0,0 +1,174 @@
+package relevance
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// EvalQuery is a query labeled with the files that answer it.
+type EvalQuery struct {
+	Query    string   `json:"query"`
+	Relevant []string `json:"relevant"` // Paths relative to the target directory, with forward slashes
+}
+
+// LoadEvalQueries reads labeled queries from a JSON file holding an array of
+// them, such as
+//
+//	[{"query": "How are tokens refreshed?", "relevant": ["auth/refresh.go", "auth/store.go"]}]
+//
+// or from a JSON Lines file with one query object per line.
+func LoadEvalQueries(filePath string) ([]EvalQuery, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var queries []EvalQuery
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &queries); err != nil {
+			return nil, fmt.Errorf("error reading queries %s: %w", filePath, err)
+		}
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(nil, 1024*1024)
+		for n := 1; scanner.Scan(); n++ {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			var query EvalQuery
+			if err := json.Unmarshal(line, &query); err != nil {
+				return nil, fmt.Errorf("error reading queries %s, line %d: %w", filePath, n, err)
+			}
+			queries = append(queries, query)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("error reading queries %s: %w", filePath, err)
+		}
+	}
+
+	for i, query := range queries {
+		if query.Query == "" || len(query.Relevant) == 0 {
+			return nil, fmt.Errorf("query %d in %s needs a query and at least one relevant file", i+1, filePath)
+		}
+	}
+	if len(queries) == 0 {
+		return nil, fmt.Errorf("no queries in %s", filePath)
+	}
+	return queries, nil
+}
+
+// EvalMetrics measures a ranking against the relevant files, over its first
+// K files.
+type EvalMetrics struct {
+	Recall    float64 `json:"recall"`    // Share of the relevant files ranked in the first K
+	Precision float64 `json:"precision"` // Share of the first K places taken by relevant files
+	MRR       float64 `json:"mrr"`       // Reciprocal rank of the first relevant file (0 when none made the first K)
+	NDCG      float64 `json:"ndcg"`      // Discounted gain of the relevant files, 1 when they come first
+}
+
+// ScoreRanking computes the metrics of the ranked paths, best first, at a
+// cutoff of k files. Paths are compared with forward slashes.
+func ScoreRanking(ranked []string, relevant []string, k int) EvalMetrics {
+	wanted := make(map[string]bool, len(relevant))
+	for _, p := range relevant {
+		wanted[evalPath(p)] = true
+	}
+
+	var metrics EvalMetrics
+	var found int
+	var dcg float64
+	for i, p := range ranked[:min(k, len(ranked))] {
+		if !wanted[evalPath(p)] {
+			continue
+		}
+		found++
+		dcg += 1 / math.Log2(float64(i+2))
+		if metrics.MRR == 0 {
+			metrics.MRR = 1 / float64(i+1)
+		}
+	}
+
+	var idealDCG float64
+	for i := range min(k, len(wanted)) {
+		idealDCG += 1 / math.Log2(float64(i+2))
+	}
+	if len(wanted) > 0 {
+		metrics.Recall = float64(found) / float64(len(wanted))
+	}
+	if k > 0 {
+		metrics.Precision = float64(found) / float64(k)
+	}
+	if idealDCG > 0 {
+		metrics.NDCG = dcg / idealDCG
+	}
+	return metrics
+}
+
+// evalPath puts a labeled or ranked path in the form used for comparisons.
+func evalPath(p string) string {
+	return path.Clean(filepath.ToSlash(p))
+}
+
+// QueryEval is how one strategy did on one query.
+type QueryEval struct {
+	Query   string      `json:"query"`
+	Metrics EvalMetrics `json:"metrics"`
+	Ranked  []string    `json:"ranked"`           // First K files of the ranking
+	Missed  []string    `json:"missed,omitempty"` // Relevant files not among them
+}
+
+// StrategyEval is how one strategy did on a query set.
+type StrategyEval struct {
+	Strategy string      `json:"strategy"`
+	K        int         `json:"k"`
+	Mean     EvalMetrics `json:"mean"` // Metrics averaged over the queries
+	Queries  []QueryEval `json:"queries"`
+}
+
+// Evaluate ranks files for every query with rank and measures the first k
+// of each ranking. It stops at the first query rank fails on, since metrics
+// over part of the queries cannot be compared with other strategies.
+func Evaluate(strategy string, queries []EvalQuery, k int, rank func(query string) ([]FileInfo, error)) (StrategyEval, error) {
+	result := StrategyEval{Strategy: strategy, K: k}
+	for i, query := range queries {
+		files, err := rank(query.Query)
+		if err != nil {
+			return result, fmt.Errorf("query %d (%q): %w", i+1, query.Query, err)
+		}
+
+		eval := QueryEval{Query: query.Query, Ranked: []string{}}
+		for _, file := range files[:min(k, len(files))] {
+			eval.Ranked = append(eval.Ranked, evalPath(file.Path))
+		}
+		eval.Metrics = ScoreRanking(eval.Ranked, query.Relevant, k)
+		ranked := make(map[string]bool, len(eval.Ranked))
+		for _, p := range eval.Ranked {
+			ranked[p] = true
+		}
+		for _, p := range query.Relevant {
+			if !ranked[evalPath(p)] {
+				eval.Missed = append(eval.Missed, evalPath(p))
+			}
+		}
+		result.Queries = append(result.Queries, eval)
+
+		result.Mean.Recall += eval.Metrics.Recall
+		result.Mean.Precision += eval.Metrics.Precision
+		result.Mean.MRR += eval.Metrics.MRR
+		result.Mean.NDCG += eval.Metrics.NDCG
+	}
+	if n := float64(len(result.Queries)); n > 0 {
+		result.Mean.Recall /= n
+		result.Mean.Precision /= n
+		result.Mean.MRR /= n
+		result.Mean.NDCG /= n
+	}
+	return result, nil
+}
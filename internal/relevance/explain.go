@@ -0,0 +1,207 @@
+package relevance
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Explanation tells why a file was ranked where it was.
+type Explanation struct {
+	Path      string              `json:"path"`
+	Rank      int                 `json:"rank"`     // Position in the final ranking, 1-based
+	Selected  bool                `json:"selected"` // Whether the file made it into the report
+	Score     float64             `json:"score"`
+	Approach  string              `json:"approach,omitempty"` // "keyword", "embedding" or "hybrid"
+	Signals   []SignalExplanation `json:"signals,omitempty"`
+	Keywords  []KeywordMatch      `json:"keywords,omitempty"`   // Query terms found in the file
+	BestChunk *LineRange          `json:"best_chunk,omitempty"` // Chunk nearest to the query, for the embedding approaches
+	Judgement *Judgement          `json:"judgement,omitempty"`  // LLM grade, when the files were reranked
+}
+
+// SignalExplanation is one signal's part in a file's score.
+type SignalExplanation struct {
+	Signal       string  `json:"signal"`
+	Raw          float64 `json:"raw"`
+	Normalized   float64 `json:"normalized"`
+	Contribution float64 `json:"contribution"`
+	Rank         int     `json:"rank,omitempty"` // Position among the scored files under this signal (0 = no score)
+}
+
+// KeywordMatch lists where a query term occurs in a file.
+type KeywordMatch struct {
+	Term    string `json:"term"` // Query word, or synonym, the term comes from
+	Synonym bool   `json:"synonym,omitempty"`
+	InPath  bool   `json:"in_path,omitempty"`
+	Count   int    `json:"count"` // Lines containing the term
+	Lines   []int  `json:"lines"` // The first of those lines, 1-based
+}
+
+// maxKeywordLines is the number of line numbers kept per matched term.
+const maxKeywordLines = 10
+
+// Explain fills in the Explanation of each file, ranked as given; the first
+// selected files are the ones that made it into the report. Files are read
+// from fsys to find the query terms, as analyzer finds them (nil =
+// DefaultAnalyzer).
+func Explain(fsys fs.FS, query string, analyzer *Analyzer, files []FileInfo, selected int) {
+	terms := analyzerOrDefault(analyzer).Analyze(query)
+	for i := range files {
+		file := &files[i]
+		explanation := &Explanation{
+			Path:      file.Path,
+			Rank:      i + 1,
+			Selected:  i < selected,
+			Score:     file.Score,
+			Judgement: file.Judgement,
+		}
+		if b := file.Breakdown; b != nil {
+			explanation.Approach = b.Approach
+			for _, name := range signalNames {
+				if b.Approach != "hybrid" && b.Approach != name {
+					continue // Single-signal approaches only have their own signal
+				}
+				explanation.Signals = append(explanation.Signals, SignalExplanation{
+					Signal:       name,
+					Raw:          b.Raw.get(name),
+					Normalized:   b.Normalized.get(name),
+					Contribution: b.Contribution.get(name),
+					Rank:         b.Ranks.get(name),
+				})
+			}
+		}
+		if len(file.Matches) > 0 {
+			best := file.Matches[0]
+			explanation.BestChunk = &best
+		}
+		if content, err := fs.ReadFile(fsys, filepath.ToSlash(file.Path)); err == nil {
+			explanation.Keywords = keywordMatches(file.Path, string(content), terms)
+		}
+		file.Explanation = explanation
+	}
+}
+
+// keywordMatches finds the lines of a file containing each term, tokenized
+// the same way as for the keyword index.
+func keywordMatches(filePath string, content string, terms []QueryTerm) []KeywordMatch {
+	if len(terms) == 0 {
+		return nil
+	}
+	matches := make([]KeywordMatch, len(terms))
+	index := make(map[string]int, len(terms))
+	for i, term := range terms {
+		matches[i].Term = term.Word
+		matches[i].Synonym = term.Weight < 1
+		index[term.Term] = i
+	}
+	for _, term := range Tokenize(filePath) {
+		if i, ok := index[term]; ok {
+			matches[i].InPath = true
+		}
+	}
+	for n, line := range strings.Split(content, "\n") {
+		seen := make(map[int]bool)
+		for _, term := range Tokenize(line) {
+			i, ok := index[term]
+			if !ok || seen[i] {
+				continue
+			}
+			seen[i] = true
+			matches[i].Count++
+			if len(matches[i].Lines) < maxKeywordLines {
+				matches[i].Lines = append(matches[i].Lines, n+1)
+			}
+		}
+	}
+
+	var found []KeywordMatch
+	for _, match := range matches {
+		if match.InPath || match.Count > 0 {
+			found = append(found, match)
+		}
+	}
+	return found
+}
+
+// Markdown renders the explanation for the report.
+func (e Explanation) Markdown() string {
+	var md strings.Builder
+	fmt.Fprintf(&md, "<details>\n<summary>Why this file: rank %d, score %.3f", e.Rank, e.Score)
+	if e.Approach != "" {
+		fmt.Fprintf(&md, " (%s)", e.Approach)
+	}
+	md.WriteString("</summary>\n\n")
+
+	if len(e.Signals) > 0 {
+		md.WriteString("| Signal | Raw | Normalized | Contribution | Rank |\n|---|---|---|---|---|\n")
+		for _, s := range e.Signals {
+			rank := "-"
+			if s.Rank > 0 {
+				rank = fmt.Sprint(s.Rank)
+			}
+			fmt.Fprintf(&md, "| %s | %.3f | %.3f | %.3f | %s |\n", s.Signal, s.Raw, s.Normalized, s.Contribution, rank)
+		}
+		md.WriteString("\n")
+	}
+
+	if len(e.Keywords) > 0 {
+		var parts []string
+		for _, k := range e.Keywords {
+			var where []string
+			if k.InPath {
+				where = append(where, "path")
+			}
+			for _, line := range k.Lines {
+				where = append(where, fmt.Sprintf("L%d", line))
+			}
+			if more := k.Count - len(k.Lines); more > 0 {
+				where = append(where, fmt.Sprintf("+%d more", more))
+			}
+			if k.Synonym {
+				where = append([]string{"synonym"}, where...)
+			}
+			parts = append(parts, fmt.Sprintf("`%s` (%s)", k.Term, strings.Join(where, ", ")))
+		}
+		fmt.Fprintf(&md, "**Keywords:** %s\n\n", strings.Join(parts, ", "))
+	} else {
+		md.WriteString("**Keywords:** none of the query terms occur in the file\n\n")
+	}
+	if e.BestChunk != nil {
+		fmt.Fprintf(&md, "**Best chunk:** %s (similarity %.3f)\n\n", e.BestChunk, e.BestChunk.Score)
+	}
+	if e.Judgement != nil {
+		fmt.Fprintf(&md, "**LLM grade:** %d/%d, %s\n\n", e.Judgement.Grade, MaxGrade, e.Judgement.Reason)
+	}
+	md.WriteString("</details>")
+	return md.String()
+}
+
+// explanationReport is the JSON sidecar written by WriteExplanations.
+type explanationReport struct {
+	Query       string         `json:"query"`
+	GeneratedAt time.Time      `json:"generated_at"`
+	Files       []*Explanation `json:"files"`
+}
+
+// WriteExplanations writes the explanations of the files, which must have
+// been filled in by Explain, to a JSON file.
+func WriteExplanations(path string, query string, files []FileInfo) error {
+	report := explanationReport{Query: query, GeneratedAt: time.Now(), Files: []*Explanation{}}
+	for _, file := range files {
+		if file.Explanation != nil {
+			report.Files = append(report.Files, file.Explanation)
+		}
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("error writing explanations: %w", err)
+	}
+	return nil
+}
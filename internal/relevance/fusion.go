@@ -0,0 +1,371 @@
+package relevance
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SignalScores holds one value per relevance signal of the hybrid approach.
+type SignalScores struct {
+	Embedding float64 `json:"embedding"` // Similarity of the file's best chunks to the query
+	Keyword   float64 `json:"keyword"`   // BM25F score of the file for the query terms
+	Path      float64 `json:"path"`      // Query keywords found in the file path
+}
+
+// signalNames lists the signals in a fixed order, for parsing and printing.
+var signalNames = []string{"embedding", "keyword", "path"}
+
+// get returns the value of a signal by name.
+func (s SignalScores) get(name string) float64 {
+	switch name {
+	case "embedding":
+		return s.Embedding
+	case "keyword":
+		return s.Keyword
+	default:
+		return s.Path
+	}
+}
+
+// set changes the value of a signal by name.
+func (s *SignalScores) set(name string, value float64) {
+	switch name {
+	case "embedding":
+		s.Embedding = value
+	case "keyword":
+		s.Keyword = value
+	default:
+		s.Path = value
+	}
+}
+
+// SignalRanks holds the position of a file under each signal: 1 for the
+// best score, 0 when the file did not get the signal.
+type SignalRanks struct {
+	Embedding int `json:"embedding,omitempty"`
+	Keyword   int `json:"keyword,omitempty"`
+	Path      int `json:"path,omitempty"`
+}
+
+// get returns the rank of a signal by name.
+func (r SignalRanks) get(name string) int {
+	switch name {
+	case "embedding":
+		return r.Embedding
+	case "keyword":
+		return r.Keyword
+	default:
+		return r.Path
+	}
+}
+
+// set changes the rank of a signal by name.
+func (r *SignalRanks) set(name string, rank int) {
+	switch name {
+	case "embedding":
+		r.Embedding = rank
+	case "keyword":
+		r.Keyword = rank
+	default:
+		r.Path = rank
+	}
+}
+
+// ScoreBreakdown shows how a file's score was made from the signals. The
+// keyword and embedding approaches only fill in their own signal, and their
+// score is the raw one.
+type ScoreBreakdown struct {
+	Approach     string       // "keyword", "embedding" or "hybrid"
+	Raw          SignalScores // Signal scores as computed
+	Normalized   SignalScores // Signal scores after normalization (reciprocal ranks for RRF)
+	Contribution SignalScores // Weighted normalized scores; they add up to the score (before the sigmoid of "linear")
+	Ranks        SignalRanks  // Position of the file among the scored files under each signal
+}
+
+// FusionOptions selects how the hybrid approach combines its signals.
+type FusionOptions struct {
+	// Strategy is "weighted" (weighted sum of normalized scores), "rrf"
+	// (Reciprocal Rank Fusion) or "linear" (a logistic model whose weights
+	// and bias are fitted elsewhere and must be given).
+	Strategy string `json:"strategy"`
+	// Normalize is how "weighted" makes the signals comparable: "minmax",
+	// "zscore" or "fixed" (fixed mappings that do not depend on the other
+	// candidates). "linear" always uses "fixed", so that its weights keep
+	// their meaning from one candidate set to the next.
+	Normalize string       `json:"normalize"`
+	Weights   SignalScores `json:"weights"`        // Weight of each signal (all zero = 0.7/0.2/0.1, except for "linear")
+	Bias      *float64     `json:"bias,omitempty"` // Intercept of the "linear" model (required by it)
+	RRFK      float64      `json:"rrf_k"`          // Rank offset of RRF (0 = 60)
+}
+
+// DefaultFusionOptions returns the default fusion settings.
+func DefaultFusionOptions() FusionOptions {
+	return FusionOptions{
+		Strategy:  "weighted",
+		Normalize: "minmax",
+		Weights:   SignalScores{Embedding: 0.7, Keyword: 0.2, Path: 0.1},
+		RRFK:      60,
+	}
+}
+
+// withDefaults fills unset fields from DefaultFusionOptions.
+func (o FusionOptions) withDefaults() FusionOptions {
+	d := DefaultFusionOptions()
+	if o.Strategy == "" {
+		o.Strategy = d.Strategy
+	}
+	if o.Normalize == "" {
+		o.Normalize = d.Normalize
+	}
+	if o.Weights == (SignalScores{}) && o.Strategy != "linear" {
+		o.Weights = d.Weights // A linear model has no sensible default weights
+	}
+	if o.RRFK <= 0 {
+		o.RRFK = d.RRFK
+	}
+	return o
+}
+
+// Validate reports unknown strategies and normalizations, and a "linear"
+// strategy without its weights and bias.
+func (o FusionOptions) Validate() error {
+	o = o.withDefaults()
+	switch o.Strategy {
+	case "weighted", "rrf":
+	case "linear":
+		if o.Weights == (SignalScores{}) || o.Bias == nil {
+			return fmt.Errorf("the linear fusion strategy needs explicit weights and bias")
+		}
+	default:
+		return fmt.Errorf("unknown fusion strategy %q (expected 'weighted', 'rrf' or 'linear')", o.Strategy)
+	}
+	switch o.Normalize {
+	case "minmax", "zscore", "fixed":
+	default:
+		return fmt.Errorf("unknown score normalization %q (expected 'minmax', 'zscore' or 'fixed')", o.Normalize)
+	}
+	return nil
+}
+
+// LoadFusionOptions reads fusion settings from a JSON file such as
+//
+//	{"strategy": "linear", "weights": {"embedding": 4.2, "keyword": 2.9, "path": 0.8}, "bias": -3.1}
+//
+// Fields left out keep their defaults, and so do signals left out of weights,
+// except that a linear model's weights start at zero.
+func LoadFusionOptions(path string) (FusionOptions, error) {
+	var opts FusionOptions
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return opts, err
+	}
+	var strategy struct {
+		Strategy string `json:"strategy"`
+	}
+	if err := json.Unmarshal(data, &strategy); err != nil {
+		return opts, fmt.Errorf("error reading fusion config %s: %w", path, err)
+	}
+	if strategy.Strategy != "linear" {
+		opts.Weights = DefaultFusionOptions().Weights
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&opts); err != nil {
+		return opts, fmt.Errorf("error reading fusion config %s: %w", path, err)
+	}
+	return opts, opts.Validate()
+}
+
+// ParseWeights parses signal weights such as "embedding=0.6,keyword=0.3,path=0.1"
+// into weights. Signals that are not mentioned keep their value.
+func ParseWeights(value string, weights *SignalScores) error {
+	for _, part := range strings.Split(value, ",") {
+		name, number, ok := strings.Cut(strings.TrimSpace(part), "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !ok || !isSignal(name) {
+			return fmt.Errorf("invalid weight %q (expected signal=weight with signal one of %s)", part, strings.Join(signalNames, ", "))
+		}
+		weight, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+		if err != nil {
+			return fmt.Errorf("invalid weight %q: %w", part, err)
+		}
+		weights.set(name, weight)
+	}
+	return nil
+}
+
+// isSignal reports whether name is one of signalNames.
+func isSignal(name string) bool {
+	for _, signal := range signalNames {
+		if name == signal {
+			return true
+		}
+	}
+	return false
+}
+
+// Fuse computes the score of every file scored by the hybrid approach from
+// its raw signal scores, filling in the normalized scores, contributions and
+// ranks. Min-max, z-score and RRF compare each file with the others, so
+// callers that score files in several passes (watch mode) fuse the whole set
+// again afterwards. Other files are left as they are.
+func Fuse(files []FileInfo, opts FusionOptions) {
+	opts = opts.withDefaults()
+
+	var fused []int
+	for i := range files {
+		if files[i].Breakdown != nil && files[i].Breakdown.Approach == "hybrid" {
+			breakdown := *files[i].Breakdown // Copies of the file may share the breakdown; leave theirs alone
+			files[i].Breakdown = &breakdown
+			fused = append(fused, i)
+		}
+	}
+	if len(fused) == 0 {
+		return
+	}
+
+	for _, name := range signalNames {
+		raw := make([]float64, len(fused))
+		for j, i := range fused {
+			raw[j] = files[i].Breakdown.Raw.get(name)
+		}
+		normalized := normalizeSignal(name, raw, opts)
+		ranks := signalRanks(raw)
+		for j, i := range fused {
+			files[i].Breakdown.Normalized.set(name, normalized[j])
+			files[i].Breakdown.Contribution.set(name, opts.Weights.get(name)*normalized[j])
+			files[i].Breakdown.Ranks.set(name, ranks[j])
+		}
+	}
+
+	for _, i := range fused {
+		c := files[i].Breakdown.Contribution
+		score := c.Embedding + c.Keyword + c.Path
+		if opts.Strategy == "linear" {
+			bias := 0.0 // Validate requires one; unvalidated options fall back to no intercept
+			if opts.Bias != nil {
+				bias = *opts.Bias
+			}
+			score = 1 / (1 + math.Exp(-(bias + score)))
+		}
+		files[i].Score = score
+	}
+}
+
+// singleSignalBreakdown describes the score of an approach that ranks files
+// by one signal, named like the approach; the score is the raw signal.
+func singleSignalBreakdown(signal string, score float64, rank int) *ScoreBreakdown {
+	breakdown := &ScoreBreakdown{Approach: signal}
+	breakdown.Raw.set(signal, score)
+	breakdown.Normalized.set(signal, fixedNormalization(signal, score))
+	breakdown.Contribution.set(signal, score)
+	breakdown.Ranks.set(signal, rank)
+	return breakdown
+}
+
+// signalRanks returns the 1-based rank of each positive score among them,
+// best first, and 0 for the others.
+func signalRanks(raw []float64) []int {
+	order := make([]int, 0, len(raw))
+	for i, value := range raw {
+		if value > 0 {
+			order = append(order, i)
+		}
+	}
+	sort.SliceStable(order, func(a, b int) bool { return raw[order[a]] > raw[order[b]] })
+	ranks := make([]int, len(raw))
+	for rank, i := range order {
+		ranks[i] = rank + 1
+	}
+	return ranks
+}
+
+// normalizeSignal maps the raw scores of one signal onto a common scale.
+func normalizeSignal(name string, raw []float64, opts FusionOptions) []float64 {
+	normalized := make([]float64, len(raw))
+	switch {
+	case opts.Strategy == "rrf":
+		// 1/(k+rank) for the files that have the signal
+		for i, rank := range signalRanks(raw) {
+			if rank > 0 {
+				normalized[i] = 1 / (opts.RRFK + float64(rank))
+			}
+		}
+
+	case opts.Strategy == "linear" || opts.Normalize == "fixed":
+		for i, value := range raw {
+			normalized[i] = fixedNormalization(name, value)
+		}
+
+	case opts.Normalize == "zscore":
+		// Standard scores, mapped into (0, 1) with the normal CDF so that
+		// fused scores stay positive and comparable with the other modes
+		var mean, variance float64
+		for _, value := range raw {
+			mean += value
+		}
+		mean /= float64(len(raw))
+		for _, value := range raw {
+			variance += (value - mean) * (value - mean)
+		}
+		stddev := math.Sqrt(variance / float64(len(raw)))
+		for i, value := range raw {
+			z := 0.0
+			if stddev > 0 {
+				z = (value - mean) / stddev
+			}
+			normalized[i] = 0.5 * (1 + math.Erf(z/math.Sqrt2))
+		}
+
+	default: // minmax
+		low, high := math.Inf(1), math.Inf(-1)
+		for _, value := range raw {
+			low, high = min(low, value), max(high, value)
+		}
+		for i, value := range raw {
+			switch {
+			case high > low:
+				normalized[i] = (value - low) / (high - low)
+			case value > 0:
+				normalized[i] = 1 // Every file scores the same
+			}
+		}
+	}
+	return normalized
+}
+
+// keywordScoreMidpoint is the BM25F score that the fixed normalization maps
+// to 0.5. A fixed midpoint, rather than normalizing by the best match, keeps
+// scores comparable between runs over different candidate sets.
+const keywordScoreMidpoint = 5.0
+
+// fixedNormalization maps a raw signal score onto [0, 1] without looking at
+// the other candidates, keeping scores comparable between runs.
+func fixedNormalization(name string, value float64) float64 {
+	switch name {
+	case "keyword":
+		// BM25F's open range, with keywordScoreMidpoint counting as 0.5
+		return value / (value + keywordScoreMidpoint)
+	case "path":
+		return min(value, 1)
+	default:
+		return max(value, 0) // Cosine similarity; opposite directions count as unrelated
+	}
+}
+
+// String formats the breakdown for logs, e.g.
+// "embedding 0.612 (0.428), keyword 0.800 (0.160), path 0.000 (0.000)": each
+// signal's normalized score and, in parentheses, its contribution.
+func (b ScoreBreakdown) String() string {
+	var parts []string
+	for _, name := range signalNames {
+		parts = append(parts, fmt.Sprintf("%s %.3f (%.3f)", name, b.Normalized.get(name), b.Contribution.get(name)))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,66 @@
+package relevance
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLinearFusionNeedsWeightsAndBias(t *testing.T) {
+	bias := -1.0
+	tests := []struct {
+		name    string
+		opts    FusionOptions
+		wantErr bool
+	}{
+		{"weights and bias", FusionOptions{Strategy: "linear", Weights: SignalScores{Keyword: 2}, Bias: &bias}, false},
+		{"zero bias", FusionOptions{Strategy: "linear", Weights: SignalScores{Keyword: 2}, Bias: new(float64)}, false},
+		{"no bias", FusionOptions{Strategy: "linear", Weights: SignalScores{Keyword: 2}}, true},
+		{"no weights", FusionOptions{Strategy: "linear", Bias: &bias}, true},
+		{"weighted defaults", FusionOptions{Strategy: "weighted"}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.opts.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate() = %v, want error %t", tt.name, err, tt.wantErr)
+		}
+	}
+
+	files := []FileInfo{{Path: "a.go", Breakdown: &ScoreBreakdown{Approach: "hybrid", Raw: SignalScores{Keyword: 5}}}}
+	Fuse(files, tests[0].opts)
+	// sigmoid(-1 + 2 × 5/(5+5))
+	if want := 0.5; math.Abs(files[0].Score-want) > 1e-9 {
+		t.Errorf("linear score = %v, want %v", files[0].Score, want)
+	}
+}
+
+func TestLoadFusionOptions(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	opts, err := LoadFusionOptions(write("weighted.json", `{"weights": {"keyword": 0.5}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (SignalScores{Embedding: 0.7, Keyword: 0.5, Path: 0.1}); opts.Weights != want {
+		t.Errorf("weighted weights = %+v, want %+v", opts.Weights, want)
+	}
+
+	opts, err = LoadFusionOptions(write("linear.json", `{"strategy": "linear", "weights": {"keyword": 2.9}, "bias": -3.1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (SignalScores{Keyword: 2.9}); opts.Weights != want || opts.Bias == nil || *opts.Bias != -3.1 {
+		t.Errorf("linear weights = %+v, bias %v, want %+v and -3.1", opts.Weights, opts.Bias, want)
+	}
+
+	if _, err := LoadFusionOptions(write("nobias.json", `{"strategy": "linear", "weights": {"keyword": 2.9}}`)); err == nil {
+		t.Error("linear config without a bias loaded without error")
+	}
+}
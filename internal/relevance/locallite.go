@@ -0,0 +1,139 @@
+package relevance
+
+import (
+	"context"
+	"hash/fnv"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+)
+
+// LocalLiteProvider is the name of the built-in embedding provider, which
+// needs no model server or API.
+const LocalLiteProvider = "local-lite"
+
+// localLiteFeatures is the size of unprojected local-lite vectors, into
+// which the term hashes are folded.
+const localLiteFeatures = 4096
+
+// localLiteFieldWeights boost terms from paths and declared names over
+// terms from comments and code, like the BM25F field weights do.
+var localLiteFieldWeights = [numFields]float64{FieldPath: 2.0, FieldSymbols: 2.0, FieldComments: 1.0, FieldBody: 1.0}
+
+// LocalLiteEmbeddingAdapter embeds texts in-process as hashed TF-IDF
+// vectors, so embedding-based relevance works without a network or a model.
+// Terms are split the same way as for the keyword index (camelCase,
+// snake_case, ...), weighted by log term frequency and by their inverse
+// document frequency among the indexed files, and hashed into a fixed number
+// of features with a random sign, or randomly projected onto Dimensions
+// dimensions. The vectors only capture shared vocabulary, not meaning, but
+// are deterministic for a given set of files.
+type LocalLiteEmbeddingAdapter struct {
+	Index      *Index    // Files the document frequencies come from; it must not change while embedding
+	Dimensions int       // Size of the vectors when projected (0 = localLiteFeatures hashed features, unprojected)
+	Analyzer   *Analyzer // Turns queries into weighted terms (nil = DefaultAnalyzer)
+}
+
+// GenerateEmbedding embeds a text. Chunk texts start with the file path on
+// their own line, and their comments and declarations are told apart from
+// the code; other texts, such as queries, are analyzed like keyword queries,
+// synonyms included.
+func (a *LocalLiteEmbeddingAdapter) GenerateEmbedding(ctx context.Context, text string) ([]float64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Weighted term frequencies
+	freqs := make(map[string]float64)
+	if filePath, content, ok := strings.Cut(text, "\n"); ok {
+		for field, terms := range extractFields(filePath, []byte(content)) {
+			for _, term := range terms {
+				freqs[term] += localLiteFieldWeights[field]
+			}
+		}
+	} else {
+		for _, term := range analyzerOrDefault(a.Analyzer).Analyze(text) {
+			freqs[term.Term] += term.Weight
+		}
+	}
+
+	// Hash the weighted terms; 64-bit hashes practically never collide
+	weights := make(map[uint64]float64, len(freqs))
+	for term, tf := range freqs {
+		h := fnv.New64a()
+		h.Write([]byte(term))
+		weights[h.Sum64()] += (1 + math.Log(tf)) * a.idf(term)
+	}
+
+	// Sum in a fixed order so that equal texts get bit-identical vectors
+	hashes := slices.Sorted(maps.Keys(weights))
+	if a.Dimensions > 0 {
+		return normalizeVector(project(hashes, weights, a.Dimensions)), nil
+	}
+	features := make([]float64, localLiteFeatures)
+	for _, hash := range hashes {
+		weight := weights[hash]
+		if hash>>63 == 1 {
+			weight = -weight // Random signs keep collisions from adding up
+		}
+		features[hash%localLiteFeatures] += weight
+	}
+	return normalizeVector(features), nil
+}
+
+// idf returns the inverse document frequency of a term among the indexed
+// files, in the BM25 form. Terms found in no file get the highest weight.
+func (a *LocalLiteEmbeddingAdapter) idf(term string) float64 {
+	if a.Index == nil || a.Index.Len() == 0 {
+		return 1
+	}
+	n := float64(a.Index.Len())
+	df := float64(a.Index.DocFreq(term))
+	return math.Log(1 + (n-df+0.5)/(df+0.5))
+}
+
+// project maps the weights of the hashed terms onto dims dimensions with a fixed random
+// projection: each term adds or subtracts its weight on every dimension,
+// with signs derived from the term hash and the dimension number. It
+// approximately keeps the angles between vectors (Johnson-Lindenstrauss)
+// without storing a matrix, and unlike folding the hashes into fewer
+// features, terms do not collide.
+func project(hashes []uint64, weights map[uint64]float64, dims int) []float64 {
+	projected := make([]float64, dims)
+	for _, hash := range hashes {
+		for j := range projected {
+			if splitmix64(hash+uint64(j))&1 == 0 {
+				projected[j] += weights[hash]
+			} else {
+				projected[j] -= weights[hash]
+			}
+		}
+	}
+	return projected
+}
+
+// splitmix64 scrambles x into a well-mixed 64-bit value.
+func splitmix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+// normalizeVector scales v to unit length in place and returns it. A zero
+// vector is returned as is.
+func normalizeVector(v []float64) []float64 {
+	var norm float64
+	for _, x := range v {
+		norm += x * x
+	}
+	if norm == 0 {
+		return v
+	}
+	norm = math.Sqrt(norm)
+	for i := range v {
+		v[i] /= norm
+	}
+	return v
+}
@@ -0,0 +1,164 @@
+package relevance
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/waqasraz/code-context/internal/source"
+)
+
+// testCorpus returns a small project in memory, and its file paths.
+func testCorpus(t *testing.T) (*source.MemFS, []string) {
+	t.Helper()
+	files := map[string]string{
+		"auth/login.go": `package auth
+
+// Login checks a user's password and starts a session.
+func Login(user string, password string) (*Session, error) {
+	return startSession(user)
+}
+`,
+		"auth/session.go": `package auth
+
+// Session is a logged in user.
+type Session struct{ Token string }
+
+func startSession(user string) (*Session, error) { return &Session{Token: user}, nil }
+`,
+		"db/repository.go": `package db
+
+// UserRepository stores users in the database.
+type UserRepository struct{}
+
+func (r *UserRepository) FindUser(name string) error { return nil }
+`,
+		"render/template.go": `package render
+
+// Render writes an HTML page from a template.
+func Render(page string) string { return "<html>" + page + "</html>" }
+`,
+		"README.md": "# Example\n\nA service with login, storage and rendering.\n",
+	}
+	fsys := source.NewMemFS()
+	var paths []string
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, name := range []string{"README.md", "auth/login.go", "auth/session.go", "db/repository.go", "render/template.go"} {
+		if err := fsys.AddFile(name, []byte(files[name]), 0o644, modTime); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, name)
+	}
+	return fsys, paths
+}
+
+func TestLocalLiteVectorsAreDeterministic(t *testing.T) {
+	fsys, paths := testCorpus(t)
+	content, err := fsys.ReadFile("auth/login.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	texts := []string{"auth/login.go\n" + string(content), "where is the user session started"}
+
+	for _, dims := range []int{0, 64} {
+		opts := EmbeddingOptions{Provider: LocalLiteProvider, FS: fsys, CandidateFiles: paths, Dimensions: dims}
+		var runs [][][]float64
+		for range 2 {
+			// A new adapter builds its own index of the files each run
+			adapter, err := NewEmbeddingProvider(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			vectors, err := GenerateEmbeddings(context.Background(), adapter, texts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			runs = append(runs, vectors)
+		}
+		if !reflect.DeepEqual(runs[0], runs[1]) {
+			t.Errorf("dims %d: vectors differ between runs", dims)
+		}
+		wantLen := dims
+		if dims == 0 {
+			wantLen = localLiteFeatures
+		}
+		for i, v := range runs[0] {
+			if len(v) != wantLen {
+				t.Errorf("dims %d: vector %d has %d dimensions, want %d", dims, i, len(v), wantLen)
+			}
+		}
+	}
+}
+
+func TestLocalLiteRankingIsStable(t *testing.T) {
+	fsys, paths := testCorpus(t)
+	opts := EmbeddingOptions{
+		Provider:        LocalLiteProvider,
+		Query:           "user login session",
+		FS:              fsys,
+		CandidateFiles:  paths,
+		MaxFilesToCheck: 10,
+	}
+
+	var rankings [][]string
+	for range 3 {
+		files, err := IdentifyRelevantFilesWithEmbeddings(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ranking []string
+		for _, f := range files {
+			ranking = append(ranking, f.Path)
+		}
+		rankings = append(rankings, ranking)
+	}
+	for _, ranking := range rankings[1:] {
+		if !reflect.DeepEqual(ranking, rankings[0]) {
+			t.Errorf("ranking = %v, want %v as in the first run", ranking, rankings[0])
+		}
+	}
+	if len(rankings[0]) < 2 || rankings[0][0] != "auth/login.go" || rankings[0][1] != "auth/session.go" {
+		t.Errorf("ranking = %v, want auth/login.go then auth/session.go first", rankings[0])
+	}
+	for _, path := range rankings[0] {
+		if path == "render/template.go" {
+			t.Errorf("ranking %v includes a file sharing no term with the query", rankings[0])
+		}
+	}
+}
+
+func TestEqualScoresRankByPath(t *testing.T) {
+	fsys := source.NewMemFS()
+	paths := []string{"c/limiter.go", "b/limiter.go", "a/limiter.go"}
+	for _, name := range paths {
+		if err := fsys.AddFile(name, []byte("package limiter\n\n// Limit throttles requests.\nfunc Limit() {}\n"), 0o644, time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	opts := EmbeddingOptions{
+		Provider:        LocalLiteProvider,
+		Query:           "limiter throttles requests",
+		FS:              fsys,
+		CandidateFiles:  paths,
+		MaxFilesToCheck: 10,
+	}
+
+	want := []string{"a/limiter.go", "b/limiter.go", "c/limiter.go"}
+	for name, identify := range map[string]func(EmbeddingOptions) ([]FileInfo, error){
+		"embedding": IdentifyRelevantFilesWithEmbeddings,
+		"hybrid":    IdentifyRelevantFilesWithHybridApproach,
+	} {
+		files, err := identify(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ranking []string
+		for _, f := range files {
+			ranking = append(ranking, f.Path)
+		}
+		if !reflect.DeepEqual(ranking, want) {
+			t.Errorf("%s ranking = %v, want %v", name, ranking, want)
+		}
+	}
+}
@@ -1,26 +1,50 @@
 package relevance
 
 import (
-	"bufio"
 	"fmt"
+	"io/fs"
 	"os"
-	"path/filepath"
-	"strings"
-	"unicode"
+	"sort"
+
+	"github.com/waqasraz/code-context/internal/walker"
 )
 
 // FileInfo represents information about a file and its relevance score
 type FileInfo struct {
-	Path  string
-	Score float64
+	Path   string
+	Score  float64
+	Meta   walker.Metadata // Walker metadata for the file, when it was provided
+	Module string          // Path of the module owning the file, when modules were detected
+
+	// Matches are the line ranges that matched the query best, best first.
+	// Only the embedding-based approaches fill them in.
+	Matches []LineRange
+
+	// Breakdown shows how the file's score was made from the signals.
+	Breakdown *ScoreBreakdown
+
+	// Judgement is the LLM's grade of the file, when the files were
+	// reranked and the file was among those judged.
+	Judgement *Judgement
+
+	// Explanation gathers the details above, the query terms found in the
+	// file and the file's final rank. Explain fills it in.
+	Explanation *Explanation
 }
 
 // Options configures the relevance identification process
 type Options struct {
-	Query           string   // The user query
-	TargetPath      string   // The root path of the search
-	CandidateFiles  []string // Potential files to analyze
-	MaxFilesToCheck int      // Maximum number of files to return
+	Query           string                     // The user query
+	TargetPath      string                     // The root path of the search
+	FS              fs.FS                      // Files to read (nil reads from TargetPath on disk)
+	CandidateFiles  []string                   // Potential files to analyze
+	CandidateMeta   map[string]walker.Metadata // Optional walker metadata by candidate path
+	MaxFilesToCheck int                        // Maximum number of files to return
+
+	CandidateModules  map[string]string // Optional owning module path by candidate path
+	MaxFilesPerModule int               // Maximum number of files to return per module (0 = no limit)
+	Index             *Index            // Optional lexical index holding the candidates (nil indexes them)
+	Analyzer          *Analyzer         // Turns the query into search terms (nil = DefaultAnalyzer)
 }
 
 // DefaultOptions returns default configuration values
@@ -37,150 +61,112 @@ func IdentifyRelevantFiles(opts Options) ([]FileInfo, error) {
 		opts.MaxFilesToCheck = DefaultOptions().MaxFilesToCheck
 	}
 
-	// Extract keywords from the query for basic keyword matching
-	keywords := extractKeywords(opts.Query)
-	if len(keywords) == 0 {
+	// Tokenize the query the same way files are indexed
+	terms := analyzerOrDefault(opts.Analyzer).Analyze(opts.Query)
+	if len(terms) == 0 {
 		return nil, fmt.Errorf("could not extract meaningful keywords from query")
 	}
 
-	// Score each file based on keyword matching
-	var scoredFiles []FileInfo
-	for _, filePath := range opts.CandidateFiles {
-		score, err := scoreFile(filepath.Join(opts.TargetPath, filePath), keywords)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: Error scoring file %s: %v\n", filePath, err)
-			continue
-		}
+	// Rank the candidates with BM25F
+	fsys := sourceFS(opts.FS, opts.TargetPath)
+	index := opts.Index
+	if index == nil {
+		index = BuildIndex(fsys, opts.CandidateFiles)
+	}
+	hits := index.Search(terms, searchLimit(opts.MaxFilesToCheck, opts.MaxFilesPerModule, opts.Index != nil))
 
-		if score > 0 {
-			scoredFiles = append(scoredFiles, FileInfo{
-				Path:  filePath,
-				Score: score,
-			})
+	candidates := make(map[string]bool, len(opts.CandidateFiles))
+	for _, filePath := range opts.CandidateFiles {
+		candidates[filePath] = true
+	}
+	var scoredFiles []FileInfo
+	for _, hit := range hits {
+		if !candidates[hit.Path] {
+			continue // A shared index may hold files that are not candidates
 		}
+		scoredFiles = append(scoredFiles, FileInfo{
+			Path:      hit.Path,
+			Score:     hit.Score,
+			Meta:      opts.CandidateMeta[hit.Path],
+			Module:    opts.CandidateModules[hit.Path],
+			Breakdown: singleSignalBreakdown("keyword", hit.Score, len(scoredFiles)+1),
+		})
 	}
 
-	// Sort files by score (highest first)
-	sortFilesByScore(scoredFiles)
-
 	// Limit the number of files to return
-	maxFiles := opts.MaxFilesToCheck
-	if maxFiles > len(scoredFiles) {
-		maxFiles = len(scoredFiles)
-	}
-
-	return scoredFiles[:maxFiles], nil
+	return limitFiles(scoredFiles, opts.MaxFilesToCheck, opts.MaxFilesPerModule), nil
 }
 
-// extractKeywords extracts meaningful keywords from a query
-func extractKeywords(query string) []string {
-	// Split the query into words
-	words := strings.Fields(strings.ToLower(query))
-
-	// Filter out common words and very short words
-	var keywords []string
-	for _, word := range words {
-		// Clean the word of punctuation
-		word = strings.Map(func(r rune) rune {
-			if unicode.IsPunct(r) {
-				return -1 // Remove punctuation
-			}
-			return r
-		}, word)
-
-		if len(word) < 3 {
-			continue // Skip very short words
-		}
-
-		// Skip common words
-		if isCommonWord(word) {
-			continue
-		}
-
-		keywords = append(keywords, word)
+// searchLimit returns how many hits to request from the index. Per-module
+// limits and shared indexes need every hit, since the best maxFiles hits
+// may be dropped afterwards.
+func searchLimit(maxFiles int, perModule int, sharedIndex bool) int {
+	if perModule > 0 || sharedIndex {
+		return 0
 	}
-
-	return keywords
+	return maxFiles
 }
 
-// Common English words to filter out
-var commonWords = map[string]bool{
-	"the": true, "and": true, "for": true, "this": true, "that": true,
-	"are": true, "with": true, "what": true, "from": true, "how": true,
-	"where": true, "when": true, "who": true, "why": true, "which": true,
+// sourceFS returns fsys, or the directory at targetPath when fsys is nil.
+func sourceFS(fsys fs.FS, targetPath string) fs.FS {
+	if fsys != nil {
+		return fsys
+	}
+	return os.DirFS(targetPath)
 }
 
-// isCommonWord checks if a word is a common word
-func isCommonWord(word string) bool {
-	return commonWords[word]
+// TopFiles ranks scored files by score (ties by path) and keeps the first
+// maxFiles of them, at most perModule per module (0 = no per-module limit).
+// It lets callers that keep every score, such as watch mode, select the
+// files the Identify functions would have returned.
+func TopFiles(files []FileInfo, maxFiles int, perModule int) []FileInfo {
+	ranked := append([]FileInfo(nil), files...)
+	sortByScore(ranked)
+	return limitFiles(ranked, maxFiles, perModule)
 }
 
-// scoreFile scores a file based on how well it matches keywords
-func scoreFile(filePath string, keywords []string) (float64, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return 0, err
-	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-
-	var score float64
-	lineNum := 0
-
-	// Read through the file line by line
-	for scanner.Scan() {
-		lineNum++
-		line := strings.ToLower(scanner.Text())
-
-		// Check for each keyword
-		for _, keyword := range keywords {
-			if strings.Contains(line, keyword) {
-				// Score based on keyword occurrence and line position
-				// Higher scores for matches near the beginning of the file
-				score += 1.0 / (0.1 + float64(lineNum)/100.0)
-			}
+// sortByScore orders files by score, highest first, and files with the same
+// score by path, so that rankings do not change from run to run.
+func sortByScore(files []FileInfo) {
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].Score != files[j].Score {
+			return files[i].Score > files[j].Score
 		}
+		return files[i].Path < files[j].Path
+	})
+}
 
-		// Optional: stop after a certain number of lines to improve performance
-		if lineNum > 1000 {
+// limitFiles keeps the first maxFiles of the sorted files, taking at most
+// perModule files from each module (0 = no per-module limit), so a large
+// module cannot crowd the others out of the results.
+func limitFiles(files []FileInfo, maxFiles int, perModule int) []FileInfo {
+	var kept []FileInfo
+	perModuleCount := make(map[string]int)
+	for _, file := range files {
+		if len(kept) >= maxFiles {
 			break
 		}
-	}
-
-	if err := scanner.Err(); err != nil {
-		return 0, err
-	}
-
-	return score, nil
-}
-
-// sortFilesByScore sorts files by score in descending order
-func sortFilesByScore(files []FileInfo) {
-	// Sort files by score (highest first)
-	// This is a placeholder for a more sophisticated sorting algorithm
-	for i := 0; i < len(files); i++ {
-		for j := i + 1; j < len(files); j++ {
-			if files[i].Score < files[j].Score {
-				files[i], files[j] = files[j], files[i]
-			}
+		if perModule > 0 && perModuleCount[file.Module] >= perModule {
+			continue
 		}
+		perModuleCount[file.Module]++
+		kept = append(kept, file)
 	}
+	return kept
 }
 
-// ExtractQueryKeyword attempts to extract a single representative keyword from the query.
+// ExtractQueryKeyword picks a representative word of the query, for naming
+// output files: the longest word the default Analyzer keeps as a term of the
+// query itself (synonyms are not considered).
 func ExtractQueryKeyword(query string) string {
-	keywords := extractKeywords(query) // Reuse existing keyword extraction
-	if len(keywords) == 0 {
-		return "query" // Fallback keyword
-	}
-
-	// Simple heuristic: pick the longest keyword
-	longestKeyword := keywords[0]
-	for _, kw := range keywords {
-		if len(kw) > len(longestKeyword) {
-			longestKeyword = kw
+	keyword := ""
+	for _, term := range defaultAnalyzer.Analyze(query) {
+		if term.Weight == 1 && len(term.Word) > len(keyword) {
+			keyword = term.Word
 		}
 	}
-	return longestKeyword
+	if keyword == "" {
+		return "query" // Fallback keyword
+	}
+	return keyword
 }
@@ -0,0 +1,245 @@
+package relevance
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/waqasraz/code-context/internal/llm"
+)
+
+// MaxGrade is the best grade a file can get when reranking.
+const MaxGrade = 3
+
+// Judgement is what the LLM answered about a file when reranking.
+type Judgement struct {
+	Grade  int    `json:"grade"`  // 0 (unrelated) to MaxGrade (implements what the query asks about)
+	Reason string `json:"reason"` // Short justification given by the model
+}
+
+// RerankOptions controls the LLM rerank pass.
+type RerankOptions struct {
+	TopN         int // Best candidates judged by the LLM (0 = 20)
+	BatchSize    int // Files judged per LLM request (0 = 10)
+	PreviewLines int // First lines of each file shown to the LLM (0 = 40)
+	MinGrade     int // Judged files graded below this are dropped (0 keeps them all)
+}
+
+// DefaultRerankOptions returns the default rerank settings.
+func DefaultRerankOptions() RerankOptions {
+	return RerankOptions{TopN: 20, BatchSize: 10, PreviewLines: 40, MinGrade: 1}
+}
+
+// withDefaults fills unset fields from DefaultRerankOptions. MinGrade 0 is
+// kept.
+func (o RerankOptions) withDefaults() RerankOptions {
+	d := DefaultRerankOptions()
+	if o.TopN <= 0 {
+		o.TopN = d.TopN
+	}
+	if o.BatchSize <= 0 {
+		o.BatchSize = d.BatchSize
+	}
+	if o.PreviewLines <= 0 {
+		o.PreviewLines = d.PreviewLines
+	}
+	return o
+}
+
+// Rerank asks the LLM to grade the first TopN files, which must be sorted
+// best first, and reorders them by grade; files with the same grade keep
+// their order. Judged files graded below MinGrade are dropped. Files the
+// model could not judge follow the judged ones, and files beyond TopN follow
+// unchanged. Files that already have a Judgement (from an earlier pass over
+// unchanged files) are not sent again.
+func Rerank(provider llm.Provider, query string, fsys fs.FS, files []FileInfo, opts RerankOptions) ([]FileInfo, error) {
+	opts = opts.withDefaults()
+	completer, ok := provider.(llm.Completer)
+	if !ok {
+		return nil, fmt.Errorf("LLM provider %T cannot rerank files (configure --llm-provider)", provider)
+	}
+
+	top := append([]FileInfo(nil), files[:min(opts.TopN, len(files))]...)
+	var pending []int
+	for i := range top {
+		if top[i].Judgement == nil {
+			pending = append(pending, i)
+		}
+	}
+
+	// Judge the files in batches
+	failed := 0
+	for start := 0; start < len(pending); start += opts.BatchSize {
+		batch := pending[start:min(start+opts.BatchSize, len(pending))]
+		fmt.Printf("Reranking files %d-%d of %d with the LLM...\n", start+1, start+len(batch), len(pending))
+
+		var previews []string
+		for _, i := range batch {
+			previews = append(previews, filePreview(fsys, top[i], opts.PreviewLines))
+		}
+		answer, err := completer.Complete(rerankSystemPrompt, rerankPrompt(query, previews))
+		var judgements map[int]Judgement
+		if err == nil {
+			judgements, err = parseJudgements(answer, len(batch))
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Could not rerank %d files: %v\n", len(batch), err)
+			failed += len(batch)
+			continue
+		}
+		for n, i := range batch {
+			if judgement, ok := judgements[n+1]; ok {
+				top[i].Judgement = &judgement
+			}
+		}
+	}
+	if len(pending) > 0 && failed == len(pending) {
+		return nil, fmt.Errorf("no file could be reranked")
+	}
+
+	// Reorder by grade; files without a judgement come last
+	grade := func(file FileInfo) int {
+		if file.Judgement == nil {
+			return -1
+		}
+		return file.Judgement.Grade
+	}
+	sort.SliceStable(top, func(i, j int) bool { return grade(top[i]) > grade(top[j]) })
+
+	var reranked []FileInfo
+	for _, file := range top {
+		if file.Judgement != nil && file.Judgement.Grade < opts.MinGrade {
+			fmt.Printf("Rerank dropped %s (grade %d: %s)\n", file.Path, file.Judgement.Grade, file.Judgement.Reason)
+			continue
+		}
+		reranked = append(reranked, file)
+	}
+	return append(reranked, files[len(top):]...), nil
+}
+
+// rerankSystemPrompt sets the role of the model when reranking.
+const rerankSystemPrompt = "You are an expert software engineer who judges how relevant source files are to a question about their codebase."
+
+// rerankPrompt asks for a grade per numbered file preview.
+func rerankPrompt(query string, previews []string) string {
+	var prompt strings.Builder
+	fmt.Fprintf(&prompt, `QUESTION: %s
+
+Grade how relevant each of the files below is to the question:
+3 = implements or defines what the question is about
+2 = directly uses, configures or extends it
+1 = only mentions it (imports, wiring, boilerplate, unrelated tests)
+0 = unrelated
+
+Answer with exactly one line per file, in the form
+<number>: <grade> - <reason of at most 12 words>
+and nothing else.
+
+`, query)
+	for i, preview := range previews {
+		fmt.Fprintf(&prompt, "[%d] %s\n", i+1, preview)
+	}
+	return prompt.String()
+}
+
+// previewLineLength is the length at which preview lines are cut.
+const previewLineLength = 160
+
+// filePreview shows a file compactly: its path, the symbols it declares, its
+// first lines and, when the embedding search found one further down, the
+// start of its best matching range.
+func filePreview(fsys fs.FS, file FileInfo, lines int) string {
+	var preview strings.Builder
+	preview.WriteString(file.Path + "\n")
+
+	content, err := fs.ReadFile(fsys, filepath.ToSlash(file.Path))
+	if err != nil {
+		fmt.Fprintf(&preview, "(could not read file: %v)\n", err)
+		return preview.String()
+	}
+	fileLines := strings.Split(string(content), "\n")
+
+	if symbols := declaredSymbols(fileLines, 30); len(symbols) > 0 {
+		fmt.Fprintf(&preview, "Symbols: %s\n", strings.Join(symbols, ", "))
+	}
+
+	writeLines := func(start, end int) {
+		preview.WriteString("```\n")
+		for _, line := range fileLines[start:min(end, len(fileLines))] {
+			if len(line) > previewLineLength {
+				line = line[:previewLineLength] + "..."
+			}
+			preview.WriteString(line + "\n")
+		}
+		preview.WriteString("```\n")
+	}
+	writeLines(0, lines)
+	if len(file.Matches) > 0 && file.Matches[0].Start > lines {
+		match := file.Matches[0]
+		fmt.Fprintf(&preview, "Best matching lines (%s):\n", match)
+		writeLines(match.Start-1, min(match.End, match.Start-1+lines/2))
+	}
+	return preview.String()
+}
+
+// declaredSymbols returns the names declared in a file, in order, at most
+// limit of them.
+func declaredSymbols(lines []string, limit int) []string {
+	var symbols []string
+	seen := make(map[string]bool)
+	for _, line := range lines {
+		for _, pattern := range declarationPatterns {
+			for _, m := range pattern.FindAllStringSubmatch(line, -1) {
+				if !seen[m[1]] {
+					seen[m[1]] = true
+					symbols = append(symbols, m[1])
+					if len(symbols) == limit {
+						return symbols
+					}
+				}
+			}
+		}
+	}
+	return symbols
+}
+
+// judgementLine matches "3: 2 - reason", "[3] 2 reason" and similar lines.
+var judgementLine = regexp.MustCompile(`^\s*\[?(\d+)\]?\s*[:.)\-]?\s*\**\s*([0-9])\b\s*\**\s*[-–:]?\s*(.*)$`)
+
+// parseJudgements reads the grades of the files numbered 1 to count from a
+// model's answer. Grades out of range are clamped; files the answer does not
+// mention are left out.
+func parseJudgements(answer string, count int) (map[int]Judgement, error) {
+	judgements := make(map[int]Judgement)
+	for _, line := range strings.Split(answer, "\n") {
+		m := judgementLine.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		n, _ := strconv.Atoi(m[1])
+		grade, _ := strconv.Atoi(m[2])
+		if n < 1 || n > count {
+			continue
+		}
+		if _, ok := judgements[n]; !ok {
+			judgements[n] = Judgement{Grade: min(grade, MaxGrade), Reason: strings.TrimSpace(m[3])}
+		}
+	}
+	if len(judgements) == 0 {
+		return nil, fmt.Errorf("no grades found in the answer %q", truncate(answer, 200))
+	}
+	return judgements, nil
+}
+
+// truncate shortens s to at most n bytes for messages.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
@@ -0,0 +1,49 @@
+package relevance
+
+import "testing"
+
+func TestStem(t *testing.T) {
+	// Word and stem pairs from Porter's "An algorithm for suffix stripping"
+	// and its reference vocabulary
+	tests := []struct{ word, stem string }{
+		// Step 1a
+		{"caresses", "caress"}, {"ponies", "poni"}, {"ties", "ti"}, {"caress", "caress"}, {"cats", "cat"},
+		// Step 1b
+		{"feed", "feed"}, {"agreed", "agre"}, {"plastered", "plaster"}, {"bled", "bled"},
+		{"motoring", "motor"}, {"sing", "sing"}, {"conflated", "conflat"}, {"troubled", "troubl"},
+		{"sized", "size"}, {"hopping", "hop"}, {"tanned", "tan"}, {"falling", "fall"},
+		{"hissing", "hiss"}, {"fizzed", "fizz"}, {"failing", "fail"}, {"filing", "file"},
+		// Step 1c
+		{"happy", "happi"}, {"sky", "sky"},
+		// Step 2
+		{"relational", "relat"}, {"conditional", "condit"}, {"rational", "ration"},
+		{"valenci", "valenc"}, {"hesitanci", "hesit"}, {"digitizer", "digit"},
+		{"conformabli", "conform"}, {"radicalli", "radic"}, {"differentli", "differ"},
+		{"vileli", "vile"}, {"analogousli", "analog"}, {"vietnamization", "vietnam"},
+		{"predication", "predic"}, {"operator", "oper"}, {"feudalism", "feudal"},
+		{"decisiveness", "decis"}, {"hopefulness", "hope"}, {"callousness", "callous"},
+		{"formaliti", "formal"}, {"sensitiviti", "sensit"}, {"sensibiliti", "sensibl"},
+		// Step 3
+		{"triplicate", "triplic"}, {"formative", "form"}, {"formalize", "formal"},
+		{"electriciti", "electr"}, {"electrical", "electr"}, {"hopeful", "hope"}, {"goodness", "good"},
+		// Step 4
+		{"revival", "reviv"}, {"allowance", "allow"}, {"inference", "infer"}, {"airliner", "airlin"},
+		{"gyroscopic", "gyroscop"}, {"adjustable", "adjust"}, {"defensible", "defens"},
+		{"irritant", "irrit"}, {"replacement", "replac"}, {"adjustment", "adjust"},
+		{"dependent", "depend"}, {"adoption", "adopt"}, {"homologou", "homolog"},
+		{"communism", "commun"}, {"activate", "activ"}, {"angulariti", "angular"},
+		{"homologous", "homolog"}, {"effective", "effect"}, {"bowdlerize", "bowdler"},
+		// Step 5
+		{"probate", "probat"}, {"rate", "rate"}, {"cease", "ceas"}, {"controll", "control"}, {"roll", "roll"},
+		// Words this project cares about
+		{"generalizations", "gener"}, {"authentication", "authent"}, {"authenticated", "authent"},
+		{"repository", "repositori"}, {"user", "user"}, {"query", "queri"},
+		// Returned unchanged
+		{"go", "go"}, {"is", "is"}, {"utf8", "utf8"}, {"héllo", "héllo"}, {"Running", "Running"},
+	}
+	for _, tt := range tests {
+		if got := Stem(tt.word); got != tt.stem {
+			t.Errorf("Stem(%q) = %q, want %q", tt.word, got, tt.stem)
+		}
+	}
+}
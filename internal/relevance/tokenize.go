@@ -0,0 +1,91 @@
+package relevance
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Tokenize splits text into lowercase search terms. Identifiers are broken up
+// at camelCase, snake_case and kebab-case boundaries and between letters and
+// digits, so "parseHTTPRequest" yields "parse", "http" and "request"; the
+// joined identifier ("parsehttprequest") is kept as well so that exact
+// identifier matches score higher. Single characters and plain numbers are
+// dropped, and words are stemmed ("authenticated" and "authentication" both
+// match "authenticate"). Queries are tokenized the same way by an Analyzer.
+func Tokenize(text string) []string {
+	var terms []string
+	for _, word := range splitWords(text) {
+		parts := splitIdentifier(word)
+		for _, part := range parts {
+			if term, ok := normalizeTerm(part); ok {
+				terms = append(terms, term)
+			}
+		}
+		if len(parts) > 1 {
+			if term, ok := normalizeTerm(strings.Join(parts, "")); ok {
+				terms = append(terms, term)
+			}
+		}
+	}
+	return terms
+}
+
+// splitWords splits text into words: runs of letters, digits, underscores
+// and hyphens.
+func splitWords(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '-'
+	})
+}
+
+// splitIdentifier splits a word at case changes, letter/digit changes,
+// underscores and hyphens.
+func splitIdentifier(word string) []string {
+	runes := []rune(word)
+	var parts []string
+	start := 0
+	flush := func(end int) {
+		if end > start {
+			parts = append(parts, string(runes[start:end]))
+		}
+	}
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if r == '_' || r == '-' {
+			flush(i)
+			start = i + 1
+			continue
+		}
+		if i == start {
+			continue
+		}
+		prev := runes[i-1]
+		switch {
+		case unicode.IsLower(prev) && unicode.IsUpper(r): // parse|HTTP
+			flush(i)
+			start = i
+		case unicode.IsUpper(prev) && unicode.IsUpper(r) && i+1 < len(runes) && unicode.IsLower(runes[i+1]) &&
+			!(i+2 == len(runes) && runes[i+1] == 's'): // HTTP|Request, but not UR|Ls
+			flush(i)
+			start = i
+		case unicode.IsDigit(prev) != unicode.IsDigit(r): // utf|8, v|2
+			flush(i)
+			start = i
+		}
+	}
+	flush(len(runes))
+	return parts
+}
+
+// normalizeTerm lowercases and stems a term (see Stem). It reports false
+// for terms too short or too plain to be useful.
+func normalizeTerm(term string) (string, bool) {
+	term = strings.ToLower(term)
+	if len(term) < 2 {
+		return "", false
+	}
+	if strings.IndexFunc(term, func(r rune) bool { return !unicode.IsDigit(r) }) < 0 {
+		return "", false // Plain number
+	}
+	return Stem(term), true
+}
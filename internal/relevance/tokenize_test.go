@@ -0,0 +1,134 @@
+package relevance
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"", nil},
+		{"parseHTTPRequest", []string{"pars", "http", "request", "parsehttprequest"}},
+		{"user_name kebab-case", []string{"user", "name", "usernam", "kebab", "case", "kebabcas"}},
+		{"utf8 v2", []string{"utf", "utf8", "v2"}},
+		{"OAuth2Token", []string{"auth", "token", "oauth2token"}}, // "O|Auth", like "HTTP|Request"
+		{"parseURLs", []string{"pars", "url", "parseurl"}},
+		{"a b 42 1024 x1", []string{"x1"}},
+		{"Authenticated authentication", []string{"authent", "authent"}},
+		{"héllo wörld", []string{"héllo", "wörld"}},
+	}
+	for _, tt := range tests {
+		if got := Tokenize(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Tokenize(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestExtractFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		content string
+		want    [numFields][]string
+	}{
+		{
+			name: "go declarations and line comments",
+			path: "auth/session.go",
+			content: `package auth
+
+// Login starts a session
+func Login(user string) error { return nil } // trailing note
+`,
+			want: [numFields][]string{
+				FieldPath:     {"auth", "session", "go"},
+				FieldSymbols:  {"login"},
+				FieldComments: {"login", "start", "session", "trail", "note"},
+				FieldBody:     {"packag", "auth", "func", "login", "user", "string", "error", "return", "nil"},
+			},
+		},
+		{
+			name: "urls are not comments",
+			path: "client.js",
+			content: `const endpoint = "https://example.com/api" // the API
+fetch("http://a.io/x", "http://b.io/y")`,
+			want: [numFields][]string{
+				FieldPath:     {"client", "js"},
+				FieldSymbols:  {"endpoint"},
+				FieldComments: {"the", "api"},
+				FieldBody:     {"const", "endpoint", "http", "exampl", "com", "api", "fetch", "http", "io", "http", "io"},
+			},
+		},
+		{
+			name: "multi-line block comments",
+			path: "lib.c",
+			content: `int a; /* first
+spanning lines */ int b;
+/* one */ int c; /* two */`,
+			want: [numFields][]string{
+				FieldPath:     {"lib"},
+				FieldComments: {"first", "span", "line", "on", "two"},
+				FieldBody:     {"int", "int", "int"},
+			},
+		},
+		{
+			name: "python docstrings and hash comments",
+			path: "tools/report.py",
+			content: `def build_report(rows):
+    """Summarize the
+    monthly rows."""
+    return rows  # unchanged
+`,
+			want: [numFields][]string{
+				FieldPath:     {"tool", "report", "py"},
+				FieldSymbols:  {"build", "report", "buildreport"},
+				FieldComments: {"summar", "the", "monthli", "row", "unchang"},
+				FieldBody:     {"def", "build", "report", "buildreport", "row", "return", "row"},
+			},
+		},
+		{
+			name:    "markup comments",
+			path:    "docs/guide.md",
+			content: "# Setup <!-- hidden\nnote --> visible",
+			want: [numFields][]string{
+				FieldPath:     {"doc", "guid", "md"},
+				FieldComments: {"hidden", "note"},
+				FieldBody:     {"setup", "visibl"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		got := extractFields(tt.path, []byte(tt.content))
+		for field := range got {
+			if len(got[field]) == 0 && len(tt.want[field]) == 0 {
+				continue
+			}
+			if !reflect.DeepEqual(got[field], tt.want[field]) {
+				t.Errorf("%s: field %d = %q, want %q", tt.name, field, got[field], tt.want[field])
+			}
+		}
+	}
+}
+
+func TestNextCommentSkipsURLs(t *testing.T) {
+	tests := []struct {
+		line string
+		want int // Position of the comment, -1 for none
+	}{
+		{"x := 1 // note", 7},
+		{`u := "http://host/path"`, -1},
+		{`u := "http://host" // note`, 19},
+		{`u := "a://b" + "c://d"`, -1},
+		{"//:note", 0},
+	}
+	for _, tt := range tests {
+		if got, _, _ := nextComment(tt.line, cStyleComments); got != tt.want {
+			t.Errorf("nextComment(%q) = %d, want %d", tt.line, got, tt.want)
+		}
+	}
+	if pos, marker, end := nextComment("a /* b */ // c", cStyleComments); pos != 2 || marker != "/*" || end != "*/" {
+		t.Errorf("nextComment = %d, %q, %q, want the block comment first", pos, marker, end)
+	}
+}
@@ -0,0 +1,208 @@
+package relevance
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/waqasraz/code-context/internal/embedcache"
+	"github.com/waqasraz/code-context/internal/vectorindex"
+)
+
+// VectorIndexDir is the directory of the vector indexes inside a cache
+// directory, which counts them toward its size cap.
+const VectorIndexDir = embedcache.VectorsDir
+
+// VectorIndexPath returns where the vector index for the embedding model of
+// opts is kept inside a cache directory. Vectors of different models, or of
+// files chunked differently, cannot be compared and live in separate indexes.
+func VectorIndexPath(cacheDir string, opts EmbeddingOptions) string {
+	key := []string{strings.ToLower(opts.Provider), cacheModel(opts), opts.Chunking.withDefaults().CacheKey()}
+	sum := sha256.Sum256([]byte(strings.Join(key, "\x00")))
+	return filepath.Join(cacheDir, VectorIndexDir, hex.EncodeToString(sum[:8])+".hnsw")
+}
+
+// openVectors returns the vector index to use and where to save it ("" to
+// keep it in memory only). Local-lite vectors are kept in memory: they are
+// quick to rebuild, and saved ones would go stale as document frequencies
+// change.
+func openVectors(opts EmbeddingOptions) (*vectorindex.Index, string) {
+	indexPath := ""
+	if opts.Cache != nil && strings.ToLower(opts.Provider) != LocalLiteProvider {
+		indexPath = VectorIndexPath(opts.Cache.Dir(), opts)
+	}
+	if opts.Vectors != nil {
+		return opts.Vectors, indexPath
+	}
+	if indexPath == "" {
+		return vectorindex.New(vectorindex.Params{}), ""
+	}
+	vectors, err := vectorindex.Load(indexPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Rebuilding vector index: %v\n", err)
+		vectors = vectorindex.New(vectorindex.Params{})
+	} else {
+		opts.Cache.Touch(indexPath) // Keep the index in use when the cache evicts
+	}
+	return vectors, indexPath
+}
+
+// syncBatchChunks is the number of chunks collected from changed files
+// before they are embedded, bounding the texts held in memory.
+const syncBatchChunks = 1024
+
+// pendingFile is a changed file waiting for its chunks to be embedded.
+type pendingFile struct {
+	path   string
+	hash   string
+	chunks []Chunk
+}
+
+// syncVectors brings the vector index up to date with the candidate files.
+// Files whose content changed since they were indexed are chunked and
+// embedded again (unchanged chunks come from the embedding cache), and
+// indexed files that no longer exist are removed. Files that are not
+// candidates this time stay indexed for later runs. It returns the number of
+// files that were (re)indexed.
+func syncVectors(ctx context.Context, adapter EmbeddingAdapter, vectors *vectorindex.Index, fsys fs.FS, candidates []string, chunking ChunkOptions, batch BatchOptions) (int, error) {
+	updated := 0
+	var pending []pendingFile
+	pendingChunks := 0
+
+	// flush embeds the chunks of the pending files and indexes them
+	flush := func() error {
+		var texts []string
+		for _, file := range pending {
+			for _, chunk := range file.chunks {
+				texts = append(texts, chunk.Text)
+			}
+		}
+		embeddings, errs := embedTexts(ctx, adapter, texts, batch)
+
+		next := 0
+		for _, file := range pending {
+			var items []vectorindex.Item
+			var fileEmbeddings [][]float64
+			hash := file.hash
+			for _, chunk := range file.chunks {
+				if err := errs[next]; err != nil {
+					if hash != "" {
+						fmt.Fprintf(os.Stderr, "Warning: Error getting embedding for %s (%d-%d): %v\n", file.path, chunk.StartLine, chunk.EndLine, err)
+					}
+					hash = "" // Index what we have, but try again next time
+				} else {
+					items = append(items, vectorindex.Item{File: file.path, Start: chunk.StartLine, End: chunk.EndLine})
+					fileEmbeddings = append(fileEmbeddings, embeddings[next])
+				}
+				next++
+			}
+			if err := vectors.SetFile(file.path, hash, items, fileEmbeddings); err != nil {
+				return fmt.Errorf("error indexing %s: %w", file.path, err)
+			}
+			updated++
+		}
+		pending, pendingChunks = nil, 0
+		return ctx.Err()
+	}
+
+	isCandidate := make(map[string]bool, len(candidates))
+	for _, filePath := range candidates {
+		isCandidate[filePath] = true
+
+		content, err := fs.ReadFile(fsys, filepath.ToSlash(filePath))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Error reading file %s: %v\n", filePath, err)
+			continue
+		}
+		sum := sha256.Sum256(content)
+		hash := hex.EncodeToString(sum[:])
+		if indexed, ok := vectors.FileHash(filePath); ok && indexed == hash {
+			continue
+		}
+
+		chunks := ChunkFile(filePath, string(content), chunking)
+		pending = append(pending, pendingFile{path: filePath, hash: hash, chunks: chunks})
+		pendingChunks += len(chunks)
+		if pendingChunks >= syncBatchChunks {
+			if err := flush(); err != nil {
+				return updated, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return updated, err
+	}
+
+	for _, filePath := range vectors.Files() {
+		if isCandidate[filePath] {
+			continue
+		}
+		if _, err := fs.Stat(fsys, filepath.ToSlash(filePath)); errors.Is(err, fs.ErrNotExist) {
+			vectors.RemoveFile(filePath)
+		}
+	}
+	return updated, nil
+}
+
+// chunkMatch is the embedding score of a file and its best chunks.
+type chunkMatch struct {
+	score   float64
+	matches []LineRange
+}
+
+// vectorSearchLimit returns how many chunks to retrieve for a query. Files
+// without a chunk among them get no embedding score, so the limit leaves
+// room for several chunks per returned file and for the reordering done by
+// the hybrid approach.
+func vectorSearchLimit(maxFiles int, chunking ChunkOptions) int {
+	return max(500, maxFiles*chunking.TopK*10)
+}
+
+// vectorScores retrieves the chunks nearest to the query among the
+// candidates and aggregates their scores per file.
+func vectorScores(vectors *vectorindex.Index, queryEmbedding []float64, candidates []string, k int, chunking ChunkOptions) (map[string]chunkMatch, error) {
+	isCandidate := make(map[string]bool, len(candidates))
+	for _, filePath := range candidates {
+		isCandidate[filePath] = true
+	}
+	results, err := vectors.Search(queryEmbedding, k, func(file string) bool { return isCandidate[file] })
+	if err != nil {
+		return nil, err
+	}
+
+	ranges := make(map[string][]LineRange)
+	for _, r := range results {
+		ranges[r.File] = append(ranges[r.File], LineRange{Start: r.Start, End: r.End, Score: r.Score})
+	}
+	scores := make(map[string]chunkMatch, len(ranges))
+	for filePath, fileRanges := range ranges {
+		score, matches := aggregateChunkScores(fileRanges, chunking)
+		scores[filePath] = chunkMatch{score: score, matches: matches}
+	}
+	return scores, nil
+}
+
+// embedCandidates syncs the vector index with the candidates, saves it when
+// it changed and scores the candidates against the query.
+func embedCandidates(ctx context.Context, adapter EmbeddingAdapter, queryEmbedding []float64, fsys fs.FS, opts EmbeddingOptions) (map[string]chunkMatch, error) {
+	vectors, indexPath := openVectors(opts)
+	updated, err := syncVectors(ctx, adapter, vectors, fsys, opts.CandidateFiles, opts.Chunking, opts.Batch)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("Vector index: %d chunks, %d files updated\n", vectors.Len(), updated)
+	if indexPath != "" && vectors.Dirty() {
+		if err := vectors.Save(indexPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Could not save vector index: %v\n", err)
+		} else if err := opts.Cache.Refresh(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Could not evict from embedding cache: %v\n", err)
+		}
+	}
+	return vectorScores(vectors, queryEmbedding, opts.CandidateFiles, vectorSearchLimit(opts.MaxFilesToCheck, opts.Chunking), opts.Chunking)
+}
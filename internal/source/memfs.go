@@ -0,0 +1,188 @@
+package source
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MemFS is a read-only in-memory file system. Archives are loaded into one,
+// and tests can build a tree with AddFile instead of touching the disk.
+// Parent directories are created implicitly. A MemFS must not be modified
+// once it is being read.
+type MemFS struct {
+	entries map[string]*memEntry // By slash-separated path; "." is the root
+}
+
+// memEntry is a file or directory. It implements fs.FileInfo and fs.DirEntry.
+type memEntry struct {
+	name     string
+	data     []byte
+	mode     fs.FileMode
+	modTime  time.Time
+	children []string // Sorted child names, for directories
+}
+
+func (e *memEntry) Name() string               { return e.name }
+func (e *memEntry) Size() int64                { return int64(len(e.data)) }
+func (e *memEntry) Mode() fs.FileMode          { return e.mode }
+func (e *memEntry) ModTime() time.Time         { return e.modTime }
+func (e *memEntry) IsDir() bool                { return e.mode.IsDir() }
+func (e *memEntry) Sys() any                   { return nil }
+func (e *memEntry) Type() fs.FileMode          { return e.mode.Type() }
+func (e *memEntry) Info() (fs.FileInfo, error) { return e, nil }
+
+// NewMemFS returns an empty file system.
+func NewMemFS() *MemFS {
+	return &MemFS{entries: map[string]*memEntry{
+		".": {name: ".", mode: fs.ModeDir | 0o755},
+	}}
+}
+
+// cleanName converts an archive member name into a valid fs.FS path.
+func cleanName(name string) (string, error) {
+	name = path.Clean("/" + strings.ReplaceAll(name, "\\", "/"))
+	name = strings.TrimPrefix(name, "/")
+	if name == "" {
+		name = "."
+	}
+	if !fs.ValidPath(name) {
+		return "", fmt.Errorf("invalid path %q", name)
+	}
+	return name, nil
+}
+
+// AddFile adds a regular file, creating its parent directories.
+func (m *MemFS) AddFile(name string, data []byte, mode fs.FileMode, modTime time.Time) error {
+	name, err := cleanName(name)
+	if err != nil {
+		return err
+	}
+	if name == "." {
+		return fmt.Errorf("cannot add the root as a file")
+	}
+	if existing, ok := m.entries[name]; ok && existing.IsDir() {
+		return fmt.Errorf("%s already exists as a directory", name)
+	}
+	if err := m.addDir(path.Dir(name), modTime); err != nil {
+		return err
+	}
+
+	if _, ok := m.entries[name]; !ok {
+		m.addChild(path.Dir(name), path.Base(name))
+	}
+	m.entries[name] = &memEntry{name: path.Base(name), data: data, mode: mode.Perm(), modTime: modTime}
+	return nil
+}
+
+// AddDir adds a directory and its parents. Adding an existing directory
+// updates its modification time.
+func (m *MemFS) AddDir(name string, modTime time.Time) error {
+	name, err := cleanName(name)
+	if err != nil {
+		return err
+	}
+	if err := m.addDir(name, modTime); err != nil {
+		return err
+	}
+	m.entries[name].modTime = modTime
+	return nil
+}
+
+func (m *MemFS) addDir(name string, modTime time.Time) error {
+	if e, ok := m.entries[name]; ok {
+		if !e.IsDir() {
+			return fmt.Errorf("%s already exists as a file", name)
+		}
+		return nil
+	}
+	if err := m.addDir(path.Dir(name), modTime); err != nil {
+		return err
+	}
+	m.entries[name] = &memEntry{name: path.Base(name), mode: fs.ModeDir | 0o755, modTime: modTime}
+	m.addChild(path.Dir(name), path.Base(name))
+	return nil
+}
+
+// addChild inserts a name into a directory's sorted child list.
+func (m *MemFS) addChild(dir, name string) {
+	parent := m.entries[dir]
+	i := sort.SearchStrings(parent.children, name)
+	parent.children = append(parent.children, "")
+	copy(parent.children[i+1:], parent.children[i:])
+	parent.children[i] = name
+}
+
+// Open implements fs.FS.
+func (m *MemFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	e, ok := m.entries[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if e.IsDir() {
+		return &memDir{fsys: m, path: name, entry: e}, nil
+	}
+	return &memFile{entry: e, Reader: bytes.NewReader(e.data)}, nil
+}
+
+// ReadFile implements fs.ReadFileFS.
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrInvalid}
+	}
+	e, ok := m.entries[name]
+	if !ok || e.IsDir() {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrNotExist}
+	}
+	return bytes.Clone(e.data), nil
+}
+
+// memFile is an open regular file.
+type memFile struct {
+	entry *memEntry
+	*bytes.Reader
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) { return f.entry, nil }
+func (f *memFile) Close() error               { return nil }
+
+// memDir is an open directory.
+type memDir struct {
+	fsys   *MemFS
+	path   string
+	entry  *memEntry
+	offset int
+}
+
+func (d *memDir) Stat() (fs.FileInfo, error) { return d.entry, nil }
+func (d *memDir) Close() error               { return nil }
+
+func (d *memDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.path, Err: fs.ErrInvalid}
+}
+
+// ReadDir implements fs.ReadDirFile.
+func (d *memDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	names := d.entry.children[d.offset:]
+	if n > 0 && len(names) == 0 {
+		return nil, io.EOF
+	}
+	if n > 0 && n < len(names) {
+		names = names[:n]
+	}
+	d.offset += len(names)
+
+	list := make([]fs.DirEntry, len(names))
+	for i, name := range names {
+		list[i] = d.fsys.entries[path.Join(d.path, name)]
+	}
+	return list, nil
+}
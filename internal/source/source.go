@@ -0,0 +1,225 @@
+package source
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/waqasraz/code-context/internal/gitrepo"
+)
+
+// Kind identifies what a scan target is backed by.
+type Kind string
+
+const (
+	KindDir     Kind = "directory" // A directory on disk
+	KindTar     Kind = "tar"       // A .tar, .tar.gz or .tgz archive
+	KindZip     Kind = "zip"       // A .zip archive
+	KindGitTree Kind = "git-tree"  // The tree of a commit in a git repository
+)
+
+// Source is an opened scan target.
+type Source struct {
+	FS     fs.FS  // Files to scan
+	Kind   Kind   // What the files come from
+	Path   string // The directory, archive or repository that was opened
+	OnDisk bool   // FS is the directory at Path, so OS-level features (git, symlinks) apply
+
+	closer io.Closer
+}
+
+// Close releases the resources held by the source.
+func (s *Source) Close() error {
+	if s.closer != nil {
+		return s.closer.Close()
+	}
+	return nil
+}
+
+// IsArchive reports whether a file name has a supported archive extension.
+func IsArchive(name string) bool {
+	return archiveKind(name) != ""
+}
+
+func archiveKind(name string) Kind {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".tar"), strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return KindTar
+	case strings.HasSuffix(lower, ".zip"):
+		return KindZip
+	}
+	return ""
+}
+
+// Open opens a directory or an archive as a scan target.
+func Open(target string) (*Source, error) {
+	info, err := os.Stat(target)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return &Source{FS: os.DirFS(target), Kind: KindDir, Path: target, OnDisk: true}, nil
+	}
+
+	switch archiveKind(target) {
+	case KindTar:
+		fsys, err := OpenTar(target)
+		if err != nil {
+			return nil, err
+		}
+		return &Source{FS: fsys, Kind: KindTar, Path: target}, nil
+	case KindZip:
+		zr, err := zip.OpenReader(target)
+		if err != nil {
+			return nil, fmt.Errorf("error opening zip archive %s: %w", target, err)
+		}
+		return &Source{FS: &zr.Reader, Kind: KindZip, Path: target, closer: zr}, nil
+	}
+
+	return nil, fmt.Errorf("%s is neither a directory nor a supported archive (.tar, .tar.gz, .tgz, .zip)", target)
+}
+
+// OpenGitTree opens the tree of a revision in the repository containing
+// target, without checking it out.
+func OpenGitTree(target string, rev string) (*Source, error) {
+	repo, err := gitrepo.Open(target)
+	if err != nil {
+		return nil, err
+	}
+	fsys, err := repo.CommitFS(rev)
+	if err != nil {
+		repo.Close()
+		return nil, fmt.Errorf("error reading revision %s: %w", rev, err)
+	}
+
+	// Scan the part of the tree that corresponds to target
+	if prefix, err := repoSubdir(repo.WorkTree, target); err == nil && prefix != "." {
+		if fsys, err = fs.Sub(fsys, prefix); err != nil {
+			repo.Close()
+			return nil, err
+		}
+	}
+
+	return &Source{FS: fsys, Kind: KindGitTree, Path: target, closer: repo}, nil
+}
+
+// repoSubdir returns target relative to the work tree, slash-separated.
+func repoSubdir(workTree, target string) (string, error) {
+	absTarget, err := filepath.Abs(target)
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(absTarget); err == nil {
+		absTarget = resolved
+	}
+	if resolved, err := filepath.EvalSymlinks(workTree); err == nil {
+		workTree = resolved
+	}
+	rel, err := filepath.Rel(workTree, absTarget)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// OpenTar loads a tar archive, optionally gzip-compressed, into memory.
+// Symbolic and hard links to files inside the archive become copies of
+// their target; other links are dropped.
+func OpenTar(name string) (*MemFS, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	lower := strings.ToLower(name)
+	if strings.HasSuffix(lower, ".gz") || strings.HasSuffix(lower, ".tgz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("error opening tar archive %s: %w", name, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	fsys, err := ReadTar(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading tar archive %s: %w", name, err)
+	}
+	return fsys, nil
+}
+
+// ReadTar loads an uncompressed tar stream into memory.
+func ReadTar(r io.Reader) (*MemFS, error) {
+	fsys := NewMemFS()
+	links := make(map[string]string) // Link name -> cleaned target
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		name, err := cleanName(hdr.Name)
+		if err != nil || name == "." {
+			continue // Skip entries that would escape the archive
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := fsys.AddDir(name, hdr.ModTime); err != nil {
+				return nil, err
+			}
+		case tar.TypeReg:
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return nil, err
+			}
+			if err := fsys.AddFile(name, data, hdr.FileInfo().Mode(), hdr.ModTime); err != nil {
+				return nil, err
+			}
+		case tar.TypeSymlink:
+			if target, err := cleanName(path.Join(path.Dir(name), hdr.Linkname)); err == nil {
+				links[name] = target
+			}
+		case tar.TypeLink:
+			if target, err := cleanName(hdr.Linkname); err == nil {
+				links[name] = target
+			}
+		}
+	}
+
+	// Resolve links once every file is known, following chains of links
+	for name := range links {
+		target := links[name]
+		for i := 0; i < 40; i++ {
+			next, ok := links[target]
+			if !ok {
+				break
+			}
+			target = next
+		}
+		e, ok := fsys.entries[target]
+		if !ok || e.IsDir() {
+			continue
+		}
+		if err := fsys.AddFile(name, e.data, e.mode, e.modTime); err != nil {
+			return nil, err
+		}
+	}
+
+	return fsys, nil
+}
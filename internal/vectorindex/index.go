@@ -0,0 +1,536 @@
+package vectorindex
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// exactSearchLimit is the number of vectors up to which a search compares
+// the query with every vector instead of walking the graph. Below it a scan
+// takes no longer than a graph search and is always exact.
+const exactSearchLimit = 5000
+
+// maxLevel caps the number of graph layers.
+const maxLevel = 16
+
+// Params tunes the HNSW graph. Larger values give better recall at the cost
+// of memory and insertion time.
+type Params struct {
+	M              int // Neighbours per node on the upper layers (2*M on the bottom layer)
+	EfConstruction int // Size of the candidate list while inserting
+	EfSearch       int // Minimum size of the candidate list while searching
+}
+
+// DefaultParams returns the parameters used when none are given.
+func DefaultParams() Params {
+	return Params{M: 16, EfConstruction: 100, EfSearch: 64}
+}
+
+// Item identifies the chunk of a file a vector was computed from.
+type Item struct {
+	File  string
+	Start int // First line, 1-based
+	End   int // Last line, inclusive
+}
+
+// Result is an item found by a search.
+type Result struct {
+	Item
+	Score float64 // Cosine similarity to the query
+}
+
+// node is a vector in the graph. Removed nodes stay in the graph as
+// tombstones, so searches can still pass through them, until the index is
+// compacted.
+type node struct {
+	item      Item
+	vector    []float32  // Normalized to unit length
+	neighbors [][]uint32 // Neighbour ids per layer, from layer 0 up to the node's level
+	deleted   bool
+}
+
+// fileEntry records the vectors of a file and the content they were
+// computed from.
+type fileEntry struct {
+	Hash  string   // Content hash of the file when it was indexed
+	Nodes []uint32 // Ids of the file's vectors
+}
+
+// Index is an approximate nearest-neighbour index of vectors using a
+// hierarchical navigable small world (HNSW) graph, with vectors grouped by
+// the file they belong to so that files can be replaced and removed as they
+// change. Similarity is cosine similarity. An Index is not safe for
+// concurrent use.
+type Index struct {
+	params   Params
+	dims     int
+	nodes    []*node
+	entry    int // Entry point of searches (-1 when empty)
+	topLevel int // Level of the entry point
+	files    map[string]*fileEntry
+	live     int // Nodes that are not deleted
+	rng      *rand.Rand
+	dirty    bool // Changed since loaded or saved
+
+	visited  []uint32 // Search generation that last visited each node
+	visitGen uint32
+}
+
+// New returns an empty index. Zero parameters take their default values.
+func New(params Params) *Index {
+	defaults := DefaultParams()
+	if params.M <= 1 {
+		params.M = defaults.M
+	}
+	if params.EfConstruction <= 0 {
+		params.EfConstruction = defaults.EfConstruction
+	}
+	if params.EfSearch <= 0 {
+		params.EfSearch = defaults.EfSearch
+	}
+	return &Index{
+		params: params,
+		entry:  -1,
+		files:  make(map[string]*fileEntry),
+		rng:    rand.New(rand.NewSource(1)),
+	}
+}
+
+// Len returns the number of vectors in the index.
+func (ix *Index) Len() int {
+	return ix.live
+}
+
+// Dims returns the dimension of the vectors (0 while the index is empty).
+func (ix *Index) Dims() int {
+	return ix.dims
+}
+
+// Dirty reports whether the index changed since it was loaded or saved.
+func (ix *Index) Dirty() bool {
+	return ix.dirty
+}
+
+// FileHash returns the content hash a file was indexed with.
+func (ix *Index) FileHash(file string) (string, bool) {
+	entry, ok := ix.files[file]
+	if !ok {
+		return "", false
+	}
+	return entry.Hash, true
+}
+
+// Files returns the indexed files, sorted.
+func (ix *Index) Files() []string {
+	files := make([]string, 0, len(ix.files))
+	for file := range ix.files {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// SetFile replaces the vectors of a file. hash identifies the content the
+// vectors were computed from (see FileHash); items and vectors are parallel.
+func (ix *Index) SetFile(file string, hash string, items []Item, vectors [][]float64) error {
+	if len(items) != len(vectors) {
+		return fmt.Errorf("%d items for %d vectors", len(items), len(vectors))
+	}
+	if ix.live == 0 && len(ix.files) == 0 {
+		ix.reset() // Empty: adopt the dimension of the new vectors
+	}
+	for _, v := range vectors {
+		if ix.dims == 0 {
+			ix.dims = len(v)
+		}
+		if len(v) != ix.dims {
+			return fmt.Errorf("vector has %d dimensions, index has %d", len(v), ix.dims)
+		}
+	}
+
+	ix.RemoveFile(file)
+	entry := &fileEntry{Hash: hash}
+	for i, v := range vectors {
+		entry.Nodes = append(entry.Nodes, ix.insert(items[i], normalize(v)))
+	}
+	ix.files[file] = entry
+	ix.dirty = true
+	return nil
+}
+
+// RemoveFile removes the vectors of a file. Removing a file that is not
+// indexed does nothing.
+func (ix *Index) RemoveFile(file string) {
+	entry, ok := ix.files[file]
+	if !ok {
+		return
+	}
+	for _, id := range entry.Nodes {
+		ix.nodes[id].deleted = true
+		ix.live--
+	}
+	delete(ix.files, file)
+	ix.dirty = true
+
+	// Rebuild the graph once tombstones outnumber the live nodes
+	if len(ix.nodes)-ix.live > ix.live {
+		ix.compact()
+	}
+}
+
+// reset empties the graph.
+func (ix *Index) reset() {
+	ix.dims = 0
+	ix.nodes = nil
+	ix.entry = -1
+	ix.topLevel = 0
+	ix.live = 0
+}
+
+// compact rebuilds the graph from the live nodes, dropping tombstones.
+func (ix *Index) compact() {
+	old := ix.nodes
+	files := ix.Files()
+	dims := ix.dims
+	ix.reset()
+	ix.dims = dims
+	for _, file := range files {
+		entry := ix.files[file]
+		var ids []uint32
+		for _, id := range entry.Nodes {
+			ids = append(ids, ix.insert(old[id].item, old[id].vector))
+		}
+		entry.Nodes = ids
+	}
+}
+
+// randomLevel draws the level of a new node from an exponentially decaying
+// distribution, so that each layer holds about 1/M of the nodes below it.
+func (ix *Index) randomLevel() int {
+	level := int(math.Floor(-math.Log(1-ix.rng.Float64()) / math.Log(float64(ix.params.M))))
+	return min(level, maxLevel)
+}
+
+// maxNeighbors returns how many neighbours a node keeps on a layer.
+func (ix *Index) maxNeighbors(level int) int {
+	if level == 0 {
+		return 2 * ix.params.M
+	}
+	return ix.params.M
+}
+
+// insert adds a normalized vector to the graph and returns its id.
+func (ix *Index) insert(item Item, vector []float32) uint32 {
+	id := uint32(len(ix.nodes))
+	level := ix.randomLevel()
+	n := &node{item: item, vector: vector, neighbors: make([][]uint32, level+1)}
+	ix.nodes = append(ix.nodes, n)
+	ix.live++
+	if ix.entry < 0 {
+		ix.entry, ix.topLevel = int(id), level
+		return id
+	}
+
+	// Descend greedily to the node's level, then link it on every layer
+	// from there down to the bottom
+	ep := uint32(ix.entry)
+	for l := ix.topLevel; l > level; l-- {
+		ep = ix.greedy(vector, ep, l)
+	}
+	for l := min(level, ix.topLevel); l >= 0; l-- {
+		found := ix.searchLayer(vector, ep, ix.params.EfConstruction, l)
+		ep = found[0].id
+
+		// Prefer live neighbours; tombstones only keep the graph connected
+		live := found[:0:0]
+		for _, c := range found {
+			if !ix.nodes[c.id].deleted {
+				live = append(live, c)
+			}
+		}
+		if len(live) > 0 {
+			found = live
+		}
+
+		for _, c := range ix.selectNeighbors(found, ix.params.M) {
+			n.neighbors[l] = append(n.neighbors[l], c.id)
+			ix.connect(c.id, id, l)
+		}
+	}
+	if level > ix.topLevel {
+		ix.entry, ix.topLevel = int(id), level
+	}
+	return id
+}
+
+// connect adds a link from one node to another on a layer, pruning the
+// node's neighbours when it has too many.
+func (ix *Index) connect(from, to uint32, level int) {
+	n := ix.nodes[from]
+	n.neighbors[level] = append(n.neighbors[level], to)
+	limit := ix.maxNeighbors(level)
+	if len(n.neighbors[level]) <= limit {
+		return
+	}
+
+	candidates := make([]candidate, len(n.neighbors[level]))
+	for i, id := range n.neighbors[level] {
+		candidates[i] = candidate{id: id, dist: distance(n.vector, ix.nodes[id].vector)}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].dist < candidates[j].dist })
+	kept := ix.selectNeighbors(candidates, limit)
+	n.neighbors[level] = n.neighbors[level][:0]
+	for _, c := range kept {
+		n.neighbors[level] = append(n.neighbors[level], c.id)
+	}
+}
+
+// selectNeighbors picks up to m neighbours from candidates sorted by
+// distance, skipping candidates closer to an already selected neighbour than
+// to the base node so that links spread in different directions. Skipped
+// candidates fill the remaining slots.
+func (ix *Index) selectNeighbors(candidates []candidate, m int) []candidate {
+	if len(candidates) <= m {
+		return candidates
+	}
+	selected := make([]candidate, 0, m)
+	var skipped []candidate
+	for _, c := range candidates {
+		if len(selected) == m {
+			break
+		}
+		diverse := true
+		for _, s := range selected {
+			if distance(ix.nodes[c.id].vector, ix.nodes[s.id].vector) < c.dist {
+				diverse = false
+				break
+			}
+		}
+		if diverse {
+			selected = append(selected, c)
+		} else {
+			skipped = append(skipped, c)
+		}
+	}
+	for _, c := range skipped {
+		if len(selected) == m {
+			break
+		}
+		selected = append(selected, c)
+	}
+	return selected
+}
+
+// greedy walks a layer towards the query and returns the closest node found.
+func (ix *Index) greedy(query []float32, ep uint32, level int) uint32 {
+	best := distance(query, ix.nodes[ep].vector)
+	for changed := true; changed; {
+		changed = false
+		for _, id := range ix.nodes[ep].neighbors[level] {
+			if d := distance(query, ix.nodes[id].vector); d < best {
+				ep, best, changed = id, d, true
+			}
+		}
+	}
+	return ep
+}
+
+// startVisit begins a new search and returns the visit marks, which hold
+// the current generation for nodes visited by this search. Reusing the marks
+// avoids allocating a set per search.
+func (ix *Index) startVisit() []uint32 {
+	if len(ix.visited) < len(ix.nodes) {
+		ix.visited = append(ix.visited, make([]uint32, len(ix.nodes)-len(ix.visited))...)
+	}
+	ix.visitGen++
+	if ix.visitGen == 0 { // Wrapped around: old marks could match again
+		clear(ix.visited)
+		ix.visitGen = 1
+	}
+	return ix.visited
+}
+
+// searchLayer returns the ef nodes closest to the query on a layer, closest
+// first, found by a best-first search from ep.
+func (ix *Index) searchLayer(query []float32, ep uint32, ef int, level int) []candidate {
+	visited := ix.startVisit()
+	visited[ep] = ix.visitGen
+	start := candidate{id: ep, dist: distance(query, ix.nodes[ep].vector)}
+	frontier := &candidateHeap{items: []candidate{start}}           // Closest first
+	results := &candidateHeap{items: []candidate{start}, max: true} // Farthest first
+
+	for frontier.Len() > 0 {
+		c := heap.Pop(frontier).(candidate)
+		if c.dist > results.items[0].dist && results.Len() >= ef {
+			break
+		}
+		for _, id := range ix.nodes[c.id].neighbors[level] {
+			if visited[id] == ix.visitGen {
+				continue
+			}
+			visited[id] = ix.visitGen
+			d := distance(query, ix.nodes[id].vector)
+			if results.Len() < ef || d < results.items[0].dist {
+				heap.Push(frontier, candidate{id: id, dist: d})
+				heap.Push(results, candidate{id: id, dist: d})
+				if results.Len() > ef {
+					heap.Pop(results)
+				}
+			}
+		}
+	}
+
+	found := results.items
+	sort.Slice(found, func(i, j int) bool { return found[i].dist < found[j].dist })
+	return found
+}
+
+// Search returns the k vectors most similar to the query, best first. When
+// accept is not nil, only vectors of files it accepts are returned. Small
+// indexes and selective filters are searched exhaustively; otherwise the
+// graph is searched, which is approximate.
+func (ix *Index) Search(query []float64, k int, accept func(file string) bool) ([]Result, error) {
+	if ix.live == 0 || k <= 0 {
+		return nil, nil
+	}
+	if len(query) != ix.dims {
+		return nil, fmt.Errorf("query has %d dimensions, index has %d", len(query), ix.dims)
+	}
+	q := normalize(query)
+
+	// Count the vectors the filter lets through
+	accepted := ix.live
+	if accept != nil {
+		accepted = 0
+		for file, entry := range ix.files {
+			if accept(file) {
+				accepted += len(entry.Nodes)
+			}
+		}
+	}
+	if accepted == 0 {
+		return nil, nil
+	}
+
+	var found []candidate
+	if accepted <= exactSearchLimit || k*2 >= accepted {
+		found = ix.scan(q, k, accept)
+	} else {
+		// Widen the search in proportion to what the filter drops
+		ef := max(ix.params.EfSearch, k) * ix.live / accepted
+		ep := uint32(ix.entry)
+		for l := ix.topLevel; l > 0; l-- {
+			ep = ix.greedy(q, ep, l)
+		}
+		for _, c := range ix.searchLayer(q, ep, min(ef, len(ix.nodes)), 0) {
+			n := ix.nodes[c.id]
+			if !n.deleted && (accept == nil || accept(n.item.File)) {
+				found = append(found, c)
+			}
+		}
+	}
+
+	if len(found) > k {
+		found = found[:k]
+	}
+	results := make([]Result, len(found))
+	for i, c := range found {
+		results[i] = Result{Item: ix.nodes[c.id].item, Score: 1 - float64(c.dist)}
+	}
+	return results, nil
+}
+
+// scan compares the query with every accepted vector and returns the k
+// closest, closest first.
+func (ix *Index) scan(query []float32, k int, accept func(file string) bool) []candidate {
+	closest := &candidateHeap{max: true}
+	for file, entry := range ix.files {
+		if accept != nil && !accept(file) {
+			continue
+		}
+		for _, id := range entry.Nodes {
+			d := distance(query, ix.nodes[id].vector)
+			if closest.Len() < k {
+				heap.Push(closest, candidate{id: id, dist: d})
+			} else if d < closest.items[0].dist {
+				closest.items[0] = candidate{id: id, dist: d}
+				heap.Fix(closest, 0)
+			}
+		}
+	}
+	found := closest.items
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].dist != found[j].dist {
+			return found[i].dist < found[j].dist
+		}
+		return found[i].id < found[j].id
+	})
+	return found
+}
+
+// normalize converts a vector to float32 and scales it to unit length, so
+// that cosine similarity becomes a dot product.
+func normalize(v []float64) []float32 {
+	var norm float64
+	for _, x := range v {
+		norm += x * x
+	}
+	norm = math.Sqrt(norm)
+	out := make([]float32, len(v))
+	if norm == 0 {
+		return out
+	}
+	for i, x := range v {
+		out[i] = float32(x / norm)
+	}
+	return out
+}
+
+// distance is the cosine distance between two normalized vectors.
+func distance(a, b []float32) float32 {
+	b = b[:len(a)]
+	var d0, d1, d2, d3 float32
+	i := 0
+	for ; i+4 <= len(a); i += 4 {
+		d0 += a[i] * b[i]
+		d1 += a[i+1] * b[i+1]
+		d2 += a[i+2] * b[i+2]
+		d3 += a[i+3] * b[i+3]
+	}
+	for ; i < len(a); i++ {
+		d0 += a[i] * b[i]
+	}
+	return 1 - (d0 + d1 + d2 + d3)
+}
+
+// candidate is a node and its distance to a query.
+type candidate struct {
+	id   uint32
+	dist float32
+}
+
+// candidateHeap is a heap of candidates: closest first, or farthest first
+// when max is set.
+type candidateHeap struct {
+	items []candidate
+	max   bool
+}
+
+func (h *candidateHeap) Len() int { return len(h.items) }
+func (h *candidateHeap) Less(i, j int) bool {
+	if h.max {
+		return h.items[i].dist > h.items[j].dist
+	}
+	return h.items[i].dist < h.items[j].dist
+}
+func (h *candidateHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *candidateHeap) Push(x any)    { h.items = append(h.items, x.(candidate)) }
+func (h *candidateHeap) Pop() any {
+	old := h.items
+	x := old[len(old)-1]
+	h.items = old[:len(old)-1]
+	return x
+}
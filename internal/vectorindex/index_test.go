@@ -0,0 +1,180 @@
+package vectorindex
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// randomVectors returns n random vectors of dims dimensions.
+func randomVectors(rng *rand.Rand, n int, dims int) [][]float64 {
+	vectors := make([][]float64, n)
+	for i := range vectors {
+		vectors[i] = make([]float64, dims)
+		for j := range vectors[i] {
+			vectors[i][j] = rng.NormFloat64()
+		}
+	}
+	return vectors
+}
+
+// buildIndex indexes files of chunksPerFile random vectors each, named
+// file000.go, file001.go, ...
+func buildIndex(t *testing.T, rng *rand.Rand, files int, chunksPerFile int, dims int) *Index {
+	t.Helper()
+	ix := New(Params{})
+	for f := range files {
+		name := fmt.Sprintf("file%03d.go", f)
+		items := make([]Item, chunksPerFile)
+		for c := range items {
+			items[c] = Item{File: name, Start: c*10 + 1, End: c*10 + 10}
+		}
+		if err := ix.SetFile(name, fmt.Sprintf("hash%d", f), items, randomVectors(rng, chunksPerFile, dims)); err != nil {
+			t.Fatalf("SetFile(%s): %v", name, err)
+		}
+	}
+	return ix
+}
+
+func TestSearchExactOnSmallIndex(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	ix := buildIndex(t, rng, 10, 5, 8)
+	query := randomVectors(rng, 1, 8)[0]
+
+	results, err := ix.Search(query, 5, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ix.scan(normalize(query), 5, nil)
+	if len(results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(results), len(want))
+	}
+	for i, c := range want {
+		if results[i].Item != ix.nodes[c.id].item {
+			t.Errorf("result %d = %v, want %v", i, results[i].Item, ix.nodes[c.id].item)
+		}
+		if i > 0 && results[i].Score > results[i-1].Score {
+			t.Errorf("results not sorted by score at %d", i)
+		}
+	}
+}
+
+func TestSearchRecallAboveExactLimit(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a large graph")
+	}
+	rng := rand.New(rand.NewSource(2))
+	ix := buildIndex(t, rng, 110, 50, 16) // 5500 vectors, above exactSearchLimit
+	if ix.Len() <= exactSearchLimit {
+		t.Fatalf("index holds %d vectors, want more than %d", ix.Len(), exactSearchLimit)
+	}
+
+	const k, queries = 10, 50
+	hits := 0
+	for _, query := range randomVectors(rng, queries, 16) {
+		results, err := ix.Search(query, k, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		exact := make(map[Item]bool)
+		for _, c := range ix.scan(normalize(query), k, nil) {
+			exact[ix.nodes[c.id].item] = true
+		}
+		for _, r := range results {
+			if exact[r.Item] {
+				hits++
+			}
+		}
+	}
+	if recall := float64(hits) / (k * queries); recall < 0.9 {
+		t.Errorf("recall@%d = %.3f, want at least 0.9", k, recall)
+	}
+}
+
+func TestSearchFilter(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	ix := buildIndex(t, rng, 20, 4, 8)
+	accept := func(file string) bool { return file == "file003.go" || file == "file011.go" }
+
+	results, err := ix.Search(randomVectors(rng, 1, 8)[0], 20, accept)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 8 {
+		t.Errorf("got %d results, want the 8 chunks of the accepted files", len(results))
+	}
+	for _, r := range results {
+		if !accept(r.File) {
+			t.Errorf("result from rejected file %s", r.File)
+		}
+	}
+}
+
+func TestSearchDimensionMismatch(t *testing.T) {
+	ix := buildIndex(t, rand.New(rand.NewSource(4)), 2, 2, 8)
+	if _, err := ix.Search(make([]float64, 4), 1, nil); err == nil {
+		t.Error("Search with a 4-dimensional query on an 8-dimensional index succeeded")
+	}
+	if err := ix.SetFile("other.go", "h", []Item{{File: "other.go"}}, [][]float64{make([]float64, 4)}); err == nil {
+		t.Error("SetFile with a 4-dimensional vector on an 8-dimensional index succeeded")
+	}
+}
+
+func TestSetFileReplacesVectors(t *testing.T) {
+	rng := rand.New(rand.NewSource(5))
+	ix := buildIndex(t, rng, 5, 3, 8)
+
+	vector := randomVectors(rng, 1, 8)[0]
+	if err := ix.SetFile("file002.go", "new", []Item{{File: "file002.go", Start: 1, End: 99}}, [][]float64{vector}); err != nil {
+		t.Fatal(err)
+	}
+	if got := ix.Len(); got != 13 {
+		t.Errorf("Len() = %d, want 13", got)
+	}
+	if hash, _ := ix.FileHash("file002.go"); hash != "new" {
+		t.Errorf("FileHash = %q, want %q", hash, "new")
+	}
+	results, err := ix.Search(vector, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Item != (Item{File: "file002.go", Start: 1, End: 99}) {
+		t.Errorf("nearest to the new vector = %v, want the new chunk", results)
+	}
+}
+
+func TestRemoveFileCompacts(t *testing.T) {
+	rng := rand.New(rand.NewSource(6))
+	ix := buildIndex(t, rng, 10, 4, 8)
+
+	// Removing most files leaves more tombstones than live nodes, which
+	// rebuilds the graph without them
+	for f := range 6 {
+		ix.RemoveFile(fmt.Sprintf("file%03d.go", f))
+	}
+	if got := ix.Len(); got != 16 {
+		t.Errorf("Len() = %d, want 16", got)
+	}
+	if len(ix.nodes) != ix.Len() {
+		t.Errorf("graph holds %d nodes after compaction, want %d", len(ix.nodes), ix.Len())
+	}
+	results, err := ix.Search(randomVectors(rng, 1, 8)[0], 100, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 16 {
+		t.Errorf("got %d results, want 16", len(results))
+	}
+	for _, r := range results {
+		if _, ok := ix.FileHash(r.File); !ok {
+			t.Errorf("result from removed file %s", r.File)
+		}
+	}
+
+	for _, file := range ix.Files() {
+		ix.RemoveFile(file)
+	}
+	if ix.Len() != 0 || ix.entry != -1 {
+		t.Errorf("index not empty after removing every file: Len() = %d, entry = %d", ix.Len(), ix.entry)
+	}
+}
@@ -0,0 +1,177 @@
+package vectorindex
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// fileMagic starts every index file, followed by a format version.
+const fileMagic = "CCVI"
+
+const fileVersion = 1
+
+// storedIndex is the on-disk form of an Index, apart from the vectors,
+// which follow it as raw float32 values.
+type storedIndex struct {
+	Params    Params
+	Dims      int
+	Entry     int
+	TopLevel  int
+	Files     map[string]*fileEntry
+	Items     []Item
+	Neighbors [][][]uint32
+	Deleted   []bool
+}
+
+// Load reads an index saved by Save. A missing file gives an empty index.
+func Load(path string) (*Index, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return New(Params{}), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	header := make([]byte, len(fileMagic)+1)
+	if _, err := io.ReadFull(r, header); err != nil || string(header[:len(fileMagic)]) != fileMagic {
+		return nil, fmt.Errorf("%s is not a vector index", path)
+	}
+	if header[len(fileMagic)] != fileVersion {
+		return nil, fmt.Errorf("%s has unsupported version %d", path, header[len(fileMagic)])
+	}
+
+	var stored storedIndex
+	if err := gob.NewDecoder(r).Decode(&stored); err != nil {
+		return nil, fmt.Errorf("error reading vector index %s: %w", path, err)
+	}
+	if err := stored.validate(); err != nil {
+		return nil, fmt.Errorf("vector index %s is inconsistent: %w", path, err)
+	}
+
+	ix := New(stored.Params)
+	ix.dims = stored.Dims
+	ix.entry = stored.Entry
+	ix.topLevel = stored.TopLevel
+	if stored.Files != nil {
+		ix.files = stored.Files
+	}
+	ix.nodes = make([]*node, len(stored.Items))
+	for i := range ix.nodes {
+		vector := make([]float32, stored.Dims)
+		if err := binary.Read(r, binary.LittleEndian, vector); err != nil {
+			return nil, fmt.Errorf("error reading vector index %s: %w", path, err)
+		}
+		ix.nodes[i] = &node{item: stored.Items[i], vector: vector, neighbors: stored.Neighbors[i], deleted: stored.Deleted[i]}
+		if !stored.Deleted[i] {
+			ix.live++
+		}
+	}
+	return ix, nil
+}
+
+// validate checks that every node id in a loaded index refers to a node,
+// on a layer the node is linked on, so that a truncated or stale file
+// cannot make searches index out of range.
+func (s *storedIndex) validate() error {
+	n := len(s.Items)
+	if len(s.Neighbors) != n || len(s.Deleted) != n {
+		return fmt.Errorf("%d items, %d neighbor lists and %d deletion marks", n, len(s.Neighbors), len(s.Deleted))
+	}
+	if s.Dims < 0 {
+		return fmt.Errorf("invalid dimension %d", s.Dims)
+	}
+	if n == 0 {
+		if s.Entry != -1 {
+			return fmt.Errorf("entry point %d in an empty graph", s.Entry)
+		}
+	} else if s.Entry < 0 || s.Entry >= n {
+		return fmt.Errorf("entry point %d out of range", s.Entry)
+	} else if s.TopLevel != len(s.Neighbors[s.Entry])-1 {
+		return fmt.Errorf("top level %d does not match the entry point", s.TopLevel)
+	}
+	for id, layers := range s.Neighbors {
+		if len(layers) == 0 || len(layers) > maxLevel+1 {
+			return fmt.Errorf("node %d has %d layers", id, len(layers))
+		}
+		for level, neighbors := range layers {
+			for _, nb := range neighbors {
+				if int(nb) >= n || len(s.Neighbors[nb]) <= level {
+					return fmt.Errorf("node %d links to missing node %d on layer %d", id, nb, level)
+				}
+			}
+		}
+	}
+	for file, entry := range s.Files {
+		if entry == nil {
+			return fmt.Errorf("file %s has no entry", file)
+		}
+		for _, id := range entry.Nodes {
+			if int(id) >= n {
+				return fmt.Errorf("file %s refers to missing node %d", file, id)
+			}
+		}
+	}
+	return nil
+}
+
+// Save writes the index to path, replacing it atomically.
+func (ix *Index) Save(path string) error {
+	stored := storedIndex{
+		Params:    ix.params,
+		Dims:      ix.dims,
+		Entry:     ix.entry,
+		TopLevel:  ix.topLevel,
+		Files:     ix.files,
+		Items:     make([]Item, len(ix.nodes)),
+		Neighbors: make([][][]uint32, len(ix.nodes)),
+		Deleted:   make([]bool, len(ix.nodes)),
+	}
+	for i, n := range ix.nodes {
+		stored.Items[i] = n.item
+		stored.Neighbors[i] = n.neighbors
+		stored.Deleted[i] = n.deleted
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // Fails harmlessly once renamed
+
+	w := bufio.NewWriter(tmp)
+	w.WriteString(fileMagic)
+	w.WriteByte(fileVersion)
+	err = gob.NewEncoder(w).Encode(stored)
+	for _, n := range ix.nodes {
+		if err != nil {
+			break
+		}
+		err = binary.Write(w, binary.LittleEndian, n.vector)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("error writing vector index %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	ix.dirty = false
+	return nil
+}
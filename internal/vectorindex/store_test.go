@@ -0,0 +1,192 @@
+package vectorindex
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// assertSameSearches checks that two indexes return the same results.
+func assertSameSearches(t *testing.T, got *Index, want *Index, queries [][]float64) {
+	t.Helper()
+	if got.Len() != want.Len() || got.Dims() != want.Dims() {
+		t.Fatalf("Len, Dims = %d, %d, want %d, %d", got.Len(), got.Dims(), want.Len(), want.Dims())
+	}
+	if !reflect.DeepEqual(got.Files(), want.Files()) {
+		t.Fatalf("Files() = %v, want %v", got.Files(), want.Files())
+	}
+	for _, file := range want.Files() {
+		wantHash, _ := want.FileHash(file)
+		if gotHash, _ := got.FileHash(file); gotHash != wantHash {
+			t.Errorf("FileHash(%s) = %q, want %q", file, gotHash, wantHash)
+		}
+	}
+	for _, query := range queries {
+		gotResults, err := got.Search(query, 5, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantResults, _ := want.Search(query, 5, nil)
+		if !reflect.DeepEqual(gotResults, wantResults) {
+			t.Errorf("Search = %v, want %v", gotResults, wantResults)
+		}
+	}
+}
+
+func TestSaveLoadRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(10))
+	ix := buildIndex(t, rng, 12, 4, 8)
+	ix.RemoveFile("file001.go") // A tombstone is saved too
+	queries := randomVectors(rng, 10, 8)
+
+	path := filepath.Join(t.TempDir(), "vectors.idx")
+	if err := ix.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	if ix.Dirty() {
+		t.Error("index still dirty after Save")
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Dirty() {
+		t.Error("loaded index is dirty")
+	}
+	assertSameSearches(t, loaded, ix, queries)
+}
+
+func TestSaveLoadAfterCompaction(t *testing.T) {
+	rng := rand.New(rand.NewSource(11))
+	ix := buildIndex(t, rng, 12, 4, 8)
+	for f := range 7 { // The seventh removal leaves more tombstones than live nodes
+		ix.RemoveFile(fmt.Sprintf("file%03d.go", f))
+	}
+	if len(ix.nodes) != ix.Len() {
+		t.Fatalf("graph not compacted: %d nodes, %d live", len(ix.nodes), ix.Len())
+	}
+	queries := randomVectors(rng, 10, 8)
+
+	path := filepath.Join(t.TempDir(), "vectors.idx")
+	if err := ix.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameSearches(t, loaded, ix, queries)
+
+	// The loaded index keeps working as files change
+	if err := loaded.SetFile("new.go", "h", []Item{{File: "new.go", Start: 1, End: 5}}, randomVectors(rng, 1, 8)); err != nil {
+		t.Fatal(err)
+	}
+	if got := loaded.Len(); got != ix.Len()+1 {
+		t.Errorf("Len() = %d after adding a file, want %d", got, ix.Len()+1)
+	}
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	ix, err := Load(filepath.Join(t.TempDir(), "missing.idx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ix.Len() != 0 {
+		t.Errorf("Len() = %d, want 0", ix.Len())
+	}
+}
+
+// writeStored writes an index file holding stored and its vectors.
+func writeStored(t *testing.T, path string, stored storedIndex, vectors int) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	w.WriteString(fileMagic)
+	w.WriteByte(fileVersion)
+	if err := gob.NewEncoder(w).Encode(stored); err != nil {
+		t.Fatal(err)
+	}
+	for range vectors {
+		binary.Write(w, binary.LittleEndian, make([]float32, stored.Dims))
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadRejectsInconsistentIndexes(t *testing.T) {
+	valid := func() storedIndex {
+		return storedIndex{
+			Params:    DefaultParams(),
+			Dims:      2,
+			Entry:     1,
+			TopLevel:  1,
+			Files:     map[string]*fileEntry{"a.go": {Hash: "h", Nodes: []uint32{0, 1}}},
+			Items:     []Item{{File: "a.go"}, {File: "a.go"}},
+			Neighbors: [][][]uint32{{{1}}, {{0}, {}}},
+			Deleted:   []bool{false, false},
+		}
+	}
+	tests := []struct {
+		name   string
+		change func(s *storedIndex)
+	}{
+		{"entry out of range", func(s *storedIndex) { s.Entry = 2 }},
+		{"negative entry", func(s *storedIndex) { s.Entry = -1 }},
+		{"top level above the entry point", func(s *storedIndex) { s.TopLevel = 3 }},
+		{"neighbor out of range", func(s *storedIndex) { s.Neighbors[0][0] = []uint32{7} }},
+		{"neighbor missing on the layer", func(s *storedIndex) { s.Neighbors[1][1] = []uint32{0} }},
+		{"node without layers", func(s *storedIndex) { s.Neighbors[0] = [][]uint32{} }},
+		{"file node out of range", func(s *storedIndex) { s.Files["a.go"].Nodes = []uint32{0, 5} }},
+		{"missing deletion marks", func(s *storedIndex) { s.Deleted = s.Deleted[:1] }},
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "valid.idx")
+	writeStored(t, path, valid(), 2)
+	if _, err := Load(path); err != nil {
+		t.Fatalf("Load(valid index): %v", err)
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored := valid()
+			tt.change(&stored)
+			path := filepath.Join(dir, fmt.Sprintf("bad%d.idx", i))
+			writeStored(t, path, stored, len(stored.Items))
+			if _, err := Load(path); err == nil {
+				t.Error("Load succeeded")
+			}
+		})
+	}
+}
+
+func TestLoadRejectsTruncatedFile(t *testing.T) {
+	rng := rand.New(rand.NewSource(12))
+	ix := buildIndex(t, rng, 3, 2, 8)
+	path := filepath.Join(t.TempDir(), "vectors.idx")
+	if err := ix.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, size := range []int{0, 3, len(fileMagic) + 1, len(data) / 2, len(data) - 1} {
+		if err := os.WriteFile(path, data[:size], 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(path); err == nil {
+			t.Errorf("Load of the first %d of %d bytes succeeded", size, len(data))
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package walker
+
+import (
+	"bytes"
+	"path"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// FileClass is the content classification of a file.
+type FileClass string
+
+const (
+	ClassText      FileClass = "text"      // Ordinary source or text file
+	ClassBinary    FileClass = "binary"    // NUL bytes, invalid UTF-8 or a known binary extension
+	ClassGenerated FileClass = "generated" // Carries a "Code generated ... DO NOT EDIT" style header
+	ClassMinified  FileClass = "minified"  // Very long lines typical of bundled/minified assets
+	ClassLockfile  FileClass = "lockfile"  // Dependency lockfile (package-lock.json, go.sum, ...)
+)
+
+// AllFileClasses lists every classification, in reporting order.
+var AllFileClasses = []FileClass{ClassText, ClassBinary, ClassGenerated, ClassMinified, ClassLockfile}
+
+// ClassPolicy maps a file class to whether files of that class are reported.
+// Classes missing from the map fall back to DefaultClassPolicy.
+type ClassPolicy map[FileClass]bool
+
+// DefaultClassPolicy only lets ordinary text files through.
+var DefaultClassPolicy = ClassPolicy{
+	ClassText:      true,
+	ClassBinary:    false,
+	ClassGenerated: false,
+	ClassMinified:  false,
+	ClassLockfile:  false,
+}
+
+// Includes reports whether files of class c are reported under the policy.
+func (p ClassPolicy) Includes(c FileClass) bool {
+	if include, ok := p[c]; ok {
+		return include
+	}
+	return DefaultClassPolicy[c]
+}
+
+const (
+	sniffSize         = 64 * 1024 // Bytes read from the start of a file for classification
+	binarySniffSize   = 8000      // Bytes checked for NUL, same window git uses
+	generatedMaxLines = 20        // Lines searched for a generated-code marker
+	minifiedLineLen   = 1000      // A line at least this long suggests minification
+	minifiedAvgLen    = 200       // ...when the average line is also this long
+)
+
+// binaryExtensions are classified without reading the file.
+var binaryExtensions = map[string]bool{
+	".bin": true, ".exe": true, ".dll": true, ".so": true, ".dylib": true,
+	".a": true, ".o": true, ".obj": true, ".lib": true, ".class": true,
+	".jar": true, ".war": true, ".pyc": true, ".pyo": true, ".wasm": true,
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".bmp": true,
+	".ico": true, ".webp": true, ".tiff": true, ".psd": true, ".pdf": true,
+	".zip": true, ".gz": true, ".tgz": true, ".bz2": true, ".xz": true,
+	".rar": true, ".7z": true, ".tar": true, ".mp3": true, ".mp4": true,
+	".mov": true, ".avi": true, ".wav": true, ".ogg": true, ".woff": true,
+	".woff2": true, ".ttf": true, ".otf": true, ".eot": true, ".db": true,
+	".sqlite": true, ".lockb": true,
+}
+
+// lockfileNames are dependency lockfiles produced by package managers.
+var lockfileNames = map[string]bool{
+	"package-lock.json":   true,
+	"npm-shrinkwrap.json": true,
+	"yarn.lock":           true,
+	"pnpm-lock.yaml":      true,
+	"bun.lock":            true,
+	"Cargo.lock":          true,
+	"Gemfile.lock":        true,
+	"Pipfile.lock":        true,
+	"poetry.lock":         true,
+	"uv.lock":             true,
+	"pdm.lock":            true,
+	"composer.lock":       true,
+	"go.sum":              true,
+	"packages.lock.json":  true,
+	"paket.lock":          true,
+	"mix.lock":            true,
+	"pubspec.lock":        true,
+	"Podfile.lock":        true,
+	"Package.resolved":    true,
+	"flake.lock":          true,
+	"gradle.lockfile":     true,
+	".terraform.lock.hcl": true,
+}
+
+// generatedNameSuffixes identify generated files by name alone.
+var generatedNameSuffixes = []string{
+	".pb.go", ".pb.gw.go", "_pb2.py", "_pb2_grpc.py", ".pb.cc", ".pb.h",
+	".g.cs", ".g.i.cs", ".designer.cs", ".generated.cs", ".generated.ts",
+	".generated.go", "_generated.go", ".map",
+}
+
+// generatedMarker matches the headers code generators put at the top of files.
+var generatedMarker = regexp.MustCompile(`(?i)(code generated .*do not edit|<auto-generated|auto-generated by|autogenerated by|this file (is|was) (automatically|auto) generated|generated by the protocol buffer compiler)`)
+
+// generatedTag matches the "@generated" tag of Facebook-style tooling. It is
+// case-sensitive and must be in a comment, so that Java's @Generated
+// annotation and javax.annotation.Generated do not count.
+var generatedTag = regexp.MustCompile(`^\s*(//|/\*|\*|#|--|<!--|;)[^\n]*@generated\b`)
+
+// classifyName classifies a file from its name alone, returning an empty
+// class when the content has to be inspected.
+func classifyName(name string) FileClass {
+	base := path.Base(name)
+	lowerBase := strings.ToLower(base)
+
+	if lockfileNames[base] {
+		return ClassLockfile
+	}
+	if binaryExtensions[path.Ext(lowerBase)] {
+		return ClassBinary
+	}
+	for _, suffix := range generatedNameSuffixes {
+		if strings.HasSuffix(lowerBase, suffix) {
+			return ClassGenerated
+		}
+	}
+	return ""
+}
+
+// classifyContent classifies a file from its leading bytes. truncated is true
+// when data is only a prefix of the file.
+func classifyContent(data []byte, truncated bool) FileClass {
+	// NUL bytes in the first block are the classic binary signal
+	window := data
+	if len(window) > binarySniffSize {
+		window = window[:binarySniffSize]
+	}
+	if bytes.IndexByte(window, 0) >= 0 {
+		return ClassBinary
+	}
+
+	// A prefix may end in the middle of a multi-byte rune
+	check := data
+	if truncated {
+		for i := 0; i < utf8.UTFMax && len(check) > 0; i++ {
+			if r, size := utf8.DecodeLastRune(check); r != utf8.RuneError || size != 1 {
+				break
+			}
+			check = check[:len(check)-1]
+		}
+	}
+	if !utf8.Valid(check) {
+		return ClassBinary
+	}
+
+	// Generated-code markers appear in the first few lines
+	lines := bytes.SplitN(data, []byte("\n"), generatedMaxLines+1)
+	if len(lines) > generatedMaxLines {
+		lines = lines[:generatedMaxLines]
+	}
+	for _, line := range lines {
+		if len(line) < minifiedLineLen && (generatedMarker.Match(line) || generatedTag.Match(line)) {
+			return ClassGenerated
+		}
+	}
+
+	// Minified files consist of a handful of extremely long lines
+	lineCount := bytes.Count(data, []byte("\n")) + 1
+	maxLen, start := 0, 0
+	for i := 0; i <= len(data); i++ {
+		if i == len(data) || data[i] == '\n' {
+			if i-start > maxLen {
+				maxLen = i - start
+			}
+			start = i + 1
+		}
+	}
+	if maxLen >= minifiedLineLen && len(data)/lineCount >= minifiedAvgLen {
+		return ClassMinified
+	}
+
+	return ClassText
+}
+
+// ParseFileClass converts a user-supplied class name to a FileClass.
+func ParseFileClass(name string) (FileClass, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	name = strings.TrimSuffix(name, "s") // Accept plurals such as "lockfiles"
+	for _, c := range AllFileClasses {
+		if string(c) == name {
+			return c, true
+		}
+	}
+	return "", false
+}
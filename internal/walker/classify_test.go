@@ -0,0 +1,27 @@
+package walker
+
+import "testing"
+
+func TestClassifyContent(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    FileClass
+	}{
+		{"plain code", "package main\n\nfunc main() {}\n", ClassText},
+		{"go generated header", "// Code generated by protoc-gen-go. DO NOT EDIT.\npackage pb\n", ClassGenerated},
+		{"generated tag in a line comment", "// @generated by relay-compiler\nexport {}\n", ClassGenerated},
+		{"generated tag in a block comment", "/**\n * @generated SignedSource<<abc>>\n */\n", ClassGenerated},
+		{"generated tag in a hash comment", "# @generated by pip-compile\nrequests==2.0\n", ClassGenerated},
+		{"java annotation", "package a;\n\n@Generated(\"dagger\")\nclass Foo {}\n", ClassText},
+		{"java annotation import", "package a;\n\nimport javax.annotation.Generated;\n", ClassText},
+		{"capitalized tag in a comment", "/** This class is @Generated by hand. */\nclass Foo {}\n", ClassText},
+		{"tag outside a comment", "var tag = \"@generated\"\n", ClassText},
+		{"binary", "PK\x03\x04\x00\x00", ClassBinary},
+	}
+	for _, tt := range tests {
+		if got := classifyContent([]byte(tt.content), false); got != tt.want {
+			t.Errorf("%s: classifyContent = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package walker
+
+import (
+	"bufio"
+	"bytes"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// IgnoreFileNames are the per-directory ignore files honored by the walker,
+// in increasing order of precedence within a single directory.
+var IgnoreFileNames = []string{".gitignore", ".ignore"}
+
+// gitInfoExclude is the repository-wide exclude file, relative to the root.
+const gitInfoExclude = ".git/info/exclude"
+
+// ignoreRule is a single parsed line from a gitignore-style file.
+type ignoreRule struct {
+	matcher pathMatcher // Compiled pattern, relative to base
+	base    string      // Directory containing the ignore file ("." for the root)
+	negate  bool        // Pattern started with '!' and re-includes matches
+	dirOnly bool        // Pattern ended with '/' and only matches directories
+}
+
+// match reports whether the rule applies to relPath (relative to the walk root).
+func (r ignoreRule) match(relPath string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+
+	// Rules only apply to paths below the directory holding the ignore file
+	rel := relPath
+	if r.base != "." {
+		if !strings.HasPrefix(relPath, r.base+"/") {
+			return false
+		}
+		rel = strings.TrimPrefix(relPath, r.base+"/")
+	}
+
+	return r.matcher.match(rel)
+}
+
+// parseIgnoreFile parses the contents of a gitignore-style file located in base.
+func parseIgnoreFile(data []byte, base string) []ignoreRule {
+	var rules []ignoreRule
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if rule, ok := parseIgnoreLine(scanner.Text(), base); ok {
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules
+}
+
+// parseIgnoreLine converts a single gitignore line into a rule following
+// the semantics described in gitignore(5).
+func parseIgnoreLine(line string, base string) (ignoreRule, bool) {
+	line = strings.TrimSuffix(line, "\r")
+
+	// Blank lines and comments never match anything
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+
+	// Trailing spaces are ignored unless escaped with a backslash
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = strings.TrimSuffix(line, " ")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+
+	rule := ignoreRule{base: base}
+
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+		// Escaped leading '!' or '#' is a literal character
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+
+	// A slash at the beginning or in the middle anchors the pattern to the
+	// directory of the ignore file; otherwise it matches at any depth.
+	if strings.HasPrefix(line, "/") {
+		line = strings.TrimPrefix(line, "/")
+	} else if !strings.Contains(line, "/") {
+		line = "**/" + line
+	}
+	if !doublestar.ValidatePattern(line) {
+		return ignoreRule{}, false
+	}
+
+	if strings.HasPrefix(line, "**/") {
+		rule.matcher, _ = compilePattern(line)
+	} else {
+		// Anchored patterns must not fall back to base-name matching
+		rule.matcher = pathMatcher{pattern: line, kind: matchGlob}
+	}
+	return rule, true
+}
+
+// loadExcludeRules reads .git/info/exclude, which applies to the whole tree
+// with the lowest precedence.
+func loadExcludeRules(fsys fs.FS) []ignoreRule {
+	data, err := fs.ReadFile(fsys, gitInfoExclude)
+	if err != nil {
+		return nil
+	}
+	return parseIgnoreFile(data, ".")
+}
+
+// loadIgnoreRules reads the ignore files contained directly in dir.
+func loadIgnoreRules(fsys fs.FS, dir string) []ignoreRule {
+	var rules []ignoreRule
+	for _, name := range IgnoreFileNames {
+		data, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if err != nil {
+			continue // Missing or unreadable ignore files are simply skipped
+		}
+		rules = append(rules, parseIgnoreFile(data, dir)...)
+	}
+	return rules
+}
+
+// ignoredBy reports whether relPath is excluded by rules, which must be
+// ordered from lowest to highest precedence: .git/info/exclude first, then
+// ignore files from the root down to the path's parent directory. The last
+// matching rule wins.
+func ignoredBy(rules []ignoreRule, relPath string, isDir bool) bool {
+	ignored := false
+	for _, rule := range rules {
+		if rule.match(relPath, isDir) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
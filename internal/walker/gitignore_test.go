@@ -0,0 +1,158 @@
+package walker
+
+import (
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// gitignoreCases are ignore files, with the files that remain visible in a
+// tree holding every file of the case.
+var gitignoreCases = []struct {
+	name    string
+	ignores map[string]string // Ignore files by path, .git/info/exclude included
+	files   []string          // Other files in the tree
+	want    []string          // Files not ignored
+}{
+	{
+		name:    "negation",
+		ignores: map[string]string{".gitignore": "*.tmp\n!keep.tmp\n"},
+		files:   []string{"a.tmp", "keep.tmp", "sub/b.tmp", "sub/keep.tmp", "main.go"},
+		want:    []string{"keep.tmp", "sub/keep.tmp", "main.go"},
+	},
+	{
+		name:    "no re-inclusion under an excluded directory",
+		ignores: map[string]string{".gitignore": "output/\n!output/keep.go\n"},
+		files:   []string{"output/out.go", "output/keep.go", "main.go"},
+		want:    []string{"main.go"},
+	},
+	{
+		name:    "re-inclusion when the directory content is excluded",
+		ignores: map[string]string{".gitignore": "output/*\n!output/keep.go\n"},
+		files:   []string{"output/out.go", "output/keep.go", "main.go"},
+		want:    []string{"output/keep.go", "main.go"},
+	},
+	{
+		name:    "anchored and unanchored patterns",
+		ignores: map[string]string{".gitignore": "/top.go\nany.go\nsub/x.go\n"},
+		files:   []string{"top.go", "d/top.go", "any.go", "d/any.go", "sub/x.go", "d/sub/x.go", "sub/y.go"},
+		want:    []string{"d/top.go", "d/sub/x.go", "sub/y.go"},
+	},
+	{
+		name:    "directory-only patterns",
+		ignores: map[string]string{".gitignore": "cache/\n"},
+		files:   []string{"cache/a.go", "d/cache/b.go", "d/cache.go", "other/cache"},
+		want:    []string{"d/cache.go", "other/cache"},
+	},
+	{
+		name:    "double-star patterns",
+		ignores: map[string]string{".gitignore": "**/gen/*.go\ndocs/**\na/**/z.go\n"},
+		files: []string{
+			"gen/a.go", "x/gen/b.go", "x/gen/sub/c.go", "docs/guide.md", "docs/deep/api.md",
+			"a/z.go", "a/b/z.go", "a/b/c/z.go", "a/b/y.go", "b/a/z.go",
+		},
+		want: []string{"x/gen/sub/c.go", "a/b/y.go", "b/a/z.go"},
+	},
+	{
+		name: "nested ignore files take precedence",
+		ignores: map[string]string{
+			".gitignore":            "*.txt\n",
+			"sub/.gitignore":        "!notes.txt\n",
+			"sub/deeper/.gitignore": "notes.txt\n",
+		},
+		files: []string{"notes.txt", "sub/notes.txt", "sub/other.txt", "sub/deeper/notes.txt", "sub/deeper/more/notes.txt"},
+		want:  []string{"sub/notes.txt"},
+	},
+	{
+		name: "nested patterns are relative to their directory",
+		ignores: map[string]string{
+			"sub/.gitignore": "/local.go\ndir/*.go\n",
+		},
+		files: []string{"local.go", "sub/local.go", "sub/x/local.go", "sub/dir/a.go", "sub/x/dir/a.go", "dir/a.go"},
+		want:  []string{"local.go", "sub/x/local.go", "sub/x/dir/a.go", "dir/a.go"},
+	},
+	{
+		name: "info/exclude has the lowest precedence",
+		ignores: map[string]string{
+			".git/info/exclude": "*.go\n",
+			".gitignore":        "!keep.go\n",
+		},
+		files: []string{"a.go", "keep.go", "sub/keep.go", "readme.md"},
+		want:  []string{"keep.go", "sub/keep.go", "readme.md"},
+	},
+	{
+		name: ".ignore overrides .gitignore in the same directory",
+		ignores: map[string]string{
+			"pkg/.gitignore": "local.go\ngenerated.go\n",
+			"pkg/.ignore":    "!local.go\nscratch.go\n",
+		},
+		files: []string{"pkg/local.go", "pkg/generated.go", "pkg/scratch.go", "pkg/main.go"},
+		want:  []string{"pkg/local.go", "pkg/main.go"},
+	},
+	{
+		name:    "comments, escapes and trailing spaces",
+		ignores: map[string]string{".gitignore": "# comment.go\n\\#hash.go\ntrail.go   \n\\!bang.go\n\n"},
+		files:   []string{"comment.go", "#hash.go", "trail.go", "!bang.go", "main.go"},
+		want:    []string{"comment.go", "main.go"},
+	},
+}
+
+// caseFiles returns the contents of a case's tree by path.
+func caseFiles(ignores map[string]string, names []string) map[string]string {
+	files := make(map[string]string)
+	for name, content := range ignores {
+		files[name] = content
+	}
+	for _, name := range names {
+		files[name] = "package x\n"
+	}
+	return files
+}
+
+func TestGitignoreRules(t *testing.T) {
+	for _, tt := range gitignoreCases {
+		t.Run(tt.name, func(t *testing.T) {
+			files := caseFiles(tt.ignores, tt.files)
+			assertFiles(t, "ignore files", walkTree(t, files, Options{}), tt.want...)
+			assertFiles(t, "NoGitignore", walkTree(t, files, Options{NoGitignore: true}), tt.files...)
+		})
+	}
+}
+
+func TestGitignoreRulesMatchGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	for _, tt := range gitignoreCases {
+		if _, ok := tt.ignores["pkg/.ignore"]; ok {
+			continue // Git does not read .ignore files
+		}
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeTree(t, caseFiles(tt.ignores, tt.files))
+			cmd := exec.Command("git", "init", "-q")
+			cmd.Dir = dir
+			if out, err := cmd.CombinedOutput(); err != nil {
+				t.Fatalf("git init: %v\n%s", err, out)
+			}
+
+			// Untracked files git does not ignore
+			cmd = exec.Command("git", "-c", "core.quotePath=false", "ls-files", "--others", "--exclude-standard")
+			cmd.Dir = dir
+			out, err := cmd.Output()
+			if err != nil {
+				t.Fatalf("git ls-files: %v", err)
+			}
+			var want []string
+			for _, name := range strings.Fields(string(out)) {
+				if path.Base(name) != ".gitignore" {
+					want = append(want, name)
+				}
+			}
+			sort.Strings(want)
+
+			assertFiles(t, "walk", walkFiles(t, Options{TargetPath: dir}), want...)
+		})
+	}
+}
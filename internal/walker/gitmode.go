@@ -0,0 +1,260 @@
+package walker
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/waqasraz/code-context/internal/gitrepo"
+)
+
+// GitMode selects which files a git-aware walk reports.
+type GitMode string
+
+const (
+	GitModeNone     GitMode = ""         // Walk the file system as-is
+	GitModeTracked  GitMode = "tracked"  // Only files tracked in the git index
+	GitModeDiff     GitMode = "diff"     // Only files changed between GitBase and GitHead
+	GitModeWorktree GitMode = "worktree" // Only files changed in the working tree (plus untracked files)
+)
+
+// gitSelection is the set of files chosen by a git-aware walk mode.
+type gitSelection struct {
+	files     map[string]gitrepo.Change // Selected files, relative to the walk root
+	dirs      map[string]bool           // Ancestor directories of selected files
+	untracked bool                      // Whether untracked files are selected as added
+	tracked   map[string]bool           // All tracked files (only set when untracked is true)
+	tree      fs.FS                     // Files of a diff head that is not checked out, below the walk root
+	repo      *gitrepo.Repo             // Repository read by tree, open until close
+}
+
+// newGitSelection reads the repository containing opts.TargetPath and
+// computes the files selected by opts.GitMode. When a diff's head is not the
+// checked out commit, the selection also carries the head's tree, since the
+// working tree does not hold the changed files as of head; call close when
+// done with it.
+func newGitSelection(opts Options) (*gitSelection, error) {
+	repo, err := gitrepo.Open(opts.TargetPath)
+	if err != nil {
+		return nil, err
+	}
+	keepOpen := false
+	defer func() {
+		if !keepOpen {
+			repo.Close()
+		}
+	}()
+
+	// Git reports paths relative to the work tree; the walk may start below it
+	prefix, err := repoPrefix(repo.WorkTree, opts.TargetPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []gitrepo.Change
+	sel := &gitSelection{
+		files: make(map[string]gitrepo.Change),
+		dirs:  map[string]bool{".": true},
+	}
+
+	switch opts.GitMode {
+	case GitModeTracked:
+		tracked, err := repo.TrackedFiles()
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range tracked {
+			changes = append(changes, gitrepo.Change{Path: p})
+		}
+
+	case GitModeDiff:
+		base, head, err := resolveRange(repo, opts.GitBase, opts.GitHead)
+		if err != nil {
+			return nil, err
+		}
+		if changes, err = repo.DiffCommits(base, head); err != nil {
+			return nil, fmt.Errorf("error diffing %s and %s: %w", base, head, err)
+		}
+		if !isCheckedOut(repo, head) {
+			if sel.tree, err = headTree(repo, head, prefix); err != nil {
+				return nil, err
+			}
+			sel.repo = repo
+			keepOpen = true
+		}
+
+	case GitModeWorktree:
+		if changes, err = repo.WorktreeChanges(); err != nil {
+			return nil, fmt.Errorf("error reading working tree changes: %w", err)
+		}
+		tracked, err := repo.TrackedFiles()
+		if err != nil {
+			return nil, err
+		}
+		sel.untracked = true
+		sel.tracked = make(map[string]bool)
+		for _, p := range tracked {
+			if rel, ok := trimPrefix(p, prefix); ok {
+				sel.tracked[rel] = true
+			}
+		}
+
+	default:
+		return nil, fmt.Errorf("unknown git mode %q", opts.GitMode)
+	}
+
+	for _, c := range changes {
+		if c.Status == gitrepo.StatusDeleted {
+			continue // Nothing on disk to scan
+		}
+		rel, ok := trimPrefix(c.Path, prefix)
+		if !ok {
+			continue // Outside the target directory
+		}
+		if oldRel, ok := trimPrefix(c.OldPath, prefix); ok {
+			c.OldPath = oldRel
+		}
+		c.Path = rel
+		sel.files[rel] = c
+
+		for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+			sel.dirs[dir] = true
+		}
+	}
+
+	return sel, nil
+}
+
+// DiffHead resolves the head of the GitModeDiff range given by base and head
+// in the repository containing target, and reports whether it is the checked
+// out commit. Otherwise the walk reads the changed files from the head's
+// tree, and so should callers reading their contents.
+func DiffHead(target, base, head string) (string, bool, error) {
+	repo, err := gitrepo.Open(target)
+	if err != nil {
+		return "", false, err
+	}
+	defer repo.Close()
+	_, headHash, err := resolveRange(repo, base, head)
+	if err != nil {
+		return "", false, err
+	}
+	return headHash.String(), isCheckedOut(repo, headHash), nil
+}
+
+// isCheckedOut reports whether commit is HEAD, whose files are in the
+// working tree.
+func isCheckedOut(repo *gitrepo.Repo, commit gitrepo.Hash) bool {
+	checkedOut, err := repo.ResolveRevision("HEAD")
+	return err == nil && checkedOut == commit
+}
+
+// headTree returns the tree of the head commit of a diff, below the
+// directory prefix.
+func headTree(repo *gitrepo.Repo, head gitrepo.Hash, prefix string) (fs.FS, error) {
+	tree, err := repo.CommitFS(head.String())
+	if err != nil {
+		return nil, fmt.Errorf("error reading revision %s: %w", head, err)
+	}
+	if prefix == "" {
+		return tree, nil
+	}
+	return fs.Sub(tree, strings.TrimSuffix(prefix, "/"))
+}
+
+// close releases the repository read by the head's tree, if any.
+func (s *gitSelection) close() {
+	if s.repo != nil {
+		s.repo.Close()
+	}
+}
+
+// resolveRange resolves the base and head revisions of a diff. A base of the
+// form "a...b" or "a..b" carries both ends; with "..." the merge base of a
+// and b is used, matching git diff. An empty head defaults to HEAD.
+func resolveRange(repo *gitrepo.Repo, base, head string) (gitrepo.Hash, gitrepo.Hash, error) {
+	useMergeBase := false
+	if a, b, ok := strings.Cut(base, "..."); ok {
+		base, head, useMergeBase = a, b, true
+	} else if a, b, ok := strings.Cut(base, ".."); ok {
+		base, head = a, b
+	}
+	if base == "" {
+		return gitrepo.ZeroHash, gitrepo.ZeroHash, fmt.Errorf("git diff mode requires a base revision")
+	}
+	if head == "" {
+		head = "HEAD"
+	}
+
+	baseHash, err := repo.ResolveRevision(base)
+	if err != nil {
+		return gitrepo.ZeroHash, gitrepo.ZeroHash, err
+	}
+	headHash, err := repo.ResolveRevision(head)
+	if err != nil {
+		return gitrepo.ZeroHash, gitrepo.ZeroHash, err
+	}
+
+	if useMergeBase {
+		if baseHash, err = repo.MergeBase(baseHash, headHash); err != nil {
+			return gitrepo.ZeroHash, gitrepo.ZeroHash, err
+		}
+	}
+
+	return baseHash, headHash, nil
+}
+
+// repoPrefix returns the slash-separated path of target relative to workTree,
+// with a trailing slash, or "" when they are the same directory.
+func repoPrefix(workTree, target string) (string, error) {
+	// Resolve symlinks so /tmp and /private/tmp style aliases compare equal
+	if resolved, err := filepath.EvalSymlinks(workTree); err == nil {
+		workTree = resolved
+	}
+	if resolved, err := filepath.EvalSymlinks(target); err == nil {
+		target = resolved
+	}
+
+	rel, err := filepath.Rel(workTree, target)
+	if err != nil {
+		return "", fmt.Errorf("error locating %s in repository %s: %w", target, workTree, err)
+	}
+	rel = filepath.ToSlash(rel)
+	if rel == "." {
+		return "", nil
+	}
+	return rel + "/", nil
+}
+
+// trimPrefix strips prefix from a repository path, reporting whether the
+// path lies inside the prefix directory.
+func trimPrefix(p, prefix string) (string, bool) {
+	if p == "" {
+		return "", false
+	}
+	if prefix == "" {
+		return p, true
+	}
+	if !strings.HasPrefix(p, prefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(p, prefix), true
+}
+
+// selectFile reports whether a file is selected and its change status.
+func (s *gitSelection) selectFile(relPath string) (gitrepo.Change, bool) {
+	if c, ok := s.files[relPath]; ok {
+		return c, true
+	}
+	if s.untracked && !s.tracked[relPath] {
+		return gitrepo.Change{Path: relPath, Status: gitrepo.StatusAdded}, true
+	}
+	return gitrepo.Change{}, false
+}
+
+// keepDir reports whether the walk needs to descend into a directory.
+func (s *gitSelection) keepDir(relPath string) bool {
+	return s.untracked || s.dirs[relPath]
+}
@@ -0,0 +1,180 @@
+package walker
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// gitRun runs git in dir with a fixed identity and no user configuration.
+func gitRun(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_CONFIG_NOSYSTEM=1", "GIT_CONFIG_GLOBAL="+os.DevNull,
+		"GIT_AUTHOR_NAME=Test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=Test", "GIT_COMMITTER_EMAIL=test@example.com",
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+}
+
+// newGitTree creates a repository with two commits and uncommitted changes:
+//
+//	HEAD~1: .gitignore, main.go, pkg/a.go, pkg/b.go, forced.tmp (tracked despite *.tmp)
+//	HEAD:   pkg/a.go modified, pkg/b.go renamed to pkg/b2.go, pkg/c.go added
+//	work:   main.go modified, untracked u.go, ignored scratch.tmp
+func newGitTree(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := writeTree(t, map[string]string{
+		".gitignore": "*.tmp\n",
+		"main.go":    "package main\n",
+		"pkg/a.go":   "package pkg\n",
+		"pkg/b.go":   "package pkg\n\nfunc B() {}\n",
+		"forced.tmp": "tracked anyway\n",
+	})
+	gitRun(t, dir, "init", "-q")
+	gitRun(t, dir, "add", "-A")
+	gitRun(t, dir, "add", "-f", "forced.tmp")
+	gitRun(t, dir, "commit", "-q", "-m", "first")
+
+	for name, content := range map[string]string{"pkg/a.go": "package pkg\n\nfunc A() {}\n", "pkg/c.go": "package pkg\n"} {
+		if err := os.WriteFile(filepath.Join(dir, filepath.FromSlash(name)), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gitRun(t, dir, "mv", "pkg/b.go", "pkg/b2.go")
+	gitRun(t, dir, "add", "-A")
+	gitRun(t, dir, "commit", "-q", "-m", "second")
+
+	for name, content := range map[string]string{"main.go": "package main\n\nfunc main() {}\n", "u.go": "package main\n", "scratch.tmp": "x\n"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// walkChanges walks opts and returns the git status of each reported file,
+// as "status" or "status from old/path" for renames.
+func walkChanges(t *testing.T, opts Options) map[string]string {
+	t.Helper()
+	changes := make(map[string]string)
+	for r := range Walk(opts) {
+		if r.Err != nil {
+			t.Fatalf("walk error at %q: %v", r.Path, r.Err)
+		}
+		if r.IsDir || filepath.Base(r.Path) == ".gitignore" {
+			continue
+		}
+		status := string(r.GitStatus)
+		if r.OldPath != "" {
+			status += " from " + filepath.ToSlash(r.OldPath)
+		}
+		changes[filepath.ToSlash(r.Path)] = status
+	}
+	return changes
+}
+
+func TestWalkGitModes(t *testing.T) {
+	dir := newGitTree(t)
+	committed := map[string]string{
+		"pkg/a.go":  "modified",
+		"pkg/b2.go": "renamed from pkg/b.go",
+		"pkg/c.go":  "added",
+	}
+	tests := []struct {
+		name string
+		opts Options
+		want map[string]string
+	}{
+		{
+			name: "tracked",
+			opts: Options{GitMode: GitModeTracked},
+			want: map[string]string{"main.go": "", "forced.tmp": "", "pkg/a.go": "", "pkg/b2.go": "", "pkg/c.go": ""},
+		},
+		{"diff against a base", Options{GitMode: GitModeDiff, GitBase: "HEAD~1"}, committed},
+		{"diff of a range", Options{GitMode: GitModeDiff, GitBase: "HEAD~1..HEAD"}, committed},
+		{"diff from the merge base", Options{GitMode: GitModeDiff, GitBase: "HEAD~1...HEAD"}, committed},
+		{"diff without changes", Options{GitMode: GitModeDiff, GitBase: "HEAD"}, map[string]string{}},
+		{
+			name: "worktree",
+			opts: Options{GitMode: GitModeWorktree},
+			want: map[string]string{"main.go": "modified", "u.go": "added"},
+		},
+	}
+	for _, tt := range tests {
+		tt.opts.TargetPath = dir
+		if got := walkChanges(t, tt.opts); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: walked %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// Paths are relative to the walk root when it is below the work tree
+	got := walkChanges(t, Options{TargetPath: filepath.Join(dir, "pkg"), GitMode: GitModeDiff, GitBase: "HEAD~1"})
+	want := map[string]string{"a.go": "modified", "b2.go": "renamed from b.go", "c.go": "added"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("diff below the work tree: walked %v, want %v", got, want)
+	}
+}
+
+func TestWalkGitDiffOfOtherHead(t *testing.T) {
+	dir := newGitTree(t)
+	gitRun(t, dir, "branch", "feature")
+	gitRun(t, dir, "checkout", "-q", "HEAD~1")
+
+	// The working tree holds the first commit: pkg/b2.go and pkg/c.go are
+	// missing, and pkg/a.go is the old version
+	wantSizes := map[string]int64{
+		"pkg/a.go":  int64(len("package pkg\n\nfunc A() {}\n")),
+		"pkg/b2.go": int64(len("package pkg\n\nfunc B() {}\n")),
+		"pkg/c.go":  int64(len("package pkg\n")),
+	}
+	for _, base := range []string{"HEAD..feature", "HEAD...feature"} {
+		sizes := make(map[string]int64)
+		for r := range Walk(Options{TargetPath: dir, GitMode: GitModeDiff, GitBase: base}) {
+			if r.Err != nil {
+				t.Fatalf("%s: walk error at %q: %v", base, r.Path, r.Err)
+			}
+			if !r.IsDir {
+				sizes[filepath.ToSlash(r.Path)] = r.Size
+			}
+		}
+		if !reflect.DeepEqual(sizes, wantSizes) {
+			t.Errorf("%s: walked %v, want %v", base, sizes, wantSizes)
+		}
+	}
+
+	got := walkChanges(t, Options{TargetPath: filepath.Join(dir, "pkg"), GitMode: GitModeDiff, GitBase: "HEAD", GitHead: "feature"})
+	want := map[string]string{"a.go": "modified", "b2.go": "renamed from b.go", "c.go": "added"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("diff of another head below the work tree: walked %v, want %v", got, want)
+	}
+}
+
+func TestWalkGitModeErrors(t *testing.T) {
+	dir := newGitTree(t)
+	for _, opts := range []Options{
+		{TargetPath: dir, GitMode: GitModeDiff},
+		{TargetPath: dir, GitMode: GitModeDiff, GitBase: "missing"},
+		{TargetPath: t.TempDir(), GitMode: GitModeTracked},
+	} {
+		var errs int
+		for r := range Walk(opts) {
+			if r.Err != nil {
+				errs++
+			}
+		}
+		if errs == 0 {
+			t.Errorf("walk with %+v reported no error", opts)
+		}
+	}
+}
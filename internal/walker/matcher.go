@@ -0,0 +1,134 @@
+package walker
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// matchKind selects how a compiled pattern is evaluated.
+type matchKind int
+
+const (
+	matchGlob      matchKind = iota // Full doublestar match against the path
+	matchBase                       // Glob against the base name ("*.log", "**/foo")
+	matchSuffix                     // Base name ends with a literal ("**/*.json")
+	matchLiteral                    // Base name equals a literal ("**/.env")
+	matchComponent                  // Any path component matches ("**/node_modules/**")
+)
+
+// pathMatcher is a glob pattern compiled once so that the common shapes
+// ("**/*.ext", "**/name", "**/dir/**") avoid a full doublestar match.
+type pathMatcher struct {
+	pattern string    // Original (slash-separated) pattern
+	kind    matchKind // Evaluation strategy
+	operand string    // Literal or single-component glob used by the fast paths
+}
+
+// compilePattern prepares a pattern for repeated matching. Patterns without
+// a slash match the base name of a path, mirroring the historic behavior of
+// --ignore.
+func compilePattern(pattern string) (pathMatcher, error) {
+	pattern = filepath.ToSlash(pattern)
+	if !doublestar.ValidatePattern(pattern) {
+		return pathMatcher{}, fmt.Errorf("invalid glob pattern %q", pattern)
+	}
+	m := pathMatcher{pattern: pattern, kind: matchGlob}
+
+	// "**/x/**": x anywhere as a path component
+	if inner, ok := strings.CutPrefix(pattern, "**/"); ok {
+		if comp, ok := strings.CutSuffix(inner, "/**"); ok && isSingleComponent(comp) {
+			m.kind, m.operand = matchComponent, comp
+			return m, nil
+		}
+		if isSingleComponent(inner) {
+			return compileBase(m, inner), nil
+		}
+		return m, nil
+	}
+
+	if isSingleComponent(pattern) {
+		return compileBase(m, pattern), nil
+	}
+
+	return m, nil
+}
+
+// compileBase picks the cheapest way to match a base-name pattern.
+func compileBase(m pathMatcher, base string) pathMatcher {
+	switch {
+	case !hasMeta(base):
+		m.kind, m.operand = matchLiteral, base
+	case strings.HasPrefix(base, "*") && !hasMeta(base[1:]):
+		m.kind, m.operand = matchSuffix, base[1:]
+	default:
+		m.kind, m.operand = matchBase, base
+	}
+	return m
+}
+
+// isSingleComponent reports whether p is a single path component that
+// path.Match can evaluate with the same semantics as doublestar.
+func isSingleComponent(p string) bool {
+	return p != "" && !strings.Contains(p, "/") && !strings.Contains(p, "**") && !strings.ContainsAny(p, "{}")
+}
+
+// hasMeta reports whether s contains glob metacharacters.
+func hasMeta(s string) bool {
+	return strings.ContainsAny(s, "*?[\\")
+}
+
+// match reports whether a slash-separated relative path matches.
+func (m pathMatcher) match(relPath string) bool {
+	switch m.kind {
+	case matchLiteral:
+		return path.Base(relPath) == m.operand
+	case matchSuffix:
+		return strings.HasSuffix(path.Base(relPath), m.operand)
+	case matchBase:
+		matched, _ := path.Match(m.operand, path.Base(relPath))
+		return matched
+	case matchComponent:
+		for _, comp := range strings.Split(relPath, "/") {
+			if hasMeta(m.operand) {
+				if matched, _ := path.Match(m.operand, comp); matched {
+					return true
+				}
+			} else if comp == m.operand {
+				return true
+			}
+		}
+		return false
+	default:
+		matched, _ := doublestar.Match(m.pattern, relPath)
+		return matched
+	}
+}
+
+// compilePatterns compiles a list of patterns, skipping invalid ones with a warning.
+func compilePatterns(patterns []string) ([]pathMatcher, []error) {
+	var matchers []pathMatcher
+	var errs []error
+	for _, p := range patterns {
+		m, err := compilePattern(p)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		matchers = append(matchers, m)
+	}
+	return matchers, errs
+}
+
+// matchAny reports whether any matcher matches relPath.
+func matchAny(matchers []pathMatcher, relPath string) bool {
+	for _, m := range matchers {
+		if m.match(relPath) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,178 @@
+package walker
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+)
+
+// Metadata describes a file as observed during the walk, so that later
+// stages do not have to stat or re-read it.
+type Metadata struct {
+	Size       int64       // Size in bytes
+	ModTime    time.Time   // Last modification time
+	Mode       fs.FileMode // File mode bits (includes fs.ModeSymlink for links)
+	Hash       string      // Hex-encoded SHA-256 of the content
+	Language   string      // Detected language (e.g. "Go", "TypeScript"), empty if unknown
+	Lines      int         // Number of lines
+	LinkTarget string      // Target of the link when the file is a symlink
+}
+
+// inspectFile classifies a file and, when its class is included by policy,
+// collects its metadata in a single read pass.
+func inspectFile(fsys fs.FS, name string, d fs.DirEntry, policy ClassPolicy) (FileClass, Metadata, error) {
+	var meta Metadata
+
+	// Lstat-style info from the directory entry: symlinks keep their own mode
+	if info, err := d.Info(); err == nil {
+		meta.Mode = info.Mode()
+		meta.ModTime = info.ModTime()
+		meta.Size = info.Size()
+	}
+
+	f, err := fsys.Open(name)
+	if err != nil {
+		return "", meta, err
+	}
+	defer f.Close()
+
+	// The open file knows the size of the content (links report their
+	// target's, and some file systems only learn it on open)
+	if info, err := f.Stat(); err == nil {
+		meta.Size = info.Size()
+		if meta.Mode&fs.ModeSymlink != 0 {
+			meta.ModTime = info.ModTime()
+		}
+	}
+
+	head := make([]byte, sniffSize)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", meta, err
+	}
+	head = head[:n]
+
+	class := classifyName(name)
+	if class == "" {
+		class = classifyContent(head, n == sniffSize)
+	}
+	if !policy.Includes(class) {
+		return class, meta, nil // Excluded files are not read any further
+	}
+
+	// Hash and count lines over the whole file
+	hasher := sha256.New()
+	hasher.Write(head)
+	lines := bytes.Count(head, []byte("\n"))
+	last := byte('\n')
+	if n > 0 {
+		last = head[n-1]
+	}
+	buf := make([]byte, 32*1024)
+	for {
+		m, err := f.Read(buf)
+		if m > 0 {
+			hasher.Write(buf[:m])
+			lines += bytes.Count(buf[:m], []byte("\n"))
+			last = buf[m-1]
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", meta, err
+		}
+	}
+	if last != '\n' {
+		lines++ // Final line without a trailing newline
+	}
+
+	meta.Hash = hex.EncodeToString(hasher.Sum(nil))
+	meta.Lines = lines
+	if class != ClassBinary {
+		meta.Language = DetectLanguage(name, head)
+	}
+
+	return class, meta, nil
+}
+
+// languageByExtension maps lowercase file extensions to language names.
+var languageByExtension = map[string]string{
+	".go": "Go", ".py": "Python", ".pyi": "Python", ".js": "JavaScript",
+	".mjs": "JavaScript", ".cjs": "JavaScript", ".jsx": "JavaScript",
+	".ts": "TypeScript", ".mts": "TypeScript", ".cts": "TypeScript", ".tsx": "TypeScript",
+	".java": "Java", ".kt": "Kotlin", ".kts": "Kotlin", ".scala": "Scala",
+	".groovy": "Groovy", ".gradle": "Groovy", ".cs": "C#", ".fs": "F#",
+	".vb": "Visual Basic", ".c": "C", ".h": "C", ".cc": "C++", ".cpp": "C++",
+	".cxx": "C++", ".hpp": "C++", ".hh": "C++", ".m": "Objective-C",
+	".mm": "Objective-C++", ".swift": "Swift", ".rs": "Rust", ".rb": "Ruby",
+	".php": "PHP", ".pl": "Perl", ".pm": "Perl", ".lua": "Lua", ".r": "R",
+	".dart": "Dart", ".ex": "Elixir", ".exs": "Elixir", ".erl": "Erlang",
+	".hs": "Haskell", ".clj": "Clojure", ".ml": "OCaml", ".zig": "Zig",
+	".sh": "Shell", ".bash": "Shell", ".zsh": "Shell", ".ps1": "PowerShell",
+	".psm1": "PowerShell", ".bat": "Batch", ".cmd": "Batch", ".sql": "SQL",
+	".html": "HTML", ".htm": "HTML", ".css": "CSS", ".scss": "SCSS",
+	".sass": "Sass", ".less": "Less", ".vue": "Vue", ".svelte": "Svelte",
+	".cshtml": "Razor", ".razor": "Razor", ".json": "JSON", ".yaml": "YAML",
+	".yml": "YAML", ".toml": "TOML", ".xml": "XML", ".ini": "INI",
+	".proto": "Protocol Buffers", ".graphql": "GraphQL", ".gql": "GraphQL",
+	".tf": "Terraform", ".hcl": "HCL", ".md": "Markdown", ".rst": "reStructuredText",
+	".tex": "TeX", ".csproj": "MSBuild", ".sln": "Visual Studio Solution",
+}
+
+// languageByName maps well-known file names without a useful extension.
+var languageByName = map[string]string{
+	"dockerfile":     "Dockerfile",
+	"makefile":       "Makefile",
+	"gnumakefile":    "Makefile",
+	"cmakelists.txt": "CMake",
+	"jenkinsfile":    "Groovy",
+	"rakefile":       "Ruby",
+	"gemfile":        "Ruby",
+	"go.mod":         "Go Module",
+	"go.work":        "Go Workspace",
+}
+
+// languageByInterpreter maps shebang interpreters to language names.
+var languageByInterpreter = map[string]string{
+	"sh": "Shell", "bash": "Shell", "zsh": "Shell", "python": "Python",
+	"python3": "Python", "node": "JavaScript", "ruby": "Ruby", "perl": "Perl",
+	"php": "PHP", "pwsh": "PowerShell",
+}
+
+// DetectLanguage guesses the language of a file from its name, falling back
+// to a shebang line in head.
+func DetectLanguage(name string, head []byte) string {
+	base := strings.ToLower(path.Base(name))
+	if lang, ok := languageByName[base]; ok {
+		return lang
+	}
+	if strings.HasPrefix(base, "dockerfile.") || strings.HasSuffix(base, ".dockerfile") {
+		return "Dockerfile"
+	}
+	if lang, ok := languageByExtension[path.Ext(base)]; ok {
+		return lang
+	}
+
+	// "#!/usr/bin/env python3" or "#!/bin/bash"
+	if bytes.HasPrefix(head, []byte("#!")) {
+		line, _, _ := bytes.Cut(head[2:], []byte("\n"))
+		fields := strings.Fields(string(line))
+		if len(fields) > 0 {
+			interpreter := path.Base(fields[0])
+			if interpreter == "env" && len(fields) > 1 {
+				interpreter = fields[1]
+			}
+			if lang, ok := languageByInterpreter[interpreter]; ok {
+				return lang
+			}
+		}
+	}
+
+	return ""
+}
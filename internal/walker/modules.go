@@ -0,0 +1,408 @@
+package walker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// Module is a buildable unit inside a (mono)repository: a Go module, an npm
+// package, a Cargo crate, a Maven/Gradle module or a .NET project.
+type Module struct {
+	Name string // Name from the manifest (module path, package name, artifactId, ...)
+	Path string // Slash-separated directory relative to the root ("." for the root)
+	Kind string // "go", "npm", "cargo", "maven", "gradle" or "dotnet"
+}
+
+// String returns the name followed by the path when they differ.
+func (m Module) String() string {
+	if m.Name == "" || m.Name == m.Path {
+		return m.Path
+	}
+	return fmt.Sprintf("%s (%s)", m.Name, m.Path)
+}
+
+// workspace lists the member directories declared by an aggregator manifest
+// (go.work, npm/pnpm workspaces, Cargo workspaces, Maven <modules>, Gradle
+// settings, .NET solutions).
+type workspace struct {
+	dir     string   // Directory of the aggregator manifest
+	kind    string   // Kind given to members without a manifest of their own
+	members []string // Member directories or globs, relative to dir
+}
+
+// DetectModules scans fsys for project manifests and returns the modules
+// they define, sorted by path. Directories holding a package manifest
+// (go.mod, package.json, Cargo.toml with [package], pom.xml, build.gradle,
+// *.csproj, ...) are modules; workspace manifests add their declared members.
+// Dependency and build directories (moduleScanSkip) are not scanned.
+func DetectModules(ctx context.Context, fsys fs.FS) ([]Module, error) {
+	skip, _ := compilePatterns(moduleScanSkip)
+	modules := make(map[string]Module)
+	var workspaces []workspace
+	var dirs []string
+
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // Unreadable directories are reported by the walk itself
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if d.IsDir() {
+			if p != "." && matchAny(skip, p) {
+				return fs.SkipDir
+			}
+			dirs = append(dirs, p)
+			return nil
+		}
+
+		dir := path.Dir(p)
+		name := d.Name()
+		if !isModuleManifest(name) {
+			return nil
+		}
+		data, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return nil
+		}
+
+		module, ws := parseManifest(name, data)
+		if module != nil {
+			module.Path = dir
+			if module.Name == "" {
+				module.Name = path.Base(dir)
+			}
+			// A directory can hold several manifests (e.g. pom.xml and a
+			// Gradle build); the first one found names the module
+			if _, exists := modules[dir]; !exists {
+				modules[dir] = *module
+			}
+		}
+		if ws != nil {
+			ws.dir = dir
+			workspaces = append(workspaces, *ws)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Members declared by workspaces become modules even without a manifest
+	// the scan recognized (e.g. Gradle subprojects using the root build)
+	for _, ws := range workspaces {
+		for _, member := range ws.members {
+			pattern := path.Clean(path.Join(ws.dir, member))
+			for _, dir := range dirs {
+				if matched, _ := doublestar.Match(pattern, dir); !matched {
+					continue
+				}
+				if _, exists := modules[dir]; !exists && dir != ws.dir {
+					modules[dir] = Module{Name: path.Base(dir), Path: dir, Kind: ws.kind}
+				}
+			}
+		}
+	}
+
+	list := make([]Module, 0, len(modules))
+	for _, m := range modules {
+		list = append(list, m)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Path < list[j].Path })
+	return list, nil
+}
+
+// moduleScanSkip lists the dependency and build directories not scanned for
+// manifests. Unlike the profiles' ignore lists it keeps "packages", the
+// usual home of npm workspace members.
+var moduleScanSkip = []string{
+	"**/.*/**", "**/node_modules/**", "**/bower_components/**", "**/vendor/**",
+	"**/target/**", "**/bin/**", "**/obj/**", "**/venv/**", "**/site-packages/**", "**/__pycache__/**",
+}
+
+// isModuleManifest reports whether a file name is parsed by parseManifest.
+func isModuleManifest(name string) bool {
+	switch name {
+	case "go.mod", "go.work", "package.json", "pnpm-workspace.yaml", "Cargo.toml", "pom.xml",
+		"build.gradle", "build.gradle.kts", "settings.gradle", "settings.gradle.kts":
+		return true
+	}
+	switch path.Ext(name) {
+	case ".csproj", ".fsproj", ".vbproj", ".sln":
+		return true
+	}
+	return false
+}
+
+// parseManifest extracts the module a manifest defines and the workspace
+// members it declares. Either may be nil.
+func parseManifest(name string, data []byte) (*Module, *workspace) {
+	switch name {
+	case "go.mod":
+		return &Module{Name: goModulePath(data), Kind: "go"}, nil
+	case "go.work":
+		return nil, &workspace{kind: "go", members: goWorkUses(data)}
+	case "package.json":
+		return parsePackageJSON(data)
+	case "pnpm-workspace.yaml":
+		return nil, &workspace{kind: "npm", members: pnpmPackages(data)}
+	case "Cargo.toml":
+		return parseCargoToml(data)
+	case "pom.xml":
+		return parsePom(data)
+	case "build.gradle", "build.gradle.kts":
+		return &Module{Kind: "gradle"}, nil
+	case "settings.gradle", "settings.gradle.kts":
+		return nil, &workspace{kind: "gradle", members: gradleIncludes(data)}
+	}
+
+	switch path.Ext(name) {
+	case ".csproj", ".fsproj", ".vbproj":
+		return &Module{Name: strings.TrimSuffix(name, path.Ext(name)), Kind: "dotnet"}, nil
+	case ".sln":
+		return nil, &workspace{kind: "dotnet", members: solutionProjects(data)}
+	}
+	return nil, nil
+}
+
+// goModulePath returns the module path declared in a go.mod file.
+func goModulePath(data []byte) string {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], `"`)
+		}
+	}
+	return ""
+}
+
+// goWorkUses returns the directories listed in go.work use directives.
+func goWorkUses(data []byte) []string {
+	var uses []string
+	inBlock := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		switch {
+		case inBlock && line == ")":
+			inBlock = false
+		case inBlock && line != "":
+			uses = append(uses, strings.Trim(line, `"`))
+		case line == "use (":
+			inBlock = true
+		case strings.HasPrefix(line, "use "):
+			uses = append(uses, strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "use ")), `"`))
+		}
+	}
+	return uses
+}
+
+// parsePackageJSON reads the package name and npm/yarn workspaces. A
+// package.json declaring workspaces is treated as an aggregator only.
+func parsePackageJSON(data []byte) (*Module, *workspace) {
+	var pkg struct {
+		Name       string          `json:"name"`
+		Workspaces json.RawMessage `json:"workspaces"`
+	}
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		return &Module{Kind: "npm"}, nil
+	}
+
+	var members []string
+	if len(pkg.Workspaces) > 0 {
+		if err := json.Unmarshal(pkg.Workspaces, &members); err != nil {
+			var object struct {
+				Packages []string `json:"packages"`
+			}
+			if json.Unmarshal(pkg.Workspaces, &object) == nil {
+				members = object.Packages
+			}
+		}
+	}
+	if len(members) > 0 {
+		return nil, &workspace{kind: "npm", members: members}
+	}
+	return &Module{Name: pkg.Name, Kind: "npm"}, nil
+}
+
+// pnpmPackages returns the globs listed under "packages:" in pnpm-workspace.yaml.
+func pnpmPackages(data []byte) []string {
+	var packages []string
+	inPackages := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "packages:"):
+			inPackages = true
+		case inPackages && strings.HasPrefix(trimmed, "-"):
+			entry := strings.Trim(strings.TrimSpace(strings.TrimPrefix(trimmed, "-")), `"'`)
+			if entry != "" && !strings.HasPrefix(entry, "!") {
+				packages = append(packages, entry)
+			}
+		case inPackages && trimmed != "" && !strings.HasPrefix(trimmed, "#") && !strings.HasPrefix(line, " "):
+			inPackages = false // Next top-level key
+		}
+	}
+	return packages
+}
+
+// quotedString matches a double- or single-quoted string.
+var quotedString = regexp.MustCompile(`["']([^"']+)["']`)
+
+// parseCargoToml reads the crate name from [package] and the members of
+// [workspace]. A virtual manifest (workspace without package) is not a module.
+func parseCargoToml(data []byte) (*Module, *workspace) {
+	var module *Module
+	var ws *workspace
+	section := ""
+	inMembers := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if inMembers {
+			for _, m := range quotedString.FindAllStringSubmatch(line, -1) {
+				ws.members = append(ws.members, m[1])
+			}
+			if strings.Contains(line, "]") {
+				inMembers = false
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			section = strings.Trim(line, "[] ")
+			switch section {
+			case "package":
+				module = &Module{Kind: "cargo"}
+			case "workspace":
+				ws = &workspace{kind: "cargo"}
+			}
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		switch {
+		case section == "package" && key == "name":
+			module.Name = strings.Trim(value, `"'`)
+		case section == "workspace" && key == "members":
+			for _, m := range quotedString.FindAllStringSubmatch(value, -1) {
+				ws.members = append(ws.members, m[1])
+			}
+			inMembers = strings.HasPrefix(value, "[") && !strings.Contains(value, "]")
+		}
+	}
+	return module, ws
+}
+
+var (
+	pomParent     = regexp.MustCompile(`(?s)<parent>.*?</parent>`)
+	pomArtifactID = regexp.MustCompile(`<artifactId>\s*([^<\s]+)\s*</artifactId>`)
+	pomPackaging  = regexp.MustCompile(`<packaging>\s*pom\s*</packaging>`)
+	pomModule     = regexp.MustCompile(`<module>\s*([^<\s]+)\s*</module>`)
+)
+
+// parsePom reads a Maven POM. Aggregator POMs (packaging "pom") are not
+// modules themselves, but declare their <modules>.
+func parsePom(data []byte) (*Module, *workspace) {
+	content := pomParent.ReplaceAll(data, nil)
+
+	var ws *workspace
+	for _, m := range pomModule.FindAllSubmatch(content, -1) {
+		if ws == nil {
+			ws = &workspace{kind: "maven"}
+		}
+		ws.members = append(ws.members, string(m[1]))
+	}
+	if pomPackaging.Match(content) {
+		return nil, ws
+	}
+
+	module := &Module{Kind: "maven"}
+	if m := pomArtifactID.FindSubmatch(content); m != nil {
+		module.Name = string(m[1])
+	}
+	return module, ws
+}
+
+// gradleIncludes returns the project directories from include statements in
+// a Gradle settings file (":app:core" becomes "app/core").
+func gradleIncludes(data []byte) []string {
+	var members []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "include") || strings.HasPrefix(line, "includeBuild") {
+			continue
+		}
+		for _, m := range quotedString.FindAllStringSubmatch(line, -1) {
+			members = append(members, strings.ReplaceAll(strings.TrimPrefix(m[1], ":"), ":", "/"))
+		}
+	}
+	return members
+}
+
+// solutionProject matches a project line of a .sln file.
+var solutionProject = regexp.MustCompile(`(?m)^Project\("[^"]*"\)\s*=\s*"[^"]*",\s*"([^"]+\.(?:cs|fs|vb)proj)"`)
+
+// solutionProjects returns the directories of the projects in a .sln file.
+func solutionProjects(data []byte) []string {
+	var members []string
+	for _, m := range solutionProject.FindAllSubmatch(data, -1) {
+		members = append(members, path.Dir(strings.ReplaceAll(string(m[1]), `\`, "/")))
+	}
+	return members
+}
+
+// moduleIndex finds the module owning a path.
+type moduleIndex map[string]Module
+
+// newModuleIndex indexes modules by path.
+func newModuleIndex(modules []Module) moduleIndex {
+	index := make(moduleIndex, len(modules))
+	for _, m := range modules {
+		index[m.Path] = m
+	}
+	return index
+}
+
+// owner returns the innermost module containing slashPath.
+func (idx moduleIndex) owner(slashPath string) (Module, bool) {
+	for dir := slashPath; ; dir = path.Dir(dir) {
+		if m, ok := idx[dir]; ok {
+			return m, true
+		}
+		if dir == "." || dir == "/" {
+			return Module{}, false
+		}
+	}
+}
+
+// FindModule returns the module with the given name or path.
+func FindModule(modules []Module, nameOrPath string) (Module, bool) {
+	for _, m := range modules {
+		if m.Path == nameOrPath || m.Name == nameOrPath {
+			return m, true
+		}
+	}
+	return Module{}, false
+}
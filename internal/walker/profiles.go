@@ -0,0 +1,190 @@
+package walker
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// Profile bundles the ignore rules of one ecosystem. A profile is activated
+// when one of its manifests is found anywhere in the tree, so a Go service
+// does not inherit Python or ASP.NET rules it has no use for.
+type Profile struct {
+	Name      string   // Short name used on the command line ("go", "node", ...)
+	Manifests []string // File name globs whose presence activates the profile
+	Ignore    []string // Build output, dependency and cache locations to skip
+	Allow     []string // Data files worth keeping despite the generic data-file ignores
+}
+
+// Profiles are the built-in ecosystem profiles, in reporting order.
+var Profiles = []Profile{
+	{
+		Name:      "go",
+		Manifests: []string{"go.mod", "go.work"},
+		Ignore:    []string{"**/vendor/**"},
+		Allow:     []string{"**/.golangci.yml", "**/.golangci.yaml", "**/.goreleaser.yml", "**/.goreleaser.yaml"},
+	},
+	{
+		Name:      "node",
+		Manifests: []string{"package.json"},
+		Ignore:    []string{"**/node_modules/**", "**/bower_components/**", "**/dist/**", "**/build/**", "**/*.tsbuildinfo"},
+		Allow:     []string{"**/package.json", "**/tsconfig*.json", "**/jsconfig.json"},
+	},
+	{
+		Name:      "python",
+		Manifests: []string{"pyproject.toml", "setup.py", "setup.cfg", "requirements*.txt", "Pipfile"},
+		Ignore:    []string{"**/venv/**", "**/env/**", "**/*.egg-info/**", "**/__pycache__/**", "**/site-packages/**", "**/build/**", "**/dist/**"},
+		Allow:     []string{"**/pyproject.toml", "**/setup.cfg", "**/tox.ini", "**/pytest.ini", "**/mypy.ini"},
+	},
+	{
+		Name:      "dotnet",
+		Manifests: []string{"*.csproj", "*.fsproj", "*.vbproj", "*.sln"},
+		Ignore:    []string{"**/bin/**", "**/obj/**", "**/packages/**", "**/wwwroot/lib/**", "**/wwwroot/css/**", "**/wwwroot/js/**"},
+		Allow:     []string{"**/appsettings*.json", "**/launchSettings.json", "**/*.config.xml"},
+	},
+	{
+		Name:      "java",
+		Manifests: []string{"pom.xml", "build.gradle", "build.gradle.kts", "settings.gradle", "settings.gradle.kts"},
+		Ignore:    []string{"**/target/**", "**/build/**", "**/out/**"},
+		Allow:     []string{"**/pom.xml", "**/application*.yml", "**/application*.yaml", "**/logback*.xml"},
+	},
+	{
+		Name:      "rust",
+		Manifests: []string{"Cargo.toml"},
+		Ignore:    []string{"**/target/**"},
+		Allow:     []string{"**/Cargo.toml", "**/rust-toolchain.toml", "**/rustfmt.toml", "**/clippy.toml"},
+	},
+	{
+		Name:      "terraform",
+		Manifests: []string{"*.tf", ".terraform.lock.hcl"},
+		Ignore:    []string{"**/.terraform/**", "**/*.tfstate", "**/*.tfstate.backup"},
+		Allow:     []string{"**/*.tf.json"},
+	},
+}
+
+// DefaultAllowPatterns are data files kept in every tree: API specs and
+// deployment manifests describe how the code is meant to be used.
+var DefaultAllowPatterns = []string{
+	"**/openapi*.{json,yaml,yml}",
+	"**/swagger*.{json,yaml,yml}",
+	"**/k8s/**/*.{json,yaml,yml}",
+	"**/kubernetes/**/*.{json,yaml,yml}",
+	"**/manifests/**/*.{json,yaml,yml}",
+	"**/deploy/**/*.{json,yaml,yml}",
+	"**/charts/**/*.{yaml,yml}",
+	"**/helm/**/*.{yaml,yml}",
+	"**/docker-compose*.{yaml,yml}",
+	"**/compose.{yaml,yml}",
+}
+
+// LookupProfile returns the built-in profile with the given name.
+func LookupProfile(name string) (Profile, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, p := range Profiles {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Profile{}, false
+}
+
+// ProfileNames returns the names of all built-in profiles.
+func ProfileNames() []string {
+	names := make([]string, len(Profiles))
+	for i, p := range Profiles {
+		names[i] = p.Name
+	}
+	return names
+}
+
+// DetectProfiles scans fsys for project manifests and returns the names of
+// the matching profiles, in the order of Profiles. Hidden directories and the
+// dependency/build directories of every profile are not scanned, so vendored
+// code does not activate profiles of its own.
+func DetectProfiles(ctx context.Context, fsys fs.FS) ([]string, error) {
+	var skip []string
+	for _, p := range Profiles {
+		skip = append(skip, p.Ignore...)
+	}
+	skipMatchers, _ := compilePatterns(append(skip, "**/.*/**"))
+
+	found := make(map[string]bool)
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // Unreadable directories are reported by the walk itself
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if d.IsDir() {
+			if p != "." && matchAny(skipMatchers, p) {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		for _, profile := range Profiles {
+			if found[profile.Name] {
+				continue
+			}
+			for _, manifest := range profile.Manifests {
+				if matched, _ := path.Match(manifest, d.Name()); matched {
+					found[profile.Name] = true
+					break
+				}
+			}
+		}
+		if len(found) == len(Profiles) {
+			return fs.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, p := range Profiles {
+		if found[p.Name] {
+			names = append(names, p.Name)
+		}
+	}
+	return names, nil
+}
+
+// resolveProfiles picks the active profiles: opts.Profiles when set,
+// otherwise the detected ones, minus opts.DisabledProfiles ("all" disables
+// every profile).
+func resolveProfiles(ctx context.Context, fsys fs.FS, opts Options) ([]Profile, error) {
+	names := opts.Profiles
+	if names == nil {
+		var err error
+		names, err = DetectProfiles(ctx, fsys)
+		if err != nil {
+			return nil, fmt.Errorf("error detecting project profiles: %w", err)
+		}
+	}
+
+	disabled := make(map[string]bool)
+	for _, name := range opts.DisabledProfiles {
+		disabled[strings.ToLower(strings.TrimSpace(name))] = true
+	}
+
+	var active []Profile
+	seen := make(map[string]bool)
+	for _, name := range names {
+		p, ok := LookupProfile(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown profile %q (available: %s)", name, strings.Join(ProfileNames(), ", "))
+		}
+		if disabled[p.Name] || disabled["all"] || seen[p.Name] {
+			continue
+		}
+		seen[p.Name] = true
+		active = append(active, p)
+	}
+
+	return active, nil
+}
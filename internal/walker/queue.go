@@ -0,0 +1,70 @@
+package walker
+
+import "sync"
+
+// workQueue runs tasks on a fixed number of goroutines. Tasks may push more
+// tasks; the queue is unbounded so that pushing never blocks a worker.
+type workQueue struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	tasks   []func()
+	closed  bool
+	running sync.WaitGroup // Workers that have not returned yet
+}
+
+// newWorkQueue starts the given number of workers.
+func newWorkQueue(workers int) *workQueue {
+	q := &workQueue{}
+	q.cond = sync.NewCond(&q.mu)
+	q.running.Add(workers)
+	for i := 0; i < workers; i++ {
+		go q.run()
+	}
+	return q
+}
+
+// push schedules a task. Tasks pushed last run first.
+func (q *workQueue) push(task func()) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return
+	}
+	q.tasks = append(q.tasks, task)
+	q.cond.Signal()
+}
+
+// close stops the workers; tasks that have not started are dropped.
+func (q *workQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.tasks = nil
+	q.cond.Broadcast()
+}
+
+// wait blocks until the workers have finished their running tasks and
+// returned, after close.
+func (q *workQueue) wait() {
+	q.running.Wait()
+}
+
+// run executes tasks until the queue is closed.
+func (q *workQueue) run() {
+	defer q.running.Done()
+	for {
+		q.mu.Lock()
+		for len(q.tasks) == 0 && !q.closed {
+			q.cond.Wait()
+		}
+		if q.closed {
+			q.mu.Unlock()
+			return
+		}
+		task := q.tasks[len(q.tasks)-1]
+		q.tasks = q.tasks[:len(q.tasks)-1]
+		q.mu.Unlock()
+
+		task()
+	}
+}
@@ -0,0 +1,142 @@
+package walker
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Reasons for skipping a symbolic link, wrapped in a *SymlinkError.
+var (
+	ErrSymlinkNotFollowed = errors.New("symlinked directory not followed (enable FollowSymlinks)")
+	ErrSymlinkBroken      = errors.New("symlink target does not exist")
+	ErrSymlinkCycle       = errors.New("symlink points to a directory already being walked")
+	ErrSymlinkEscape      = errors.New("symlink target is outside the walk root and not allowlisted")
+)
+
+// SymlinkError is reported on a Result for every symbolic link the walker
+// skips. Use errors.Is with the ErrSymlink* values to tell the reasons apart.
+type SymlinkError struct {
+	Path   string // Path of the link relative to the walk root
+	Target string // Target as stored in the link
+	Err    error  // Why the link was skipped
+}
+
+func (e *SymlinkError) Error() string {
+	return fmt.Sprintf("skipping symlink %s -> %s: %v", e.Path, e.Target, e.Err)
+}
+
+func (e *SymlinkError) Unwrap() error {
+	return e.Err
+}
+
+// symlinkGuard decides which resolved link targets may be followed.
+type symlinkGuard struct {
+	root    string   // Walk root with all symlinks resolved
+	allowed []string // Allowlisted directories outside the root, resolved
+}
+
+// newSymlinkGuard resolves the walk root and the allowlist once up front.
+func newSymlinkGuard(opts Options) (*symlinkGuard, error) {
+	root, err := filepath.EvalSymlinks(opts.TargetPath)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving target path: %w", err)
+	}
+	root, err = filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &symlinkGuard{root: root}
+	for _, dir := range opts.SymlinkAllow {
+		resolved, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving symlink allowlist entry %s: %w", dir, err)
+		}
+		if resolved, err = filepath.Abs(resolved); err != nil {
+			return nil, err
+		}
+		g.allowed = append(g.allowed, resolved)
+	}
+	return g, nil
+}
+
+// allows reports whether a resolved target lies below the root or an
+// allowlisted directory.
+func (g *symlinkGuard) allows(target string) bool {
+	if isWithin(g.root, target) {
+		return true
+	}
+	for _, dir := range g.allowed {
+		if isWithin(dir, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// isWithin reports whether p is base or a path below it.
+func isWithin(base, p string) bool {
+	rel, err := filepath.Rel(base, p)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// resolveLink inspects the symbolic link at slashPath below parent. It
+// returns the target's FileInfo, or a *SymlinkError when the link must be
+// skipped. Without FollowSymlinks, links to files are still read (as
+// os.DirFS always has) but links to directories are skipped. Links in a
+// custom Options.FS are always skipped.
+func (w *walk) resolveLink(parent *dirNode, slashPath string) (fs.FileInfo, error) {
+	fullPath := filepath.Join(w.opts.TargetPath, filepath.FromSlash(slashPath))
+	linkErr := &SymlinkError{Path: filepath.FromSlash(slashPath)}
+
+	// Links inside archives and other file systems are never resolved
+	if !w.onDisk {
+		linkErr.Err = ErrSymlinkNotFollowed
+		return nil, linkErr
+	}
+	linkErr.Target, _ = os.Readlink(fullPath)
+
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		linkErr.Err = ErrSymlinkBroken
+		return nil, linkErr
+	}
+	if w.symlinks == nil {
+		if info.IsDir() {
+			linkErr.Err = ErrSymlinkNotFollowed
+			return nil, linkErr
+		}
+		return info, nil
+	}
+
+	// Refuse targets outside the root unless allowlisted
+	resolved, err := filepath.EvalSymlinks(fullPath)
+	if err != nil {
+		linkErr.Err = ErrSymlinkBroken
+		return nil, linkErr
+	}
+	if resolved, err = filepath.Abs(resolved); err != nil || !w.symlinks.allows(resolved) {
+		linkErr.Err = ErrSymlinkEscape
+		return nil, linkErr
+	}
+
+	// A directory that is also one of our ancestors would recurse forever.
+	// os.SameFile compares device and inode numbers.
+	if info.IsDir() {
+		for dir := parent; dir != nil; dir = dir.parent {
+			if dir.info != nil && os.SameFile(dir.info, info) {
+				linkErr.Err = ErrSymlinkCycle
+				return nil, linkErr
+			}
+		}
+	}
+
+	return info, nil
+}
@@ -0,0 +1,198 @@
+package walker
+
+import (
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// TestMode controls how test files are treated by the walk.
+type TestMode string
+
+const (
+	TestsInclude TestMode = ""        // Report tests like any other file (default)
+	TestsExclude TestMode = "exclude" // Skip tests and test-only directories
+	TestsOnly    TestMode = "only"    // Report nothing but tests
+	TestsAttach  TestMode = "attach"  // Record tests on the source files they cover (Result.Tests)
+)
+
+// ParseTestMode converts a user-supplied mode name to a TestMode.
+func ParseTestMode(name string) (TestMode, bool) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "include":
+		return TestsInclude, true
+	case "exclude":
+		return TestsExclude, true
+	case "only":
+		return TestsOnly, true
+	case "attach":
+		return TestsAttach, true
+	}
+	return "", false
+}
+
+// testDirNames are directories whose whole content is test code or fixtures.
+var testDirNames = map[string]bool{
+	"test": true, "tests": true, "__tests__": true, "__mocks__": true,
+	"spec": true, "specs": true, "testdata": true,
+}
+
+// testDirSuffixes mark .NET style test projects ("App.Tests").
+var testDirSuffixes = []string{".tests", ".unittests", ".integrationtests", ".specs"}
+
+// testNamePatterns recognize test files by name. The matching part of the
+// name is stripped to find the source file a test covers: an entry of
+// {"_test", ".go"} turns "limiter_test.go" into "limiter.go".
+var testNamePatterns = []struct {
+	prefix, suffix string // Affix around the subject's name
+	exts           []string
+}{
+	{"", "_test", []string{".go", ".py", ".rb", ".rs", ".c", ".cc", ".cpp", ".ex", ".exs"}},
+	{"test_", "", []string{".py", ".c", ".cc", ".cpp"}},
+	{"", "_unittest", []string{".c", ".cc", ".cpp"}},
+	{"", ".test", []string{".js", ".jsx", ".ts", ".tsx", ".mjs", ".cjs"}},
+	{"", ".spec", []string{".js", ".jsx", ".ts", ".tsx", ".mjs", ".cjs"}},
+	{"", "_spec", []string{".rb"}},
+	{"", "Test", []string{".java", ".kt", ".scala", ".cs", ".php", ".groovy"}},
+	{"", "Tests", []string{".java", ".kt", ".cs", ".swift"}},
+	{"", "IT", []string{".java", ".kt"}},
+	{"", "Spec", []string{".scala", ".groovy", ".kt"}},
+}
+
+// IsTestFile reports whether the slash-separated path names a test file,
+// either by its own name or because it lives in a test directory.
+func IsTestFile(slashPath string) bool {
+	if _, ok := testSubject(path.Base(slashPath)); ok {
+		return true
+	}
+	dir := path.Dir(slashPath)
+	for dir != "." && dir != "/" {
+		if isTestDir(path.Base(dir)) {
+			return true
+		}
+		dir = path.Dir(dir)
+	}
+	return path.Base(slashPath) == "conftest.py"
+}
+
+// isTestDir reports whether a directory name denotes test code.
+func isTestDir(name string) bool {
+	lower := strings.ToLower(name)
+	if testDirNames[lower] {
+		return true
+	}
+	for _, suffix := range testDirSuffixes {
+		if strings.HasSuffix(lower, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// testSubject returns the file name of the source a test file name covers.
+func testSubject(name string) (string, bool) {
+	ext := path.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	for _, p := range testNamePatterns {
+		if !containsString(p.exts, ext) {
+			continue
+		}
+		if !strings.HasPrefix(stem, p.prefix) || !strings.HasSuffix(stem, p.suffix) {
+			continue
+		}
+		subject := strings.TrimSuffix(strings.TrimPrefix(stem, p.prefix), p.suffix)
+		if subject == "" {
+			continue
+		}
+		return subject + ext, true
+	}
+	return "", false
+}
+
+// containsString reports whether list contains s.
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// attachTests records each test on the source file it covers and removes the
+// attached tests from results. A test covers the source file with the
+// matching name (limiter_test.go -> limiter.go, FooTest.java -> Foo.java);
+// when several files share that name, the one whose directory is closest to
+// the test's, ignoring test directories, wins. Tests without a matching
+// source file are kept as standalone results.
+func attachTests(results []Result) []Result {
+	// Index source files by name
+	sources := make(map[string][]int)
+	for i, r := range results {
+		if r.IsDir || r.Err != nil || r.IsTest {
+			continue
+		}
+		name := path.Base(filepath.ToSlash(r.Path))
+		sources[name] = append(sources[name], i)
+	}
+
+	attached := make(map[int]bool)
+	for i, r := range results {
+		if !r.IsTest || r.Err != nil {
+			continue
+		}
+		testPath := filepath.ToSlash(r.Path)
+		subject, ok := testSubject(path.Base(testPath))
+		if !ok {
+			continue
+		}
+		candidates := sources[subject]
+		if len(candidates) == 0 {
+			continue
+		}
+
+		best, bestScore := -1, -1
+		testDir := sourceDir(testPath)
+		for _, c := range candidates {
+			score := commonPrefixLen(testDir, sourceDir(filepath.ToSlash(results[c].Path)))
+			if score > bestScore {
+				best, bestScore = c, score
+			}
+		}
+		results[best].Tests = append(results[best].Tests, r.Path)
+		attached[i] = true
+	}
+
+	kept := results[:0]
+	for i, r := range results {
+		if !attached[i] {
+			sort.Strings(r.Tests)
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
+
+// sourceDir returns the directory components of a path with test
+// directories and the main/test split of Maven-style layouts removed, so that
+// src/test/java/a/FooTest.java lines up with src/main/java/a/Foo.java.
+func sourceDir(slashPath string) []string {
+	var comps []string
+	for _, comp := range strings.Split(path.Dir(slashPath), "/") {
+		if comp == "." || comp == "main" || isTestDir(comp) {
+			continue
+		}
+		comps = append(comps, comp)
+	}
+	return comps
+}
+
+// commonPrefixLen returns the number of leading components a and b share.
+func commonPrefixLen(a, b []string) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
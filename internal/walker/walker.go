@@ -1,157 +1,593 @@
 package walker
 
 import (
+	"context"
 	"fmt"
 	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
 
-	"github.com/bmatcuk/doublestar/v4"
+	"github.com/waqasraz/code-context/internal/gitrepo"
 )
 
-// DefaultIgnorePatterns are common patterns to ignore.
+// DefaultIgnorePatterns are common patterns to ignore in every tree.
+// Dependency and cache directories stay here even though profiles list them
+// too, so trees without a detected manifest (a subdirectory of a project, a
+// loose checkout) are not walked into them. Names that only mean build output
+// in one ecosystem (target, bin/obj, out, ...) live in Profiles, and binary,
+// minified, generated and lockfile content is detected separately (see
+// FileClass).
 var DefaultIgnorePatterns = []string{
 	"**/.*/**", // Any folder starting with a dot (hidden folders)
-	"**/node_modules/**",
 	"**/.git/**",
 	"**/.idea/**",
+	"**/node_modules/**",
 	"**/vendor/**",
 	"**/dist/**",
 	"**/build/**",
-	"**/.venv/**",
 	"**/venv/**",       // Python virtual environments
 	"**/env/**",        // Python virtual environments
 	"**/*.egg-info/**", // Python package metadata
 	"**/__pycache__/**",
-	"**/*.pyc",          // Python compiled files
-	"**/*.pyo",          // Python optimized files
-	"**/*.spec.ts",      // Test files
-	"**/*.test.ts",      // Test files
-	"**/*.spec.js",      // Test files
-	"**/*.test.js",      // Test files
-	"**/__mocks__/**",   // Mock directories
-	"**/coverage/**",    // Coverage reports
-	"**/*.json",         // Data files
-	"**/*.yaml",         // Data files
-	"**/*.yml",          // Data files
-	"**/*.xml",          // Data files
-	"**/*.csv",          // Data files
-	"**/*.toml",         // Data files
-	"**/*.ini",          // Data files
-	"**/*.min.css",      // Minified CSS files
-	"**/*.min.js",       // Minified JS files
-	"**/*.css.map",      // CSS source maps
-	"**/*.js.map",       // JS source maps
-	"**/*.map",          // All source maps
-	"**/wwwroot/lib/**", // Web libraries in ASP.NET projects
-	"**/wwwroot/css/**", // CSS files in ASP.NET projects
-	"**/wwwroot/js/**",  // JS files in ASP.NET projects
+	"**/*.pyc",       // Python compiled files
+	"**/*.pyo",       // Python optimized files
+	"**/coverage/**", // Coverage reports
+	"**/*.json",      // Data files (see DefaultAllowPatterns and Profile.Allow)
+	"**/*.yaml",      // Data files
+	"**/*.yml",       // Data files
+	"**/*.xml",       // Data files
+	"**/*.csv",       // Data files
+	"**/*.toml",      // Data files
+	"**/*.ini",       // Data files
 	"**/*.log",
-	"**/*.lock",
-	"**/*.bin",
-	"**/*.exe",
-	"**/*.dll",
-	"**/*.so",
-	"**/*.dylib",
-	"**/*.png",
-	"**/*.jpg",
-	"**/*.jpeg",
-	"**/*.gif",
 	"**/*.svg",
-	"**/*.ico",
-	"**/*.pdf",
-	"**/*.zip",
-	"**/*.tar.gz",
-	"**/*.gz",
-	"**/*.rar",
-	"**/*.7z",
 	"**/.env", // Environment files
-	// Add other common binary/non-source file extensions or build artifacts
+	// Add other common non-source file patterns or build artifacts
 }
 
 // Options defines the configuration for the directory walk.
 type Options struct {
-	TargetPath     string
-	IgnorePatterns []string
-	// Potentially add .gitignore reading logic here later
+	FS               fs.FS // Files to walk instead of the directory at TargetPath (archives, git trees, tests)
+	TargetPath       string
+	IgnorePatterns   []string
+	IncludePatterns  []string    // When set, only files matching at least one pattern are reported
+	MaxDepth         int         // Levels below TargetPath to descend (0 = unlimited, 1 = top level only)
+	MinSize          int64       // Skip files smaller than this many bytes (0 = no minimum)
+	MaxSize          int64       // Skip files larger than this many bytes (0 = no maximum)
+	NoGitignore      bool        // Disable .gitignore, .ignore and .git/info/exclude handling
+	GitMode          GitMode     // Restrict the walk to tracked or changed files (see GitMode)
+	GitBase          string      // Base revision for GitModeDiff ("main", "main...HEAD", ...)
+	GitHead          string      // Head revision for GitModeDiff (defaults to HEAD)
+	ClassPolicy      ClassPolicy // Which file classes to report (nil uses DefaultClassPolicy)
+	Workers          int         // Concurrent directory readers and file inspectors (defaults to the CPU count)
+	FollowSymlinks   bool        // Descend into symlinked directories, guarding against cycles and escapes
+	SymlinkAllow     []string    // Directories outside TargetPath that followed symlinks may point into
+	Profiles         []string    // Ecosystem profiles to apply (nil auto-detects from manifests in the tree)
+	TestMode         TestMode    // Include, exclude, isolate or attach test files (see TestMode)
+	DisabledProfiles []string    // Profiles never to apply ("all" disables profiles entirely)
+	Modules          []Module    // Modules to tag results with (see DetectModules)
+	OnlyModules      []string    // Restrict the walk to these modules, by name or path (detects Modules if unset)
 }
 
 // Result holds information about a processed file or directory.
 type Result struct {
-	Path  string
-	IsDir bool
-	Err   error // Error encountered while accessing this path
+	Path      string
+	IsDir     bool
+	Err       error          // Error encountered while accessing this path
+	GitStatus gitrepo.Status // Change status in git diff/worktree modes (added, modified, renamed)
+	OldPath   string         // Previous path when GitStatus is renamed
+	Class     FileClass      // Content classification of files (empty for directories)
+	IsTest    bool           // File was recognized as test code
+	Tests     []string       // Tests covering this source file (TestsAttach mode)
+	Module    string         // Path of the innermost module containing this entry ("" outside any module)
+	Metadata                 // Size, mtime, mode, hash, language, line count and link target
 }
 
 // Walk traverses the directory structure based on the provided options,
 // yielding Result objects for each file/directory encountered after filtering.
 func Walk(opts Options) <-chan Result {
+	return WalkContext(context.Background(), opts)
+}
+
+// WalkContext is like Walk but stops as soon as ctx is cancelled. Directories
+// are read and files inspected by a bounded pool of workers, while results
+// are still delivered in lexical depth-first order (the order of fs.WalkDir),
+// so repeated runs over the same tree produce identical output.
+func WalkContext(ctx context.Context, opts Options) <-chan Result {
 	out := make(chan Result)
 
 	go func() {
 		defer close(out)
 
-		// Combine default and user-provided ignore patterns
-		allIgnores := append([]string{}, DefaultIgnorePatterns...)
-		allIgnores = append(allIgnores, opts.IgnorePatterns...)
-
-		// Create a filesystem to walk
-		fsys := os.DirFS(opts.TargetPath)
+		w := &walk{
+			ctx:    ctx,
+			opts:   opts,
+			out:    out,
+			fsys:   opts.FS,
+			onDisk: opts.FS == nil,
+		}
+		if w.onDisk {
+			w.fsys = os.DirFS(opts.TargetPath)
+		} else if opts.GitMode != GitModeNone || opts.FollowSymlinks {
+			w.send(Result{Err: fmt.Errorf("git modes and symlink following need a directory on disk, not a custom FS")})
+			return
+		}
 
-		// Walk the file system using filepath.WalkDir instead of doublestar.Walk
-		err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		// In git-aware modes only the selected files are reported, and
+		// directories are only reported once they turn out to contain one.
+		// Files of a diff whose head is not checked out are read from the
+		// head's tree rather than the working tree.
+		if opts.GitMode != GitModeNone {
+			var err error
+			w.selection, err = newGitSelection(opts)
 			if err != nil {
-				// Send the error and continue walking
-				out <- Result{Path: path, Err: err}
-				return nil
+				w.send(Result{Err: fmt.Errorf("error reading git repository: %w", err)})
+				return
+			}
+			if w.selection.tree != nil {
+				defer w.selection.close()
+				w.fsys = w.selection.tree
+				w.onDisk = false
+			}
+		}
+
+		// Combine default and profile ignore patterns, compiled once. The
+		// profiles' allowances only override these defaults, never the
+		// user's own patterns.
+		profiles, err := resolveProfiles(ctx, w.fsys, opts)
+		if err != nil {
+			w.send(Result{Err: err})
+			return
+		}
+		defaultIgnores := append([]string{}, DefaultIgnorePatterns...)
+		allows := append([]string{}, DefaultAllowPatterns...)
+		for _, p := range profiles {
+			defaultIgnores = append(defaultIgnores, p.Ignore...)
+			allows = append(allows, p.Allow...)
+		}
+		var errs []error
+		w.defaultIgnores, _ = compilePatterns(defaultIgnores)
+		w.allows, _ = compilePatterns(allows)
+		w.ignores, errs = compilePatterns(opts.IgnorePatterns)
+		var includeErrs []error
+		w.includes, includeErrs = compilePatterns(opts.IncludePatterns)
+		for _, err := range append(errs, includeErrs...) {
+			if !w.send(Result{Err: err}) {
+				return
 			}
+		}
+		if len(opts.IncludePatterns) > 0 && len(w.includes) == 0 {
+			w.send(Result{Err: fmt.Errorf("no valid include patterns")})
+			return
+		}
 
-			// Construct the full path relative to the original target path for matching
-			fullPath := filepath.Join(opts.TargetPath, path)
-			relPath, err := filepath.Rel(opts.TargetPath, fullPath)
+		// Index the modules results are tagged with and resolve the scope
+		modules := opts.Modules
+		if len(modules) == 0 && len(opts.OnlyModules) > 0 {
+			if modules, err = DetectModules(ctx, w.fsys); err != nil {
+				w.send(Result{Err: fmt.Errorf("error detecting modules: %w", err)})
+				return
+			}
+		}
+		if len(modules) > 0 {
+			w.modules = newModuleIndex(modules)
+		}
+		for _, name := range opts.OnlyModules {
+			m, ok := FindModule(modules, name)
+			if !ok {
+				w.send(Result{Err: fmt.Errorf("unknown module %q", name)})
+				return
+			}
+			w.scope = append(w.scope, m.Path)
+		}
+
+		if opts.FollowSymlinks {
+			w.symlinks, err = newSymlinkGuard(opts)
 			if err != nil {
-				// Should generally not happen if logic is correct
-				fmt.Fprintf(os.Stderr, "Warning: could not make path relative: %v\n", err)
-				relPath = path // Fallback
+				w.send(Result{Err: err})
+				return
 			}
+		}
+
+		root := &dirNode{path: ".", ready: make(chan struct{})}
+		if !opts.NoGitignore {
+			root.rules = loadExcludeRules(w.fsys)
+		}
+		rootResult := Result{Path: ".", IsDir: true}
+		if m, ok := w.modules.owner("."); ok {
+			rootResult.Module = m.Path
+		}
+		if info, err := fs.Stat(w.fsys, "."); err == nil {
+			root.info = info
+			rootResult.Mode = info.Mode()
+			rootResult.ModTime = info.ModTime()
+		}
 
-			// Check against ignore patterns
-			for _, pattern := range allIgnores {
-				// Ensure patterns use forward slashes for consistency
-				matchPattern := filepath.ToSlash(pattern)
-				pathToMatch := filepath.ToSlash(relPath)
+		workers := opts.Workers
+		if workers <= 0 {
+			workers = runtime.NumCPU()
+		}
+		w.queue = newWorkQueue(workers)
+		defer func() {
+			w.queue.close()
+			w.queue.wait() // Running tasks may still read from a git tree closed on return
+		}()
 
-				// Use doublestar.Match for globbing
-				matched, _ := doublestar.Match(matchPattern, pathToMatch)
+		w.queue.push(func() { w.readDir(root) })
 
-				// Also match against the basename for patterns like '*.log'
-				if !matched && !strings.Contains(matchPattern, "/") {
-					base := filepath.Base(pathToMatch)
-					matched, _ = doublestar.Match(matchPattern, base)
+		// Attaching tests needs every file, so the results are held back
+		// until the walk is complete
+		w.collecting = opts.TestMode == TestsAttach
+		if w.send(rootResult) && w.emit(root) && w.collecting {
+			w.collecting = false
+			for _, r := range attachTests(w.collected) {
+				if !w.send(r) {
+					return
 				}
+			}
+		}
+	}()
 
-				if matched {
-					if d.IsDir() {
-						// Skip the entire directory if the directory itself matches
-						return fs.SkipDir
-					} else {
-						// Skip the file
-						return nil
-					}
-				}
+	return out
+}
+
+// walk holds the state shared by the workers and the emitter of one walk.
+type walk struct {
+	ctx      context.Context
+	opts     Options
+	out      chan<- Result
+	fsys     fs.FS
+	onDisk   bool          // fsys is os.DirFS(TargetPath)
+	ignores  []pathMatcher // User ignore patterns
+	includes []pathMatcher // User include patterns
+	allows   []pathMatcher // Data files exempt from defaultIgnores
+
+	defaultIgnores []pathMatcher // Built-in and profile ignore patterns
+	selection      *gitSelection
+	symlinks       *symlinkGuard // Set when following symlinks
+	modules        moduleIndex   // Modules results are tagged with
+	scope          []string      // Paths of the modules the walk is restricted to
+	queue          *workQueue
+
+	pendingDirs []Result // Directories waiting for a reported file (emitter only)
+	collecting  bool     // Buffer results in collected instead of sending them
+	collected   []Result // Results held back while collecting
+}
+
+// dirNode is a directory whose children are being read by a worker.
+type dirNode struct {
+	path    string        // Slash-separated path relative to the root
+	parent  *dirNode      // Enclosing directory (nil for the root)
+	info    fs.FileInfo   // Directory (or link target) info, used for cycle detection
+	rules   []ignoreRule  // Gitignore rules in effect for the directory's children
+	err     error         // Error encountered while reading the directory
+	entries []*walkEntry  // Children that passed the path filters, in name order
+	ready   chan struct{} // Closed once entries is populated
+}
+
+// walkEntry is a child of a dirNode awaiting emission.
+type walkEntry struct {
+	result Result
+	keep   bool          // False when the entry was filtered out after inspection
+	dir    *dirNode      // Set for directories
+	ready  chan struct{} // Closed once result is final
+}
+
+// closedChan is a ready channel for entries that need no further work.
+var closedChan = func() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}()
+
+// readDir lists a directory, applies the path-based filters and schedules
+// work for the surviving children. It runs on a worker.
+func (w *walk) readDir(node *dirNode) {
+	defer close(node.ready)
+	if w.ctx.Err() != nil {
+		return
+	}
+
+	// Rules from this directory's ignore files apply to its children
+	if !w.opts.NoGitignore {
+		if local := loadIgnoreRules(w.fsys, node.path); len(local) > 0 {
+			node.rules = append(node.rules[:len(node.rules):len(node.rules)], local...)
+		}
+	}
+
+	dirEntries, err := fs.ReadDir(w.fsys, node.path)
+	if err != nil {
+		node.err = err // Report the error but keep any entries that were read
+	}
+
+	var tasks []func()
+	for _, d := range dirEntries {
+		slashPath := path.Join(node.path, d.Name())
+		entry, task := w.filterEntry(node, slashPath, d)
+		if entry == nil {
+			continue
+		}
+		node.entries = append(node.entries, entry)
+		if task != nil {
+			tasks = append(tasks, task)
+		}
+	}
+
+	// The queue is LIFO; pushing in reverse lets the first child run first,
+	// which keeps the workers close to where the emitter is waiting
+	for i := len(tasks) - 1; i >= 0; i-- {
+		w.queue.push(tasks[i])
+	}
+}
+
+// filterEntry applies ignore patterns, the git selection and ignore files to
+// a directory entry. It returns nil for filtered entries, and otherwise the
+// entry plus the task that completes it.
+func (w *walk) filterEntry(parent *dirNode, slashPath string, d fs.DirEntry) (*walkEntry, func()) {
+	// Check against ignore patterns and the depth limit
+	if matchAny(w.ignores, slashPath) {
+		return nil, nil
+	}
+	if matchAny(w.defaultIgnores, slashPath) && (d.IsDir() || !matchAny(w.allows, slashPath)) {
+		return nil, nil
+	}
+	depth := strings.Count(slashPath, "/") + 1
+	if w.opts.MaxDepth > 0 && depth > w.opts.MaxDepth {
+		return nil, nil
+	}
+
+	// Restrict the walk to the selected modules
+	if len(w.scope) > 0 && !w.inScope(slashPath, d.IsDir()) {
+		return nil, nil
+	}
+
+	result := Result{Path: filepath.FromSlash(slashPath), IsDir: d.IsDir()}
+	if m, ok := w.modules.owner(slashPath); ok {
+		result.Module = m.Path
+	}
+
+	// Apply the git selection; selected paths bypass ignore files since
+	// git already decided they belong to the repository
+	selected := false
+	if w.selection != nil {
+		if d.IsDir() {
+			if !w.selection.keepDir(slashPath) {
+				return nil, nil
 			}
+			selected = w.selection.dirs[slashPath]
+		} else {
+			change, ok := w.selection.selectFile(slashPath)
+			if !ok {
+				return nil, nil
+			}
+			_, selected = w.selection.files[slashPath]
+			result.GitStatus = change.Status
+			result.OldPath = change.OldPath
+		}
+	}
 
-			// Send the result (relative path)
-			out <- Result{Path: relPath, IsDir: d.IsDir()}
-			return nil
-		})
+	// Check against .gitignore, .ignore and .git/info/exclude rules
+	if !w.opts.NoGitignore && !selected && ignoredBy(parent.rules, slashPath, d.IsDir()) {
+		return nil, nil
+	}
 
+	// Symbolic links are resolved to decide whether they are followed
+	var dirInfo fs.FileInfo
+	if d.IsDir() {
+		dirInfo, _ = d.Info()
+	} else if d.Type()&fs.ModeSymlink != 0 {
+		target, err := w.resolveLink(parent, slashPath)
 		if err != nil {
-			// Send the walk error itself
-			out <- Result{Err: fmt.Errorf("error during directory walk: %w", err)}
+			return &walkEntry{result: Result{Path: result.Path, Err: err}, keep: true, ready: closedChan}, nil
 		}
-	}()
+		if target.IsDir() {
+			dirInfo = target
+			result.IsDir = true
+			result.LinkTarget, _ = os.Readlink(filepath.Join(w.opts.TargetPath, slashPath))
+		}
+	}
 
-	return out
+	if result.IsDir {
+		// Test-only directories need not be read when tests are excluded
+		if w.opts.TestMode == TestsExclude && isTestDir(d.Name()) {
+			return nil, nil
+		}
+		if info, err := d.Info(); err == nil {
+			result.Mode = info.Mode()
+			result.ModTime = info.ModTime()
+		}
+		child := &dirNode{path: slashPath, parent: parent, info: dirInfo, rules: parent.rules, ready: make(chan struct{})}
+		entry := &walkEntry{result: result, keep: true, dir: child, ready: closedChan}
+		if w.opts.MaxDepth > 0 && depth == w.opts.MaxDepth {
+			close(child.ready) // Nothing below this level is reported
+			return entry, nil
+		}
+		return entry, func() { w.readDir(child) }
+	}
+
+	// Only files matching an include pattern are reported
+	if len(w.includes) > 0 && !matchAny(w.includes, slashPath) {
+		return nil, nil
+	}
+
+	// Apply the test-file policy
+	result.IsTest = IsTestFile(slashPath)
+	if (w.opts.TestMode == TestsExclude && result.IsTest) || (w.opts.TestMode == TestsOnly && !result.IsTest) {
+		return nil, nil
+	}
+
+	entry := &walkEntry{result: result, ready: make(chan struct{})}
+	return entry, func() { w.inspect(entry, slashPath, d) }
+}
+
+// inspect classifies a file and collects its metadata. It runs on a worker.
+func (w *walk) inspect(entry *walkEntry, slashPath string, d fs.DirEntry) {
+	defer close(entry.ready)
+	if w.ctx.Err() != nil {
+		return
+	}
+
+	// Check the size limits before reading anything
+	if info, err := d.Info(); err == nil && info.Mode().IsRegular() && !w.sizeAllowed(info.Size()) {
+		return
+	}
+
+	// Classify file content and apply the per-class policy
+	class, meta, err := inspectFile(w.fsys, slashPath, d, w.opts.ClassPolicy)
+	if err != nil {
+		entry.result = Result{Path: entry.result.Path, Err: err}
+		entry.keep = true
+		return
+	}
+	if !w.opts.ClassPolicy.Includes(class) || !w.sizeAllowed(meta.Size) {
+		return
+	}
+	if meta.Mode&fs.ModeSymlink != 0 && w.onDisk {
+		meta.LinkTarget, _ = os.Readlink(filepath.Join(w.opts.TargetPath, slashPath))
+	}
+	entry.result.Class = class
+	entry.result.Metadata = meta
+	entry.keep = true
+}
+
+// sizeAllowed reports whether a file size is within MinSize and MaxSize.
+func (w *walk) sizeAllowed(size int64) bool {
+	if w.opts.MinSize > 0 && size < w.opts.MinSize {
+		return false
+	}
+	return w.opts.MaxSize <= 0 || size <= w.opts.MaxSize
+}
+
+// lazyDirs reports whether directories are only emitted once a file below
+// them is, which is the case when the walk selects a subset of files.
+func (w *walk) lazyDirs() bool {
+	return w.selection != nil || len(w.includes) > 0 || w.opts.TestMode == TestsOnly || len(w.scope) > 0
+}
+
+// inScope reports whether a path belongs to one of the modules the walk is
+// restricted to. Files belong to their innermost module only, so a nested
+// module is skipped unless it is in scope itself; directories are kept while
+// they can still lead to a module in scope.
+func (w *walk) inScope(slashPath string, isDir bool) bool {
+	if owner, ok := w.modules.owner(slashPath); ok && containsString(w.scope, owner.Path) {
+		return true
+	}
+	if isDir {
+		for _, s := range w.scope {
+			if strings.HasPrefix(s, slashPath+"/") {
+				return true // Leads to a module in scope
+			}
+		}
+	}
+	return false
+}
+
+// emit sends the results below node in depth-first order, waiting for the
+// workers as needed. It returns false if the walk was cancelled.
+func (w *walk) emit(node *dirNode) bool {
+	if !w.wait(node.ready) {
+		return false
+	}
+	if node.err != nil {
+		if !w.send(Result{Path: filepath.FromSlash(node.path), Err: node.err}) {
+			return false
+		}
+	}
+
+	for _, entry := range node.entries {
+		if !w.wait(entry.ready) {
+			return false
+		}
+		if !entry.keep {
+			continue
+		}
+
+		if entry.dir != nil {
+			if w.lazyDirs() {
+				w.pendingDirs = append(w.pendingDirs, entry.result)
+			} else if !w.send(entry.result) {
+				return false
+			}
+			if !w.emit(entry.dir) {
+				return false
+			}
+			// Forget the directory if nothing below it was reported
+			if n := len(w.pendingDirs); n > 0 && w.pendingDirs[n-1].Path == entry.result.Path {
+				w.pendingDirs = w.pendingDirs[:n-1]
+			}
+			entry.dir = nil // Release the subtree
+			continue
+		}
+
+		// Report the directories leading to this file first
+		for _, dir := range w.pendingDirs {
+			if !w.send(dir) {
+				return false
+			}
+		}
+		w.pendingDirs = w.pendingDirs[:0]
+
+		// Send the result (relative path)
+		if !w.send(entry.result) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// wait blocks until ch is closed or the walk is cancelled.
+func (w *walk) wait(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	case <-w.ctx.Done():
+		return false
+	}
+}
+
+// send delivers a result unless the walk is cancelled.
+func (w *walk) send(r Result) bool {
+	if w.collecting {
+		w.collected = append(w.collected, r)
+		return w.ctx.Err() == nil
+	}
+	select {
+	case w.out <- r:
+		return true
+	case <-w.ctx.Done():
+		return false
+	}
+}
+
+// ParseSize parses a human-readable file size such as "512", "64KB", "1.5MB"
+// or "2G". Units are binary (1KB = 1024 bytes) and case-insensitive.
+func ParseSize(s string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		scale  int64
+	}{
+		{"GB", 1 << 30}, {"G", 1 << 30},
+		{"MB", 1 << 20}, {"M", 1 << 20},
+		{"KB", 1 << 10}, {"K", 1 << 10},
+		{"B", 1},
+	} {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			multiplier = unit.scale
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * float64(multiplier)), nil
 }
@@ -0,0 +1,275 @@
+package walker
+
+import (
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/waqasraz/code-context/internal/gitrepo"
+	"github.com/waqasraz/code-context/internal/source"
+)
+
+// writeTree writes files, by slash-separated path, below a new temporary
+// directory and returns it.
+func writeTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// memTree builds an in-memory source holding files.
+func memTree(t *testing.T, files map[string]string) *source.MemFS {
+	t.Helper()
+	fsys := source.NewMemFS()
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	for name, content := range files {
+		if err := fsys.AddFile(name, []byte(content), 0o644, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return fsys
+}
+
+// walkFiles walks opts and returns the slash-separated paths of the files
+// reported, sorted. Ignore files are left out, and errors fail the test.
+func walkFiles(t *testing.T, opts Options) []string {
+	t.Helper()
+	var files []string
+	for r := range Walk(opts) {
+		if r.Err != nil {
+			t.Fatalf("walk error at %q: %v", r.Path, r.Err)
+		}
+		p := filepath.ToSlash(r.Path)
+		if r.IsDir || path.Base(p) == ".gitignore" || path.Base(p) == ".ignore" {
+			continue
+		}
+		files = append(files, p)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// walkTree walks files with opts, both from a temporary directory and from an
+// in-memory source, and fails the test unless the two walks agree.
+func walkTree(t *testing.T, files map[string]string, opts Options) []string {
+	t.Helper()
+	onDisk := opts
+	onDisk.TargetPath = writeTree(t, files)
+	got := walkFiles(t, onDisk)
+
+	inMemory := opts
+	inMemory.FS = memTree(t, files)
+	if fromFS := walkFiles(t, inMemory); !reflect.DeepEqual(fromFS, got) {
+		t.Errorf("walk of in-memory source = %v, want %v as on disk", fromFS, got)
+	}
+	return got
+}
+
+// assertFiles compares walked files with the expected ones.
+func assertFiles(t *testing.T, name string, got []string, want ...string) {
+	t.Helper()
+	want = append([]string(nil), want...)
+	sort.Strings(want)
+	if len(got) == 0 && len(want) == 0 {
+		return
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%s: walked %v, want %v", name, got, want)
+	}
+}
+
+func TestWalkPatterns(t *testing.T) {
+	files := map[string]string{
+		"main.go":           "package main\n",
+		"docs/guide.md":     "# Guide\n",
+		"internal/a/a.go":   "package a\n",
+		"internal/a/gen.go": "package a\n",
+	}
+
+	assertFiles(t, "ignore", walkTree(t, files, Options{IgnorePatterns: []string{"**/gen.go", "docs/**"}}),
+		"main.go", "internal/a/a.go")
+	assertFiles(t, "include", walkTree(t, files, Options{IncludePatterns: []string{"**/*.go"}}),
+		"main.go", "internal/a/a.go", "internal/a/gen.go")
+	assertFiles(t, "include and ignore", walkTree(t, files, Options{IncludePatterns: []string{"internal/**"}, IgnorePatterns: []string{"**/gen.go"}}),
+		"internal/a/a.go")
+}
+
+func TestWalkSizeLimits(t *testing.T) {
+	files := map[string]string{
+		"tiny.go":   "package a\n",                                       // 10 bytes
+		"medium.go": "package a\n" + strings.Repeat("// comment\n", 10),  // 120 bytes
+		"large.go":  "package a\n" + strings.Repeat("// comment\n", 100), // 1110 bytes
+	}
+
+	assertFiles(t, "no limits", walkTree(t, files, Options{}), "tiny.go", "medium.go", "large.go")
+	assertFiles(t, "min size", walkTree(t, files, Options{MinSize: 100}), "medium.go", "large.go")
+	assertFiles(t, "max size", walkTree(t, files, Options{MaxSize: 120}), "tiny.go", "medium.go")
+	assertFiles(t, "both", walkTree(t, files, Options{MinSize: 11, MaxSize: 1000}), "medium.go")
+}
+
+func TestWalkGitTreeSizeLimits(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := writeTree(t, map[string]string{
+		"tiny.go":  "package a\n",
+		"large.go": "package a\n" + strings.Repeat("// comment\n", 100),
+	})
+	gitRun(t, dir, "init", "-q")
+	gitRun(t, dir, "add", "-A")
+	gitRun(t, dir, "commit", "-q", "-m", "files")
+
+	repo, err := gitrepo.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+	fsys, err := repo.CommitFS("HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Git trees only know blob sizes from the objects, not the tree entries
+	assertFiles(t, "min size", walkFiles(t, Options{FS: fsys, MinSize: 100}), "large.go")
+	assertFiles(t, "max size", walkFiles(t, Options{FS: fsys, MaxSize: 100}), "tiny.go")
+}
+
+func TestWalkMaxDepth(t *testing.T) {
+	files := map[string]string{
+		"a.go":       "package a\n",
+		"b/b.go":     "package b\n",
+		"b/c/c.go":   "package c\n",
+		"b/c/d/d.go": "package d\n",
+	}
+
+	assertFiles(t, "unlimited", walkTree(t, files, Options{}), "a.go", "b/b.go", "b/c/c.go", "b/c/d/d.go")
+	assertFiles(t, "depth 1", walkTree(t, files, Options{MaxDepth: 1}), "a.go")
+	assertFiles(t, "depth 2", walkTree(t, files, Options{MaxDepth: 2}), "a.go", "b/b.go")
+
+	var dirs []string
+	for r := range Walk(Options{TargetPath: writeTree(t, files), MaxDepth: 2}) {
+		if r.IsDir {
+			dirs = append(dirs, filepath.ToSlash(r.Path))
+		}
+	}
+	sort.Strings(dirs)
+	if want := []string{".", "b", "b/c"}; !reflect.DeepEqual(dirs, want) {
+		t.Errorf("directories at depth 2 = %v, want %v", dirs, want)
+	}
+}
+
+func TestWalkDataFiles(t *testing.T) {
+	files := map[string]string{
+		"main.go":           "package main\n",
+		"config.json":       "{}\n",
+		"openapi.yaml":      "openapi: 3.0.0\n",
+		"deploy/app.yaml":   "kind: Deployment\n",
+		"settings.yaml":     "debug: true\n",
+		".hidden/secret.go": "package hidden\n",
+	}
+
+	assertFiles(t, "defaults", walkTree(t, files, Options{}),
+		"main.go", "openapi.yaml", "deploy/app.yaml")
+	assertFiles(t, "ignore wins over allow", walkTree(t, files, Options{IgnorePatterns: []string{"**/openapi.yaml"}}),
+		"main.go", "deploy/app.yaml")
+}
+
+func TestWalkProfiles(t *testing.T) {
+	files := map[string]string{
+		"index.js":                  "module.exports = {}\n",
+		"node_modules/dep/index.js": "module.exports = {}\n",
+		"dist/bundle.js":            "var a = 1\n",
+		"vendor/dep/dep.go":         "package dep\n",
+		"venv/lib/site.py":          "import os\n",
+		"pkg.egg-info/PKG-INFO":     "Name: pkg\n",
+		"out/app.js":                "var a = 1\n",
+		"tsconfig.json":             "{}\n",
+	}
+	// Dependency directories are skipped even when no manifest is found
+	assertFiles(t, "no manifest", walkTree(t, files, Options{}),
+		"index.js", "out/app.js")
+	assertFiles(t, "explicit profile", walkTree(t, files, Options{Profiles: []string{"node", "java"}}),
+		"index.js", "tsconfig.json")
+
+	files["package.json"] = "{}\n"
+	files["pom.xml"] = "<project/>\n"
+	assertFiles(t, "detected profile", walkTree(t, files, Options{}),
+		"index.js", "package.json", "tsconfig.json", "pom.xml")
+	assertFiles(t, "disabled profile", walkTree(t, files, Options{DisabledProfiles: []string{"java"}}),
+		"index.js", "out/app.js", "package.json", "tsconfig.json")
+	assertFiles(t, "all profiles disabled", walkTree(t, files, Options{DisabledProfiles: []string{"all"}}),
+		"index.js", "out/app.js")
+
+	var errs []error
+	for r := range Walk(Options{TargetPath: writeTree(t, files), Profiles: []string{"cobol"}}) {
+		if r.Err != nil {
+			errs = append(errs, r.Err)
+		}
+	}
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), `unknown profile "cobol"`) {
+		t.Errorf("unknown profile errors = %v", errs)
+	}
+}
+
+func TestWalkTestModes(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"limiter.go":                   "package app\n",
+		"limiter_test.go":              "package app\n",
+		"orphan_test.go":               "package app\n",
+		"web/app.js":                   "export {}\n",
+		"web/app.test.js":              "test()\n",
+		"testdata/input.txt":           "data\n",
+		"src/main/java/a/Foo.java":     "class Foo {}\n",
+		"src/test/java/a/FooTest.java": "class FooTest {}\n",
+	})
+
+	assertFiles(t, "include", walkFiles(t, Options{TargetPath: root}),
+		"limiter.go", "limiter_test.go", "orphan_test.go", "web/app.js", "web/app.test.js",
+		"testdata/input.txt", "src/main/java/a/Foo.java", "src/test/java/a/FooTest.java")
+	assertFiles(t, "exclude", walkFiles(t, Options{TargetPath: root, TestMode: TestsExclude}),
+		"limiter.go", "web/app.js", "src/main/java/a/Foo.java")
+	assertFiles(t, "only", walkFiles(t, Options{TargetPath: root, TestMode: TestsOnly}),
+		"limiter_test.go", "orphan_test.go", "web/app.test.js", "testdata/input.txt", "src/test/java/a/FooTest.java")
+
+	tests := make(map[string][]string)
+	var files []string
+	for r := range Walk(Options{TargetPath: root, TestMode: TestsAttach}) {
+		if r.Err != nil {
+			t.Fatal(r.Err)
+		}
+		if r.IsDir {
+			continue
+		}
+		path := filepath.ToSlash(r.Path)
+		files = append(files, path)
+		for _, test := range r.Tests {
+			tests[path] = append(tests[path], filepath.ToSlash(test))
+		}
+	}
+	sort.Strings(files)
+	assertFiles(t, "attach", files,
+		"limiter.go", "orphan_test.go", "web/app.js", "testdata/input.txt", "src/main/java/a/Foo.java")
+	wantTests := map[string][]string{
+		"limiter.go":               {"limiter_test.go"},
+		"web/app.js":               {"web/app.test.js"},
+		"src/main/java/a/Foo.java": {"src/test/java/a/FooTest.java"},
+	}
+	if !reflect.DeepEqual(tests, wantTests) {
+		t.Errorf("attached tests = %v, want %v", tests, wantTests)
+	}
+}
@@ -0,0 +1,164 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/waqasraz/code-context/internal/walker"
+)
+
+// DefaultInterval is the time between polls when Watcher.Interval is unset.
+const DefaultInterval = 2 * time.Second
+
+// FileState is what a snapshot records about a file. A different size or
+// modification time marks the file as modified.
+type FileState struct {
+	Size    int64
+	ModTime time.Time
+}
+
+// Snapshot maps the files reported by a walk to their state.
+type Snapshot map[string]FileState
+
+// NewSnapshot records the files among walk results. Tests attached to a
+// source file (walker.TestsAttach) are not results of their own, so their
+// state is read from fsys.
+func NewSnapshot(fsys fs.FS, results []walker.Result) Snapshot {
+	snap := make(Snapshot)
+	for _, r := range results {
+		if r.Err != nil || r.IsDir {
+			continue
+		}
+		snap[r.Path] = FileState{Size: r.Size, ModTime: r.ModTime}
+		for _, test := range r.Tests {
+			if info, err := fs.Stat(fsys, filepath.ToSlash(test)); err == nil {
+				snap[test] = FileState{Size: info.Size(), ModTime: info.ModTime()}
+			}
+		}
+	}
+	return snap
+}
+
+// Take walks the tree configured by opts and returns its snapshot together
+// with the walk results, so callers can reuse the metadata the walker
+// collected. Results carrying errors are returned but not recorded.
+func Take(ctx context.Context, opts walker.Options) (Snapshot, []walker.Result, error) {
+	var results []walker.Result
+	for r := range walker.WalkContext(ctx, opts) {
+		results = append(results, r)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	fsys := opts.FS
+	if fsys == nil {
+		fsys = os.DirFS(opts.TargetPath)
+	}
+	return NewSnapshot(fsys, results), results, nil
+}
+
+// Changes lists the files that differ between two snapshots, sorted by path.
+type Changes struct {
+	Added    []string
+	Modified []string
+	Removed  []string
+}
+
+// Empty reports whether nothing changed.
+func (c Changes) Empty() bool {
+	return len(c.Added) == 0 && len(c.Modified) == 0 && len(c.Removed) == 0
+}
+
+// String summarizes the changes, e.g. "1 added, 2 modified, 0 removed".
+func (c Changes) String() string {
+	return fmt.Sprintf("%d added, %d modified, %d removed", len(c.Added), len(c.Modified), len(c.Removed))
+}
+
+// Compare returns the changes from old to cur.
+func Compare(old, cur Snapshot) Changes {
+	var c Changes
+	for path, state := range cur {
+		prev, ok := old[path]
+		switch {
+		case !ok:
+			c.Added = append(c.Added, path)
+		case prev.Size != state.Size || !prev.ModTime.Equal(state.ModTime):
+			c.Modified = append(c.Modified, path)
+		}
+	}
+	for path := range old {
+		if _, ok := cur[path]; !ok {
+			c.Removed = append(c.Removed, path)
+		}
+	}
+	sort.Strings(c.Added)
+	sort.Strings(c.Modified)
+	sort.Strings(c.Removed)
+	return c
+}
+
+// Watcher polls a tree for changes. No OS-specific notification API is
+// used: every poll is a walk whose snapshot is compared with the last one.
+type Watcher struct {
+	Options  walker.Options // Walk configuration, normally the one of the initial analysis
+	Interval time.Duration  // Time between polls (defaults to DefaultInterval)
+
+	// OnChange is called with the changes since the previous call (or since
+	// the baseline) and the results of the walk that found them.
+	OnChange func(ctx context.Context, changes Changes, results []walker.Result) error
+}
+
+// Run polls until ctx is cancelled, starting from baseline, the snapshot the
+// caller's current state reflects. Changes are reported once two consecutive
+// polls agree, so a burst of writes (saving several files, switching
+// branches) leads to a single OnChange call. Run returns nil when ctx is
+// cancelled, or the first error returned by OnChange.
+func (w *Watcher) Run(ctx context.Context, baseline Snapshot) error {
+	interval := w.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	reported := baseline // State handed to OnChange last
+	previous := baseline // State seen by the previous poll
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		current, results, err := Take(ctx, w.Options)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			fmt.Fprintf(os.Stderr, "Warning: Error polling for changes: %v\n", err)
+			continue
+		}
+
+		// Wait for the tree to settle before reporting
+		settled := Compare(previous, current).Empty()
+		previous = current
+		if !settled {
+			continue
+		}
+
+		changes := Compare(reported, current)
+		if changes.Empty() {
+			continue
+		}
+		if err := w.OnChange(ctx, changes, results); err != nil {
+			return err
+		}
+		reported = current
+	}
+}
@@ -1,18 +1,31 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io/fs"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/waqasraz/code-context/internal/embedcache"
 	"github.com/waqasraz/code-context/internal/llm"
 	"github.com/waqasraz/code-context/internal/output"
 	"github.com/waqasraz/code-context/internal/relevance"
+	"github.com/waqasraz/code-context/internal/source"
 	"github.com/waqasraz/code-context/internal/tree"
+	"github.com/waqasraz/code-context/internal/vectorindex"
 	"github.com/waqasraz/code-context/internal/walker"
+	"github.com/waqasraz/code-context/internal/watch"
 )
 
 // stringSlice is a custom type to handle repeatable flags
@@ -27,7 +40,471 @@ func (i *stringSlice) Set(value string) error {
 	return nil
 }
 
+// argValue returns the value of a flag given as --name=value or --name value.
+func argValue(name string) (string, bool) {
+	for i, arg := range os.Args {
+		if strings.HasPrefix(arg, "--"+name+"=") {
+			return strings.TrimPrefix(arg, "--"+name+"="), true
+		} else if (arg == "--"+name || arg == "-"+name) && i+1 < len(os.Args) {
+			return os.Args[i+1], true
+		}
+	}
+	return "", false
+}
+
+// argValues returns every value of a repeatable flag, in command line order.
+func argValues(name string) []string {
+	var values []string
+	for i, arg := range os.Args {
+		if strings.HasPrefix(arg, "--"+name+"=") {
+			values = append(values, strings.TrimPrefix(arg, "--"+name+"="))
+		} else if (arg == "--"+name || arg == "-"+name) && i+1 < len(os.Args) {
+			values = append(values, os.Args[i+1])
+		}
+	}
+	return values
+}
+
+// parseHeaders parses 'key:value' header flags, warning about malformed ones.
+func parseHeaders(values []string) map[string]string {
+	headers := make(map[string]string)
+	for _, header := range values {
+		parts := strings.SplitN(header, ":", 2)
+		if len(parts) == 2 {
+			key := strings.TrimSpace(parts[0])
+			value := strings.TrimSpace(parts[1])
+			headers[key] = value
+		} else {
+			fmt.Fprintf(os.Stderr, "Warning: invalid header format (expected 'key:value'): %s\n", header)
+		}
+	}
+	return headers
+}
+
+// argPresent reports whether a boolean flag appears anywhere on the command line.
+// The flag package stops at the first positional argument, so flags placed after
+// TARGET_PATH and QUERY have to be detected manually.
+func argPresent(name string) bool {
+	for _, arg := range os.Args[1:] {
+		if arg == "--"+name || arg == "-"+name || arg == "--"+name+"=true" {
+			return true
+		}
+	}
+	return false
+}
+
+// parseFusionFlags reads the score fusion settings of the hybrid approach
+// from the command line. The --fusion-config file comes first so that the
+// other flags can override it. The linear strategy has no default weights or
+// bias; they must come from the flags or the file.
+func parseFusionFlags() (relevance.FusionOptions, error) {
+	fusion := relevance.DefaultFusionOptions()
+	linearConfig := false
+	if path, ok := argValue("fusion-config"); ok {
+		loaded, err := relevance.LoadFusionOptions(path)
+		if err != nil {
+			return fusion, fmt.Errorf("invalid --fusion-config: %w", err)
+		}
+		fusion = loaded
+		linearConfig = loaded.Strategy == "linear" // Validated to carry its weights and bias
+	}
+	if value, ok := argValue("fusion"); ok {
+		fusion.Strategy = value
+	}
+	if value, ok := argValue("fusion-normalize"); ok {
+		fusion.Normalize = value
+	}
+	if fusion.Strategy == "linear" && !linearConfig {
+		fusion.Weights = relevance.SignalScores{} // Not the weighted defaults
+	}
+	if value, ok := argValue("fusion-weights"); ok {
+		if err := relevance.ParseWeights(value, &fusion.Weights); err != nil {
+			return fusion, fmt.Errorf("invalid --fusion-weights: %w", err)
+		}
+	}
+	if value, ok := argValue("fusion-bias"); ok {
+		bias, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fusion, fmt.Errorf("invalid --fusion-bias value %q", value)
+		}
+		fusion.Bias = &bias
+	}
+	if err := fusion.Validate(); err != nil {
+		if fusion.Strategy == "linear" {
+			return fusion, fmt.Errorf("%w: give them with --fusion-weights and --fusion-bias, or in --fusion-config", err)
+		}
+		return fusion, err
+	}
+	return fusion, nil
+}
+
+// parseAnalyzerFlags builds the query analyzer from the command line: the
+// built-in stopwords and synonyms, extended by the --synonyms file, then by
+// each --synonym.
+func parseAnalyzerFlags() (*relevance.Analyzer, error) {
+	analyzer := relevance.DefaultAnalyzer()
+	if path, ok := argValue("synonyms"); ok {
+		synonyms, err := relevance.LoadSynonyms(path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --synonyms: %w", err)
+		}
+		for term, words := range synonyms {
+			analyzer.AddSynonyms(term, words...)
+		}
+	}
+	for _, value := range argValues("synonym") {
+		term, words, err := relevance.ParseSynonyms(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --synonym: %w", err)
+		}
+		analyzer.AddSynonyms(term, words...)
+	}
+	return analyzer, nil
+}
+
+// runCacheCommand implements "code-context cache stats|clear [TARGET_PATH]".
+// The cache of TARGET_PATH (default: the current directory) is used unless
+// --cache-dir names another one.
+func runCacheCommand(args []string) int {
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--cache-dir" || args[i] == "-cache-dir" {
+			i++ // Value read by argValue
+			continue
+		}
+		if !strings.HasPrefix(args[i], "-") {
+			positional = append(positional, args[i])
+		}
+	}
+	if len(positional) == 0 || (positional[0] != "stats" && positional[0] != "clear") {
+		fmt.Println("Usage: code-context cache stats|clear [TARGET_PATH] [--cache-dir DIR]")
+		return 1
+	}
+
+	cacheDir, ok := argValue("cache-dir")
+	if !ok {
+		target := "."
+		if len(positional) > 1 {
+			target = positional[1]
+		}
+		cacheDir = defaultCacheDir(target)
+	}
+	if _, err := os.Stat(cacheDir); os.IsNotExist(err) {
+		fmt.Printf("No embedding cache at %s\n", cacheDir)
+		return 0
+	}
+	cache, err := embedcache.Open(cacheDir, 0)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	if positional[0] == "clear" {
+		if err := cache.Clear(); err != nil {
+			fmt.Printf("Error clearing embedding cache: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Cleared embedding cache at %s\n", cacheDir)
+		return 0
+	}
+
+	stats, err := cache.Stats()
+	if err != nil {
+		fmt.Printf("Error reading embedding cache: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Embedding cache: %s\n", stats.Dir)
+	fmt.Printf("Entries: %d\n", stats.Entries)
+	fmt.Printf("Size: %.1f MB with the vector indexes (limit %.1f MB)\n", float64(stats.Bytes)/(1024*1024), float64(stats.MaxBytes)/(1024*1024))
+	if stats.Entries > 0 {
+		fmt.Printf("Last used: %s (oldest entry last used %s)\n", stats.Newest.Format("2006-01-02 15:04:05"), stats.Oldest.Format("2006-01-02 15:04:05"))
+		var models []string
+		for model := range stats.ByModel {
+			models = append(models, model)
+		}
+		sort.Strings(models)
+		for _, model := range models {
+			fmt.Printf("  %s: %d entries\n", model, stats.ByModel[model])
+		}
+	}
+	fmt.Printf("Vector indexes: %d (%.1f MB)\n", stats.Indexes, float64(stats.IndexBytes)/(1024*1024))
+	return 0
+}
+
+// defaultCacheDir returns the cache directory for a target: inside it for a
+// directory, next to it for an archive.
+func defaultCacheDir(target string) string {
+	absTarget, err := filepath.Abs(target)
+	if err != nil {
+		absTarget = target
+	}
+	if info, err := os.Stat(absTarget); err == nil && !info.IsDir() {
+		return filepath.Join(filepath.Dir(absTarget), embedcache.DirName)
+	}
+	return filepath.Join(absTarget, embedcache.DirName)
+}
+
+// evalValueFlags are the flags of the eval command that take a value.
+var evalValueFlags = map[string]bool{
+	"k": true, "strategies": true, "json": true, "ignore": true, "include": true,
+	"cache-dir": true, "embedding-provider": true, "embedding-model": true, "embedding-endpoint": true,
+	"embedding-api-key": true, "embedding-dimensions": true, "embedding-header": true, "llm-api-key": true,
+	"fusion": true, "fusion-normalize": true, "fusion-weights": true, "fusion-bias": true, "fusion-config": true,
+	"synonyms": true, "synonym": true,
+}
+
+// runEvalCommand implements "code-context eval QUERIES_FILE [TARGET_PATH]".
+// It ranks the files of TARGET_PATH (default: the current directory) for
+// each labeled query with every strategy and reports how well each one
+// found the labeled files. No LLM is used, so the evaluation runs offline
+// with a local embedding provider.
+func runEvalCommand(args []string) int {
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		name := strings.TrimLeft(args[i], "-")
+		if strings.HasPrefix(args[i], "-") && evalValueFlags[name] {
+			i++ // Value read by argValue
+			continue
+		}
+		if !strings.HasPrefix(args[i], "-") {
+			positional = append(positional, args[i])
+		}
+	}
+	if len(positional) == 0 {
+		fmt.Println("Usage: code-context eval QUERIES_FILE [TARGET_PATH] [--k N] [--strategies keyword,embedding,hybrid] [--json FILE]")
+		return 1
+	}
+	target := "."
+	if len(positional) > 1 {
+		target = positional[1]
+	}
+
+	queries, err := relevance.LoadEvalQueries(positional[0])
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	k := 10
+	if value, ok := argValue("k"); ok {
+		k, err = strconv.Atoi(value)
+		if err != nil || k < 1 {
+			fmt.Printf("Error: invalid --k value %q\n", value)
+			return 1
+		}
+	}
+	strategies := []string{"keyword", "embedding", "hybrid"}
+	if value, ok := argValue("strategies"); ok {
+		strategies = nil
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name != "keyword" && name != "embedding" && name != "hybrid" {
+				fmt.Printf("Error: unknown strategy %q (expected 'keyword', 'embedding' or 'hybrid')\n", name)
+				return 1
+			}
+			strategies = append(strategies, name)
+		}
+	}
+	fusion, err := parseFusionFlags()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	analyzer, err := parseAnalyzerFlags()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	// Walk the target like the main command does with default settings
+	absTarget, err := filepath.Abs(target)
+	if err != nil {
+		fmt.Printf("Error getting absolute path for %s: %v\n", target, err)
+		return 1
+	}
+	src, err := source.Open(absTarget)
+	if err != nil {
+		fmt.Printf("Error opening target %s: %v\n", absTarget, err)
+		return 1
+	}
+	defer src.Close()
+	walkerOpts := walker.Options{
+		TargetPath:      absTarget,
+		IgnorePatterns:  argValues("ignore"),
+		IncludePatterns: argValues("include"),
+	}
+	if !src.OnDisk {
+		walkerOpts.FS = src.FS
+	}
+	var candidates []string
+	for result := range walker.Walk(walkerOpts) {
+		if result.Err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", result.Err)
+			continue
+		}
+		if !result.IsDir && result.Path != "." {
+			candidates = append(candidates, result.Path)
+		}
+	}
+	isCandidate := make(map[string]bool, len(candidates))
+	for _, candidate := range candidates {
+		isCandidate[filepath.ToSlash(candidate)] = true
+	}
+	for i, query := range queries {
+		for _, file := range query.Relevant {
+			if !isCandidate[filepath.ToSlash(filepath.Clean(file))] {
+				fmt.Fprintf(os.Stderr, "Warning: Query %d: relevant file %s is not among the %d candidate files\n", i+1, file, len(candidates))
+			}
+		}
+	}
+	fmt.Printf("Evaluating %d queries over %d files in %s (k = %d)\n", len(queries), len(candidates), absTarget, k)
+
+	// Rank with the same settings as the main command's embedding flags
+	embeddingOpts := relevance.DefaultEmbeddingOptions()
+	embeddingOpts.TargetPath = absTarget
+	embeddingOpts.FS = src.FS
+	embeddingOpts.CandidateFiles = candidates
+	embeddingOpts.MaxFilesToCheck = k
+	embeddingOpts.Index = relevance.BuildIndex(src.FS, candidates)
+	embeddingOpts.Fusion = fusion
+	embeddingOpts.Analyzer = analyzer
+	embeddingOpts.Headers = parseHeaders(argValues("embedding-header"))
+	if value, ok := argValue("embedding-provider"); ok {
+		embeddingOpts.Provider = value
+	}
+	if value, ok := argValue("embedding-model"); ok {
+		embeddingOpts.Model = value
+	}
+	if value, ok := argValue("embedding-endpoint"); ok {
+		embeddingOpts.Endpoint = value
+	}
+	if value, ok := argValue("embedding-api-key"); ok {
+		embeddingOpts.APIKey = value
+	} else if value, ok := argValue("llm-api-key"); ok {
+		embeddingOpts.APIKey = value
+	} else {
+		embeddingOpts.APIKey = os.Getenv("LLM_API_KEY")
+	}
+	if value, ok := argValue("embedding-dimensions"); ok {
+		embeddingOpts.Dimensions, err = strconv.Atoi(value)
+		if err != nil || embeddingOpts.Dimensions < 0 {
+			fmt.Printf("Error: invalid --embedding-dimensions value %q\n", value)
+			return 1
+		}
+	}
+	if !argPresent("no-cache") && (slices.Contains(strategies, "embedding") || slices.Contains(strategies, "hybrid")) {
+		cacheDir, ok := argValue("cache-dir")
+		if !ok {
+			cacheDir = defaultCacheDir(absTarget)
+		}
+		embeddingOpts.Cache, err = embedcache.Open(cacheDir, 0)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Embedding cache disabled: %v\n", err)
+			embeddingOpts.Cache = nil
+		}
+	}
+
+	var results []relevance.StrategyEval
+	failed := make(map[string]error)
+	for _, strategy := range strategies {
+		fmt.Printf("\n--- Strategy: %s ---\n", strategy)
+		result, err := relevance.Evaluate(strategy, queries, k, func(query string) ([]relevance.FileInfo, error) {
+			opts := embeddingOpts
+			opts.Query = query
+			switch strategy {
+			case "embedding":
+				return relevance.IdentifyRelevantFilesWithEmbeddings(opts)
+			case "hybrid":
+				// Without embeddings the numbers would be keyword and path only
+				opts.RequireEmbeddings = true
+				return relevance.IdentifyRelevantFilesWithHybridApproach(opts)
+			default:
+				return relevance.IdentifyRelevantFiles(relevance.Options{
+					Query:           query,
+					TargetPath:      absTarget,
+					FS:              src.FS,
+					CandidateFiles:  candidates,
+					MaxFilesToCheck: k,
+					Index:           opts.Index,
+					Analyzer:        analyzer,
+				})
+			}
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Strategy %s failed: %v\n", strategy, err)
+			failed[strategy] = err
+			continue
+		}
+		results = append(results, result)
+	}
+
+	// Per-query nDCG, then the mean of every metric per strategy
+	fmt.Printf("\n--- Evaluation Results (k = %d) ---\n", k)
+	fmt.Printf("%-4s", "#")
+	for _, result := range results {
+		fmt.Printf(" %-10s", result.Strategy)
+	}
+	fmt.Println(" Query")
+	for i, query := range queries {
+		fmt.Printf("%-4d", i+1)
+		for _, result := range results {
+			fmt.Printf(" %-10.3f", result.Queries[i].Metrics.NDCG)
+		}
+		fmt.Printf(" %s\n", query.Query)
+	}
+	fmt.Println()
+	fmt.Printf("%-10s %-10s %-13s %-8s %s\n", "Strategy", fmt.Sprintf("Recall@%d", k), fmt.Sprintf("Precision@%d", k), "MRR", fmt.Sprintf("nDCG@%d", k))
+	for _, strategy := range strategies {
+		if err, ok := failed[strategy]; ok {
+			fmt.Printf("%-10s failed: %v\n", strategy, err)
+			continue
+		}
+		for _, result := range results {
+			if result.Strategy == strategy {
+				m := result.Mean
+				fmt.Printf("%-10s %-10.3f %-13.3f %-8.3f %.3f\n", strategy, m.Recall, m.Precision, m.MRR, m.NDCG)
+			}
+		}
+	}
+
+	if jsonPath, ok := argValue("json"); ok {
+		report := struct {
+			Target            string                   `json:"target"`
+			K                 int                      `json:"k"`
+			EmbeddingProvider string                   `json:"embedding_provider"`
+			EmbeddingModel    string                   `json:"embedding_model"`
+			Fusion            relevance.FusionOptions  `json:"fusion"`
+			Results           []relevance.StrategyEval `json:"results"`
+			Errors            map[string]string        `json:"errors,omitempty"`
+		}{absTarget, k, embeddingOpts.Provider, embeddingOpts.Model, fusion, results, make(map[string]string)}
+		for strategy, err := range failed {
+			report.Errors[strategy] = err.Error()
+		}
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err == nil {
+			err = os.WriteFile(jsonPath, append(data, '\n'), 0o644)
+		}
+		if err != nil {
+			fmt.Printf("Error writing evaluation results: %v\n", err)
+			return 1
+		}
+		fmt.Printf("\nResults written to %s\n", jsonPath)
+	}
+	if len(failed) > 0 {
+		return 1
+	}
+	return 0
+}
+
 func main() {
+	// "code-context cache ..." inspects or clears the embedding cache
+	if len(os.Args) > 1 && os.Args[1] == "cache" {
+		os.Exit(runCacheCommand(os.Args[2:]))
+	}
+	// "code-context eval ..." measures the relevance strategies on labeled queries
+	if len(os.Args) > 1 && os.Args[1] == "eval" {
+		os.Exit(runEvalCommand(os.Args[2:]))
+	}
+
 	// --- Define Flags ---
 	// Define these flags for documentation in --help, but we'll handle them manually
 	_ = flag.String("o", "CODE_CONTEXT_SUMMARY.md", "Specify the output Markdown file name.")
@@ -41,11 +518,74 @@ func main() {
 	useHybridSearch := flag.Bool("use-hybrid", true, "Use hybrid approach combining embeddings with traditional relevance metrics.")
 	embeddingModel := flag.String("embedding-model", "nomic-embed-text", "Model to use for embeddings when --use-embeddings is enabled.")
 	embeddingEndpoint := flag.String("embedding-endpoint", "http://localhost:11434/api/embeddings", "Endpoint URL for embedding API (e.g., Ollama, other HTTP-based).")
-	embeddingProvider := flag.String("embedding-provider", "ollama", "Embedding provider to use: 'ollama', 'gemini', 'openai', 'anthropic'.")
+	embeddingProvider := flag.String("embedding-provider", "ollama", "Embedding provider to use: 'ollama', 'gemini', 'openai' (or any OpenAI-compatible server), 'local-lite' (built-in hashed TF-IDF vectors, no model needed), 'anthropic'.")
+	embeddingDimensions := flag.Int("embedding-dimensions", 0, "Requested embedding size for models that can shorten vectors, e.g. OpenAI text-embedding-3 (0 = model default).")
+	embeddingBatchSize := flag.Int("embedding-batch-size", 32, "Number of texts sent per embedding request by providers that support batches.")
+	embeddingConcurrency := flag.Int("embedding-concurrency", 4, "Number of embedding requests in flight at once.")
+	embeddingRate := flag.Float64("embedding-rate", 0, "Maximum embedding requests per second (0 = provider default: 1.5 for gemini, 50 for openai, unlimited otherwise; -1 = unlimited).")
+	var embeddingHeaders stringSlice
+	flag.Var(&embeddingHeaders, "embedding-header", "Additional headers for embedding API requests in format 'key:value' (repeatable; OpenAI-compatible provider).")
 	var llmHeaders stringSlice
 	flag.Var(&llmHeaders, "llm-header", "Additional headers for LLM API requests in format 'key:value' (repeatable).")
 	var ignorePatterns stringSlice
 	flag.Var(&ignorePatterns, "ignore", "Glob patterns for files/directories to ignore (repeatable).")
+	var includePatterns stringSlice
+	flag.Var(&includePatterns, "include", "Glob patterns for files to include; when set, only matching files are analyzed (repeatable).")
+	maxDepth := flag.Int("max-depth", 0, "Maximum directory depth to descend into (0 = unlimited).")
+	minSize := flag.String("min-size", "0", "Skip files smaller than this size (e.g. '100B', '1KB').")
+	maxSize := flag.String("max-size", "2MB", "Skip files larger than this size (e.g. '512KB', '2MB'; '0' = no limit).")
+	var profileNames stringSlice
+	flag.Var(&profileNames, "profile", "Ecosystem profiles to apply instead of auto-detecting them: 'go', 'node', 'python', 'dotnet', 'java', 'rust', 'terraform' (repeatable or comma-separated).")
+	var disabledProfiles stringSlice
+	flag.Var(&disabledProfiles, "no-profile", "Ecosystem profiles never to apply, or 'all' to disable profiles (repeatable or comma-separated).")
+	testsFlag := flag.String("tests", "include", "How to treat test files: 'include', 'exclude', 'only' (tests alone), or 'attach' (analyze tests together with the source files they cover).")
+	noGitignore := flag.Bool("no-gitignore", false, "Do not honor .gitignore, .ignore and .git/info/exclude files.")
+	gitTracked := flag.Bool("git-tracked", false, "Only analyze files tracked in the git index.")
+	gitDiff := flag.String("git-diff", "", "Only analyze files changed between two revisions: 'base', 'base..head' or 'base...head' (merge base).")
+	var includeClasses stringSlice
+	flag.Var(&includeClasses, "include-class", "File classes to include besides text: 'binary', 'generated', 'minified', 'lockfile' (repeatable or comma-separated).")
+	var excludeClasses stringSlice
+	flag.Var(&excludeClasses, "exclude-class", "File classes to exclude (repeatable or comma-separated).")
+	gitRev := flag.String("git-rev", "", "Analyze the files of a git revision (e.g. 'v1.2.0') without checking it out.")
+	gitWorktree := flag.Bool("git-worktree", false, "Only analyze files changed in the working tree compared to HEAD, plus untracked files.")
+	followSymlinks := flag.Bool("follow-symlinks", false, "Follow symlinked directories, skipping cycles and targets outside the target path.")
+	var symlinkAllow stringSlice
+	flag.Var(&symlinkAllow, "symlink-allow", "Directory outside the target path that followed symlinks may point into (repeatable).")
+	detectModules := flag.Bool("modules", false, "Detect monorepo modules (go.work/go.mod, npm/pnpm workspaces, Cargo, Maven/Gradle, .NET solutions) and group the output by module.")
+	var moduleNames stringSlice
+	flag.Var(&moduleNames, "module", "Only analyze this module, by name or path (repeatable or comma-separated; implies --modules).")
+	maxFilesPerModule := flag.Int("max-files-per-module", 0, "Maximum number of relevant files per module (0 = no limit; implies --modules).")
+	cacheDirFlag := flag.String("cache-dir", "", "Directory of the embedding cache (default: .code-context inside the target directory).")
+	noCache := flag.Bool("no-cache", false, "Do not read or store embeddings in the on-disk cache.")
+	cacheMaxSize := flag.String("cache-max-size", "512MB", "Size limit of the embedding cache, vector indexes included; least recently used files are evicted (e.g. '1GB').")
+	chunkLines := flag.Int("chunk-lines", 60, "Maximum lines per embedded chunk; files are split at function and class boundaries where possible.")
+	chunkOverlap := flag.Int("chunk-overlap", 10, "Lines shared by consecutive chunks when a long block has to be cut into windows.")
+	chunkScore := flag.String("chunk-score", "max", "How chunk similarities make a file score: 'max' (best chunk) or 'topk' (mean of the --chunk-top-k best chunks).")
+	chunkTopK := flag.Int("chunk-top-k", 3, "Number of best chunks averaged by --chunk-score topk, and of line ranges reported per file.")
+	_ = flag.String("fusion", "weighted", "How hybrid relevance combines embedding, keyword and path scores: 'weighted' (weighted sum), 'rrf' (Reciprocal Rank Fusion) or 'linear' (logistic model; needs --fusion-weights and --fusion-bias).")
+	_ = flag.String("fusion-normalize", "minmax", "How --fusion weighted normalizes the scores: 'minmax', 'zscore' or 'fixed'.")
+	_ = flag.String("fusion-weights", "", "Weights of the hybrid signals, e.g. 'embedding=0.7,keyword=0.2,path=0.1'.")
+	_ = flag.String("fusion-bias", "", "Intercept of --fusion linear, e.g. '-3.1'.")
+	_ = flag.String("fusion-config", "", "JSON file with fusion settings (strategy, normalize, weights, bias, rrf_k); flags override it.")
+	_ = flag.String("synonyms", "", "JSON file of query synonyms, e.g. {\"auth\": [\"login\", \"jwt\"]}, added to the built-in ones.")
+	var synonymFlags stringSlice
+	flag.Var(&synonymFlags, "synonym", "Query synonyms as 'term=word,word', e.g. 'auth=login,jwt' (repeatable).")
+	cutoffStrategy := flag.String("cutoff", "fixed", "How many relevant files to keep: 'fixed' (--max-files), 'threshold' (score of at least --cutoff-score), 'elbow' (cut at the largest score drop), 'relative' (at least --cutoff-ratio times the best score) or 'tokens' (files fitting in --token-budget).")
+	minFiles := flag.Int("min-files", 3, "Fewest relevant files kept by the adaptive cutoffs, when there are that many.")
+	maxFiles := flag.Int("max-files", 20, "Most relevant files kept; --cutoff tokens is only capped when this is given.")
+	cutoffScore := flag.Float64("cutoff-score", 0.5, "Lowest score kept by --cutoff threshold; the scale depends on the relevance approach.")
+	cutoffRatio := flag.Float64("cutoff-ratio", 0.5, "Share of the best score kept by --cutoff relative (0-1).")
+	tokenBudget := flag.Int("token-budget", 32000, "Estimated tokens of file content sent to the LLM with --cutoff tokens (about 4 bytes per token).")
+	explainFlag := flag.Bool("explain", false, "Explain in the report why each file was selected: signal scores and ranks, matched keywords and best chunk.")
+	explainJSON := flag.String("explain-json", "", "Write the explanations, including the files ranked just below the selection, to this JSON file.")
+	rerankFlag := flag.Bool("rerank", false, "Let the LLM provider grade the best candidates from previews and reorder them by relevance.")
+	rerankTopN := flag.Int("rerank-top-n", 20, "Number of best candidates graded by --rerank.")
+	rerankMinGrade := flag.Int("rerank-min-grade", 1, "Drop reranked files graded below this (0-3; 0 keeps every file).")
+	rerankBatchSize := flag.Int("rerank-batch-size", 10, "Number of file previews sent per rerank request.")
+	rerankPreviewLines := flag.Int("rerank-preview-lines", 40, "Number of first lines of each file shown to the LLM by --rerank.")
+	watchFlag := flag.Bool("watch", false, "Keep running and update the report whenever files change.")
+	watchInterval := flag.String("watch-interval", "2s", "How often to poll for changes in watch mode (e.g. '500ms', '5s').")
+	walkWorkers := flag.Int("workers", 0, "Number of concurrent workers used to walk the directory (defaults to the number of CPUs).")
 	// Define show-tree flag for documentation, but handle it manually
 	_ = flag.Bool("show-tree", false, "Include a directory tree structure in the output.")
 
@@ -192,6 +732,300 @@ func main() {
 		}
 	}
 
+	// Manual detection of --no-gitignore flag
+	if argPresent("no-gitignore") {
+		*noGitignore = true
+	}
+
+	// Manual detection of git selection flags
+	if argPresent("git-tracked") {
+		*gitTracked = true
+	}
+	if argPresent("git-worktree") {
+		*gitWorktree = true
+	}
+	if value, ok := argValue("git-diff"); ok {
+		*gitDiff = value
+	}
+	if value, ok := argValue("git-rev"); ok {
+		*gitRev = value
+	}
+	// Manual detection of include and limit flags
+	if len(includePatterns) == 0 {
+		includePatterns = argValues("include")
+	}
+	if value, ok := argValue("max-depth"); ok {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			fmt.Printf("Error: invalid --max-depth value %q\n", value)
+			os.Exit(1)
+		}
+		*maxDepth = n
+	}
+	if value, ok := argValue("min-size"); ok {
+		*minSize = value
+	}
+	if value, ok := argValue("max-size"); ok {
+		*maxSize = value
+	}
+	minSizeBytes, err := walker.ParseSize(*minSize)
+	if err != nil {
+		fmt.Printf("Error: invalid --min-size: %v\n", err)
+		os.Exit(1)
+	}
+	maxSizeBytes, err := walker.ParseSize(*maxSize)
+	if err != nil {
+		fmt.Printf("Error: invalid --max-size: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Manual detection of --tests flag
+	if value, ok := argValue("tests"); ok {
+		*testsFlag = value
+	}
+	testMode, ok := walker.ParseTestMode(*testsFlag)
+	if !ok {
+		fmt.Printf("Error: invalid --tests value %q (use include, exclude, only or attach)\n", *testsFlag)
+		os.Exit(1)
+	}
+
+	// Manual detection of profile flags
+	if len(profileNames) == 0 {
+		profileNames = argValues("profile")
+	}
+	if len(disabledProfiles) == 0 {
+		disabledProfiles = argValues("no-profile")
+	}
+
+	// Manual detection of symlink flags
+	if argPresent("follow-symlinks") {
+		*followSymlinks = true
+	}
+	if len(symlinkAllow) == 0 {
+		symlinkAllow = argValues("symlink-allow")
+	}
+
+	// Manual detection of module flags
+	if argPresent("modules") {
+		*detectModules = true
+	}
+	if len(moduleNames) == 0 {
+		moduleNames = argValues("module")
+	}
+	if value, ok := argValue("max-files-per-module"); ok {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			fmt.Printf("Error: invalid --max-files-per-module value %q\n", value)
+			os.Exit(1)
+		}
+		*maxFilesPerModule = n
+	}
+	if len(moduleNames) > 0 || *maxFilesPerModule > 0 {
+		*detectModules = true
+	}
+
+	// Manual detection of embedding cache flags
+	if value, ok := argValue("cache-dir"); ok {
+		*cacheDirFlag = value
+	}
+	if argPresent("no-cache") {
+		*noCache = true
+	}
+	if value, ok := argValue("cache-max-size"); ok {
+		*cacheMaxSize = value
+	}
+	cacheMaxBytes, err := walker.ParseSize(*cacheMaxSize)
+	if err != nil {
+		fmt.Printf("Error: invalid --cache-max-size: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Manual detection of chunking flags
+	for _, intFlag := range []struct {
+		name  string
+		value *int
+	}{{"chunk-lines", chunkLines}, {"chunk-overlap", chunkOverlap}, {"chunk-top-k", chunkTopK}} {
+		if value, ok := argValue(intFlag.name); ok {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				fmt.Printf("Error: invalid --%s value %q\n", intFlag.name, value)
+				os.Exit(1)
+			}
+			*intFlag.value = n
+		}
+	}
+	if value, ok := argValue("chunk-score"); ok {
+		*chunkScore = value
+	}
+	if *chunkScore != "max" && *chunkScore != "topk" {
+		fmt.Printf("Error: invalid --chunk-score value %q (expected 'max' or 'topk')\n", *chunkScore)
+		os.Exit(1)
+	}
+	if *chunkLines > 0 && *chunkOverlap >= *chunkLines {
+		fmt.Printf("Error: --chunk-overlap (%d) must be smaller than --chunk-lines (%d)\n", *chunkOverlap, *chunkLines)
+		os.Exit(1)
+	}
+	chunking := relevance.ChunkOptions{
+		MaxLines:  *chunkLines,
+		Overlap:   *chunkOverlap,
+		Aggregate: *chunkScore,
+		TopK:      *chunkTopK,
+	}
+
+	// Manual detection of fusion flags
+	fusion, err := parseFusionFlags()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Manual detection of query analysis flags
+	analyzer, err := parseAnalyzerFlags()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Manual detection of explain flags
+	if argPresent("explain") {
+		*explainFlag = true
+	}
+	if value, ok := argValue("explain-json"); ok {
+		*explainJSON = value
+	}
+	explaining := *explainFlag || *explainJSON != ""
+
+	// Manual detection of cutoff flags
+	if value, ok := argValue("cutoff"); ok {
+		*cutoffStrategy = value
+	}
+	for _, intFlag := range []struct {
+		name  string
+		value *int
+	}{{"min-files", minFiles}, {"max-files", maxFiles}, {"token-budget", tokenBudget}} {
+		if value, ok := argValue(intFlag.name); ok {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 || (n == 0 && intFlag.name != "min-files") {
+				fmt.Printf("Error: invalid --%s value %q\n", intFlag.name, value)
+				os.Exit(1)
+			}
+			*intFlag.value = n
+		}
+	}
+	for _, floatFlag := range []struct {
+		name  string
+		value *float64
+	}{{"cutoff-score", cutoffScore}, {"cutoff-ratio", cutoffRatio}} {
+		if value, ok := argValue(floatFlag.name); ok {
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil || (floatFlag.name == "cutoff-ratio" && f <= 0) {
+				fmt.Printf("Error: invalid --%s value %q\n", floatFlag.name, value)
+				os.Exit(1)
+			}
+			*floatFlag.value = f
+		}
+	}
+	cutoff := relevance.CutoffOptions{
+		Strategy:    *cutoffStrategy,
+		MinFiles:    *minFiles,
+		MaxFiles:    *maxFiles,
+		Score:       *cutoffScore,
+		Ratio:       *cutoffRatio,
+		TokenBudget: *tokenBudget,
+	}
+	if _, ok := argValue("max-files"); !ok && cutoff.Strategy == "tokens" {
+		cutoff.MaxFiles = 0 // The token budget alone decides
+	}
+	if err := cutoff.Validate(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Manual detection of rerank flags
+	if argPresent("rerank") {
+		*rerankFlag = true
+	}
+	for _, intFlag := range []struct {
+		name  string
+		value *int
+	}{{"rerank-top-n", rerankTopN}, {"rerank-min-grade", rerankMinGrade}, {"rerank-batch-size", rerankBatchSize}, {"rerank-preview-lines", rerankPreviewLines}} {
+		if value, ok := argValue(intFlag.name); ok {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 || (n == 0 && intFlag.name != "rerank-min-grade") {
+				fmt.Printf("Error: invalid --%s value %q\n", intFlag.name, value)
+				os.Exit(1)
+			}
+			*intFlag.value = n
+		}
+	}
+	if *rerankMinGrade > relevance.MaxGrade {
+		fmt.Printf("Error: --rerank-min-grade must be between 0 and %d\n", relevance.MaxGrade)
+		os.Exit(1)
+	}
+	rerankOpts := relevance.RerankOptions{
+		TopN:         *rerankTopN,
+		BatchSize:    *rerankBatchSize,
+		PreviewLines: *rerankPreviewLines,
+		MinGrade:     *rerankMinGrade,
+	}
+
+	// Manual detection of watch flags
+	if argPresent("watch") {
+		*watchFlag = true
+	}
+	if value, ok := argValue("watch-interval"); ok {
+		*watchInterval = value
+	}
+	pollInterval, err := time.ParseDuration(*watchInterval)
+	if err != nil || pollInterval <= 0 {
+		fmt.Printf("Error: invalid --watch-interval value %q\n", *watchInterval)
+		os.Exit(1)
+	}
+
+	// Manual detection of --workers flag
+	if value, ok := argValue("workers"); ok {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			fmt.Printf("Error: invalid --workers value %q\n", value)
+			os.Exit(1)
+		}
+		*walkWorkers = n
+	}
+
+	// Manual detection of file class policy flags
+	if len(includeClasses) == 0 {
+		includeClasses = argValues("include-class")
+	}
+	if len(excludeClasses) == 0 {
+		excludeClasses = argValues("exclude-class")
+	}
+	classPolicy := walker.ClassPolicy{}
+	for _, list := range []struct {
+		names   []string
+		include bool
+	}{{includeClasses, true}, {excludeClasses, false}} {
+		for _, value := range list.names {
+			for _, name := range strings.Split(value, ",") {
+				class, ok := walker.ParseFileClass(name)
+				if !ok {
+					fmt.Printf("Error: unknown file class %q\n", name)
+					os.Exit(1)
+				}
+				classPolicy[class] = list.include
+			}
+		}
+	}
+
+	gitMode := walker.GitModeNone
+	switch {
+	case *gitDiff != "":
+		gitMode = walker.GitModeDiff
+	case *gitWorktree:
+		gitMode = walker.GitModeWorktree
+	case *gitTracked:
+		gitMode = walker.GitModeTracked
+	}
+
 	// --- Validate Target Path ---
 	absTargetPath, err := filepath.Abs(targetPath)
 	if err != nil {
@@ -203,23 +1037,167 @@ func main() {
 		os.Exit(1)
 	}
 
+	// --- Open the Scan Source (directory, archive or git revision) ---
+	var src *source.Source
+	if *gitRev != "" {
+		src, err = source.OpenGitTree(absTargetPath, *gitRev)
+	} else {
+		src, err = source.Open(absTargetPath)
+	}
+	if err != nil {
+		fmt.Printf("Error opening target %s: %v\n", absTargetPath, err)
+		os.Exit(1)
+	}
+	defer src.Close()
+	if !src.OnDisk && (gitMode != walker.GitModeNone || *followSymlinks) {
+		fmt.Printf("Error: --git-tracked, --git-diff, --git-worktree and --follow-symlinks need a directory target, not a %s\n", src.Kind)
+		os.Exit(1)
+	}
+	if gitMode == walker.GitModeDiff {
+		// The walk reads the changed files as of the diff's head; so must the
+		// relevance scoring and summaries when that head is not checked out
+		head, checkedOut, err := walker.DiffHead(absTargetPath, *gitDiff, "")
+		if err != nil {
+			fmt.Printf("Error: invalid --git-diff %q: %v\n", *gitDiff, err)
+			os.Exit(1)
+		}
+		if !checkedOut {
+			if *watchFlag {
+				fmt.Printf("Error: --watch needs the head of --git-diff checked out\n")
+				os.Exit(1)
+			}
+			headSrc, err := source.OpenGitTree(absTargetPath, head)
+			if err != nil {
+				fmt.Printf("Error opening revision %s: %v\n", head, err)
+				os.Exit(1)
+			}
+			defer headSrc.Close()
+			src.FS = headSrc.FS
+		}
+	}
+	if !src.OnDisk && *watchFlag {
+		fmt.Printf("Error: --watch needs a directory target, not a %s\n", src.Kind)
+		os.Exit(1)
+	}
+	var walkFS fs.FS // nil walks the directory itself
+	if !src.OnDisk {
+		walkFS = src.FS
+	}
+
+	// --- Resolve Ecosystem Profiles ---
+	var activeProfiles []string
+	if len(profileNames) > 0 {
+		for _, value := range profileNames {
+			for _, name := range strings.Split(value, ",") {
+				if _, ok := walker.LookupProfile(name); !ok {
+					fmt.Printf("Error: unknown profile %q (available: %s)\n", name, strings.Join(walker.ProfileNames(), ", "))
+					os.Exit(1)
+				}
+				activeProfiles = append(activeProfiles, strings.TrimSpace(name))
+			}
+		}
+	} else {
+		activeProfiles, err = walker.DetectProfiles(context.Background(), src.FS)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Error detecting project profiles: %v\n", err)
+		}
+		if activeProfiles == nil {
+			activeProfiles = []string{} // Nothing detected; don't let the walker scan again
+		}
+	}
+	var profilesOff []string
+	for _, value := range disabledProfiles {
+		profilesOff = append(profilesOff, strings.Split(value, ",")...)
+	}
+
+	// --- Detect Monorepo Modules ---
+	var modules []walker.Module
+	var onlyModules []string
+	if *detectModules {
+		modules, err = walker.DetectModules(context.Background(), src.FS)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Error detecting modules: %v\n", err)
+		}
+		for _, value := range moduleNames {
+			for _, name := range strings.Split(value, ",") {
+				name = strings.TrimSpace(name)
+				if _, ok := walker.FindModule(modules, name); !ok {
+					fmt.Printf("Error: unknown module %q (detected: %v)\n", name, modules)
+					os.Exit(1)
+				}
+				onlyModules = append(onlyModules, name)
+			}
+		}
+	}
+	moduleByPath := make(map[string]walker.Module)
+	for _, m := range modules {
+		moduleByPath[m.Path] = m
+	}
+
 	// --- Print Parsed Config ---
 	fmt.Println("--- Configuration ---")
 	fmt.Printf("Target Path: %s\n", absTargetPath)
+	if src.Kind != source.KindDir {
+		fmt.Printf("Target Source: %s %s\n", src.Kind, *gitRev)
+	}
 	fmt.Printf("Query: %s\n", query)
+	fmt.Printf("Query Terms: %s\n", analyzer.Describe(query))
 	fmt.Printf("Output File: %s\n", outputFileName)
 	fmt.Printf("Ignore Patterns: %v\n", ignorePatterns)
+	fmt.Printf("Profiles: %v", activeProfiles)
+	if len(profilesOff) > 0 {
+		fmt.Printf(" (disabled: %v)", profilesOff)
+	}
+	fmt.Println()
+	if len(includePatterns) > 0 {
+		fmt.Printf("Include Patterns: %v\n", includePatterns)
+	}
+	if *detectModules {
+		fmt.Printf("Modules: %d detected", len(modules))
+		if len(onlyModules) > 0 {
+			fmt.Printf(" (analyzing: %v)", onlyModules)
+		}
+		if *maxFilesPerModule > 0 {
+			fmt.Printf(", at most %d relevant files each", *maxFilesPerModule)
+		}
+		fmt.Println()
+	}
+	fmt.Printf("Max Depth: %d, File Size Limits: %s - %s\n", *maxDepth, *minSize, *maxSize)
+	fmt.Printf("Honor Ignore Files: %t\n", !*noGitignore)
+	fmt.Printf("File Class Policy: %v\n", classPolicy)
+	fmt.Printf("Test Files: %s\n", *testsFlag)
+	fmt.Printf("Follow Symlinks: %t\n", *followSymlinks)
+	if gitMode != walker.GitModeNone {
+		fmt.Printf("Git Mode: %s %s\n", gitMode, *gitDiff)
+	}
 	fmt.Printf("Show Tree: %t\n", showTreeFlag)
+	if *watchFlag {
+		fmt.Printf("Watch: every %s\n", pollInterval)
+	}
 	fmt.Printf("LLM Provider: %s\n", *llmProvider)
 	fmt.Printf("LLM Model: %s\n", *llmModel)
 	fmt.Printf("LLM API Key Set: %t\n", *llmApiKey != "")
 	fmt.Printf("LLM Endpoint Set: %t\n", *llmEndpoint != "")
+	fmt.Printf("File Selection: %s\n", cutoff)
 	fmt.Printf("Using Embeddings: %t\n", *useEmbeddings)
 	fmt.Printf("Using Hybrid Search: %t\n", *useHybridSearch)
+	if *useHybridSearch {
+		fmt.Printf("Score Fusion: %s", fusion.Strategy)
+		if fusion.Strategy == "weighted" {
+			fmt.Printf(" (%s)", fusion.Normalize)
+		}
+		fmt.Printf(", weights: embedding=%g keyword=%g path=%g", fusion.Weights.Embedding, fusion.Weights.Keyword, fusion.Weights.Path)
+		if fusion.Bias != nil {
+			fmt.Printf(", bias: %g", *fusion.Bias)
+		}
+		fmt.Println()
+	}
 	if *useEmbeddings || *useHybridSearch {
 		fmt.Printf("Embedding Provider: %s\n", *embeddingProvider)
-		fmt.Printf("Embedding Model: %s\n", *embeddingModel)
-		fmt.Printf("Embedding Endpoint: %s\n", *embeddingEndpoint)
+		if *embeddingProvider != relevance.LocalLiteProvider { // Built in, with no model or endpoint
+			fmt.Printf("Embedding Model: %s\n", *embeddingModel)
+			fmt.Printf("Embedding Endpoint: %s\n", *embeddingEndpoint)
+		}
 	}
 	fmt.Println("---------------------")
 
@@ -228,31 +1206,86 @@ func main() {
 
 	// Configure the walker
 	walkerOpts := walker.Options{
-		TargetPath:     absTargetPath,
-		IgnorePatterns: ignorePatterns, // Pass user-provided ignores
+		TargetPath:       absTargetPath,
+		FS:               walkFS,
+		IgnorePatterns:   ignorePatterns, // Pass user-provided ignores
+		IncludePatterns:  includePatterns,
+		MaxDepth:         *maxDepth,
+		MinSize:          minSizeBytes,
+		MaxSize:          maxSizeBytes,
+		Profiles:         activeProfiles,
+		TestMode:         testMode,
+		DisabledProfiles: profilesOff,
+		Modules:          modules,
+		OnlyModules:      onlyModules,
+		NoGitignore:      *noGitignore,
+		GitMode:          gitMode,
+		GitBase:          *gitDiff,
+		ClassPolicy:      classPolicy,
+		Workers:          *walkWorkers,
+		FollowSymlinks:   *followSymlinks,
+		SymlinkAllow:     symlinkAllow,
 	}
 
+	// Stop the walk early when the user presses Ctrl+C
+	walkCtx, stopWalk := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stopWalk()
+
 	fmt.Println("\nWalking directory...")
 	var foundFiles []string
 	var foundDirs []string
+	fileMeta := make(map[string]output.FileMeta)
+	candidateMeta := make(map[string]walker.Metadata)
+	candidateModules := make(map[string]string)
+	var walkResults []walker.Result // Kept for the watch baseline
 
-	resultsChan := walker.Walk(walkerOpts)
-	for result := range resultsChan {
-		if result.Err != nil {
-			fmt.Fprintf(os.Stderr, "Error during walk: %v\n", result.Err)
-			continue // Or handle error more robustly
-		}
+	// recordResult adds a walked file or directory to the candidates
+	recordResult := func(result walker.Result) {
 		// Ignore the root '.' reported by walker itself if present
 		if result.Path == "." {
-			continue
+			return
 		}
 		if result.IsDir {
 			foundDirs = append(foundDirs, result.Path)
-		} else {
-			foundFiles = append(foundFiles, result.Path)
+			return
+		}
+		foundFiles = append(foundFiles, result.Path)
+		candidateMeta[result.Path] = result.Metadata
+		candidateModules[result.Path] = result.Module
+		fileMeta[result.Path] = output.FileMeta{
+			GitStatus: string(result.GitStatus),
+			OldPath:   result.OldPath,
+			Language:  result.Language,
+			Size:      result.Size,
+			Lines:     result.Lines,
+			Tests:     result.Tests,
+			Module:    moduleByPath[result.Module].String(),
+		}
+	}
+
+	resultsChan := walker.WalkContext(walkCtx, walkerOpts)
+	for result := range resultsChan {
+		var linkErr *walker.SymlinkError
+		if errors.As(result.Err, &linkErr) {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", linkErr)
+			continue
+		}
+		if result.Err != nil {
+			fmt.Fprintf(os.Stderr, "Error during walk: %v\n", result.Err)
+			continue // Or handle error more robustly
+		}
+		recordResult(result)
+		if *watchFlag {
+			walkResults = append(walkResults, result)
 		}
 	}
 
+	if walkCtx.Err() != nil {
+		fmt.Println("Walk interrupted.")
+		os.Exit(130)
+	}
+	stopWalk()
+
 	fmt.Printf("Found %d files and %d directories after filtering.\n", len(foundFiles), len(foundDirs))
 
 	// Manual detection of --use-embeddings flag if not set via flag package
@@ -329,10 +1362,52 @@ func main() {
 		}
 	}
 
+	// Manual detection of OpenAI-compatible embedding flags
+	if value, ok := argValue("embedding-dimensions"); ok {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			fmt.Printf("Error: invalid --embedding-dimensions value %q\n", value)
+			os.Exit(1)
+		}
+		*embeddingDimensions = n
+	}
+	if len(embeddingHeaders) == 0 {
+		embeddingHeaders = argValues("embedding-header")
+	}
+	embeddingHeaderMap := parseHeaders(embeddingHeaders)
+
+	// Manual detection of embedding batching flags
+	for _, intFlag := range []struct {
+		name  string
+		value *int
+	}{{"embedding-batch-size", embeddingBatchSize}, {"embedding-concurrency", embeddingConcurrency}} {
+		if value, ok := argValue(intFlag.name); ok {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				fmt.Printf("Error: invalid --%s value %q\n", intFlag.name, value)
+				os.Exit(1)
+			}
+			*intFlag.value = n
+		}
+	}
+	if value, ok := argValue("embedding-rate"); ok {
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			fmt.Printf("Error: invalid --embedding-rate value %q\n", value)
+			os.Exit(1)
+		}
+		*embeddingRate = rate
+	}
+	embeddingBatch := relevance.BatchOptions{
+		BatchSize:   *embeddingBatchSize,
+		Concurrency: *embeddingConcurrency,
+		RateLimit:   *embeddingRate,
+	}
+
 	// If embedding API key is not set, fall back to LLM API key for backward compatibility
 	if embeddingApiKeyValue == "" {
 		// Only use LLM API key as fallback for providers that need one
-		if *embeddingProvider != "ollama" && *embeddingProvider != "local" {
+		if *embeddingProvider != "ollama" && *embeddingProvider != "local" && *embeddingProvider != relevance.LocalLiteProvider {
 			embeddingApiKeyValue = *llmApiKey
 			if embeddingApiKeyValue != "" {
 				fmt.Println("DEBUG: Using LLM API key for embeddings since no dedicated embedding API key was provided")
@@ -342,106 +1417,318 @@ func main() {
 		}
 	} else {
 		// Only show this message for providers that need an API key
-		if *embeddingProvider != "ollama" && *embeddingProvider != "local" {
+		if *embeddingProvider != "ollama" && *embeddingProvider != "local" && *embeddingProvider != relevance.LocalLiteProvider {
 			fmt.Println("DEBUG: Using separate embedding API key")
 		} else {
 			fmt.Printf("NOTE: Embedding API key provided but not needed for provider '%s'\n", *embeddingProvider)
 		}
 	}
 
+	// Configure the LLM provider, used for summaries and for reranking
+	llmConfig := llm.Config{
+		APIKey:    *llmApiKey,
+		Endpoint:  *llmEndpoint,
+		ModelName: *llmModel,
+		Provider:  *llmProvider,
+		Headers:   parseHeaders(llmHeaders),
+	}
+
+	provider, err := llm.NewProvider(llmConfig)
+	if err != nil {
+		fmt.Printf("Error creating LLM provider: %v\n", err)
+		os.Exit(1)
+	}
+
 	// --- Relevance Identification ---
 	fmt.Println("\nIdentifying relevant files...")
 
-	var relevantFileInfos []relevance.FileInfo
-	var relevanceErr error
-
 	// Add extra debug log before creating options
 	fmt.Printf("DEBUG: Initializing EmbeddingOptions with Provider: '%s', Model: '%s', Endpoint: '%s'\n", *embeddingProvider, *embeddingModel, *embeddingEndpoint)
 
 	// Extra debug to verify final values
 	fmt.Printf("DEBUG: FINAL CONFIRMATION - Will use embedding model: '%s' with provider: '%s'\n", *embeddingModel, *embeddingProvider)
 
-	// Configure embedding options if using embeddings or hybrid search
-	embeddingOpts := relevance.EmbeddingOptions{
-		Provider:        *embeddingProvider,
-		Query:           query,
-		TargetPath:      absTargetPath,
-		CandidateFiles:  foundFiles,
-		MaxFilesToCheck: 20, // Consider top 20 most relevant files
-		Model:           *embeddingModel,
-		Endpoint:        *embeddingEndpoint,
-		APIKey:          embeddingApiKeyValue,
+	// Open the on-disk cache used by the embedding and hybrid modes
+	var embeddingCache *embedcache.Cache
+	if (*useEmbeddings || *useHybridSearch) && !*noCache {
+		cacheDir := *cacheDirFlag
+		if cacheDir == "" {
+			cacheDir = defaultCacheDir(absTargetPath)
+		}
+		embeddingCache, err = embedcache.Open(cacheDir, cacheMaxBytes)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Embedding cache disabled: %v\n", err)
+			embeddingCache = nil
+		} else {
+			fmt.Printf("Embedding cache: %s\n", cacheDir)
+		}
 	}
 
-	if *useHybridSearch {
-		// Use hybrid approach (embeddings + keywords + path relevance)
-		fmt.Println("Using hybrid relevance detection (embeddings + keywords + path relevance)...")
-		relevantFileInfos, relevanceErr = relevance.IdentifyRelevantFilesWithHybridApproach(embeddingOpts)
-		if relevanceErr != nil {
-			fmt.Printf("Error with hybrid relevance detection: %v\n", relevanceErr)
-			fmt.Println("Falling back to keyword-based relevance detection...")
-
-			// Fall back to keyword-based method
-			relevanceOpts := relevance.Options{
-				Query:           query,
-				TargetPath:      absTargetPath,
-				CandidateFiles:  foundFiles,
-				MaxFilesToCheck: 20, // Consider top 20 most relevant files
+	// In watch mode the vector index stays open between updates, so that
+	// only changed files are embedded and indexed again
+	var vectorIndex *vectorindex.Index
+	if *watchFlag && (*useEmbeddings || *useHybridSearch) {
+		vectorIndex = vectorindex.New(vectorindex.Params{})
+		if embeddingCache != nil && *embeddingProvider != relevance.LocalLiteProvider { // Local-lite vectors are never saved
+			indexPath := relevance.VectorIndexPath(embeddingCache.Dir(), relevance.EmbeddingOptions{
+				Provider:   *embeddingProvider,
+				Model:      *embeddingModel,
+				Dimensions: *embeddingDimensions,
+				Chunking:   chunking,
+			})
+			loaded, err := vectorindex.Load(indexPath)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: Rebuilding vector index: %v\n", err)
+			} else {
+				embeddingCache.Touch(indexPath)
+				vectorIndex = loaded
 			}
+		}
+	}
 
-			relevantFileInfos, relevanceErr = relevance.IdentifyRelevantFiles(relevanceOpts)
+	var lexicalIndex *relevance.Index // Kept up to date in watch mode; nil indexes the candidates each time
+
+	// identifyRelevant scores candidates with the configured relevance method
+	// and returns the best maxFiles of them, at most perModule per module
+	identifyRelevant := func(candidates []string, maxFiles int, perModule int) ([]relevance.FileInfo, error) {
+		var relevantFileInfos []relevance.FileInfo
+		var relevanceErr error
+
+		// Configure embedding options if using embeddings or hybrid search
+		embeddingOpts := relevance.EmbeddingOptions{
+			Provider:        *embeddingProvider,
+			Query:           query,
+			TargetPath:      absTargetPath,
+			FS:              src.FS,
+			CandidateFiles:  candidates,
+			CandidateMeta:   candidateMeta,
+			MaxFilesToCheck: maxFiles,
+			Model:           *embeddingModel,
+			Endpoint:        *embeddingEndpoint,
+			APIKey:          embeddingApiKeyValue,
+
+			CandidateModules:  candidateModules,
+			MaxFilesPerModule: perModule,
+			Index:             lexicalIndex,
+			Cache:             embeddingCache,
+			Chunking:          chunking,
+			Vectors:           vectorIndex,
+			Dimensions:        *embeddingDimensions,
+			Headers:           embeddingHeaderMap,
+			Batch:             embeddingBatch,
+			Fusion:            fusion,
+			Analyzer:          analyzer,
+		}
+
+		if *useHybridSearch {
+			// Use hybrid approach (embeddings + keywords + path relevance)
+			fmt.Println("Using hybrid relevance detection (embeddings + keywords + path relevance)...")
+			relevantFileInfos, relevanceErr = relevance.IdentifyRelevantFilesWithHybridApproach(embeddingOpts)
 			if relevanceErr != nil {
-				fmt.Printf("Error identifying relevant files: %v\n", relevanceErr)
-				os.Exit(1)
+				fmt.Printf("Error with hybrid relevance detection: %v\n", relevanceErr)
+				fmt.Println("Falling back to keyword-based relevance detection...")
+
+				// Fall back to keyword-based method
+				relevanceOpts := relevance.Options{
+					Query:           query,
+					TargetPath:      absTargetPath,
+					FS:              src.FS,
+					CandidateFiles:  candidates,
+					CandidateMeta:   candidateMeta,
+					MaxFilesToCheck: maxFiles,
+
+					CandidateModules:  candidateModules,
+					MaxFilesPerModule: perModule,
+					Index:             lexicalIndex,
+					Analyzer:          analyzer,
+				}
+
+				relevantFileInfos, relevanceErr = relevance.IdentifyRelevantFiles(relevanceOpts)
+				if relevanceErr != nil {
+					return nil, relevanceErr
+				}
 			}
-		}
-	} else if *useEmbeddings {
-		// Use embedding-based relevance detection
-		fmt.Println("Using embedding-based relevance detection for more accurate results...")
-		relevantFileInfos, relevanceErr = relevance.IdentifyRelevantFilesWithEmbeddings(embeddingOpts)
-		if relevanceErr != nil {
-			fmt.Printf("Error with embedding-based relevance detection: %v\n", relevanceErr)
-			fmt.Println("Falling back to keyword-based relevance detection...")
+		} else if *useEmbeddings {
+			// Use embedding-based relevance detection
+			fmt.Println("Using embedding-based relevance detection for more accurate results...")
+			relevantFileInfos, relevanceErr = relevance.IdentifyRelevantFilesWithEmbeddings(embeddingOpts)
+			if relevanceErr != nil {
+				fmt.Printf("Error with embedding-based relevance detection: %v\n", relevanceErr)
+				fmt.Println("Falling back to keyword-based relevance detection...")
+
+				// Fall back to keyword-based method
+				relevanceOpts := relevance.Options{
+					Query:           query,
+					TargetPath:      absTargetPath,
+					FS:              src.FS,
+					CandidateFiles:  candidates,
+					CandidateMeta:   candidateMeta,
+					MaxFilesToCheck: maxFiles,
+
+					CandidateModules:  candidateModules,
+					MaxFilesPerModule: perModule,
+					Index:             lexicalIndex,
+					Analyzer:          analyzer,
+				}
 
-			// Fall back to keyword-based method
+				relevantFileInfos, relevanceErr = relevance.IdentifyRelevantFiles(relevanceOpts)
+				if relevanceErr != nil {
+					return nil, relevanceErr
+				}
+			}
+		} else {
+			// Use the original keyword-based method
 			relevanceOpts := relevance.Options{
 				Query:           query,
 				TargetPath:      absTargetPath,
-				CandidateFiles:  foundFiles,
-				MaxFilesToCheck: 20, // Consider top 20 most relevant files
+				FS:              src.FS,
+				CandidateFiles:  candidates,
+				CandidateMeta:   candidateMeta,
+				MaxFilesToCheck: maxFiles,
+
+				CandidateModules:  candidateModules,
+				MaxFilesPerModule: perModule,
+				Index:             lexicalIndex,
+				Analyzer:          analyzer,
 			}
 
 			relevantFileInfos, relevanceErr = relevance.IdentifyRelevantFiles(relevanceOpts)
 			if relevanceErr != nil {
-				fmt.Printf("Error identifying relevant files: %v\n", relevanceErr)
-				os.Exit(1)
+				return nil, relevanceErr
 			}
 		}
-	} else {
-		// Use the original keyword-based method
-		relevanceOpts := relevance.Options{
-			Query:           query,
-			TargetPath:      absTargetPath,
-			CandidateFiles:  foundFiles,
-			MaxFilesToCheck: 20, // Consider top 20 most relevant files
+
+		return relevantFileInfos, nil
+	}
+
+	const explainRunnersUp = 10    // Files ranked just below the selection that --explain-json covers too
+	selectFiles := cutoff.MaxFiles // Files taken from the scores, more when the rerank pass picks among them
+	if selectFiles == 0 {
+		selectFiles = len(foundFiles) // --cutoff tokens without --max-files
+	}
+	if *rerankFlag {
+		selectFiles = max(cutoff.MaxFiles, *rerankTopN)
+	}
+	if explaining {
+		selectFiles += explainRunnersUp
+	}
+
+	// finalRanking lets the LLM reorder the best candidates, keeping the
+	// grades of unchanged files between watch mode updates, explains the
+	// ranking when asked to and keeps the files the cutoff accepts
+	judgements := make(map[string]relevance.Judgement)
+	finalRanking := func(files []relevance.FileInfo) []relevance.FileInfo {
+		if *rerankFlag {
+			for i := range files {
+				if judgement, ok := judgements[files[i].Path]; ok {
+					files[i].Judgement = &judgement
+				}
+			}
+			reranked, err := relevance.Rerank(provider, query, src.FS, files, rerankOpts)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: Rerank skipped: %v\n", err)
+			} else {
+				files = reranked
+				for _, file := range files {
+					if file.Judgement != nil {
+						judgements[file.Path] = *file.Judgement
+					}
+				}
+			}
+		}
+		selected := relevance.SelectFiles(src.FS, files, cutoff)
+		if cutoff.Strategy != "fixed" {
+			fmt.Printf("Cutoff (%s) kept %d of %d ranked files\n", cutoff, len(selected), len(files))
+		}
+		if explaining {
+			relevance.Explain(src.FS, query, analyzer, files, len(selected))
+			if *explainJSON != "" {
+				if err := relevance.WriteExplanations(*explainJSON, query, files); err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+				} else {
+					fmt.Printf("Explanations written to %s\n", *explainJSON)
+				}
+			}
 		}
+		return selected
+	}
 
-		relevantFileInfos, relevanceErr = relevance.IdentifyRelevantFiles(relevanceOpts)
-		if relevanceErr != nil {
-			fmt.Printf("Error identifying relevant files: %v\n", relevanceErr)
-			os.Exit(1)
+	var relevantFileInfos []relevance.FileInfo
+	var relevanceErr error
+	scores := make(map[string]relevance.FileInfo) // Every positive score, kept in watch mode
+	if *watchFlag {
+		// Score every candidate so that changed files can later be ranked
+		// against the rest without scoring everything again
+		lexicalIndex = relevance.BuildIndex(src.FS, foundFiles)
+		var allFiles []relevance.FileInfo
+		allFiles, relevanceErr = identifyRelevant(foundFiles, len(foundFiles), 0)
+		for _, fileInfo := range allFiles {
+			scores[fileInfo.Path] = fileInfo
+		}
+		relevantFileInfos = relevance.TopFiles(allFiles, selectFiles, *maxFilesPerModule)
+	} else {
+		relevantFileInfos, relevanceErr = identifyRelevant(foundFiles, selectFiles, *maxFilesPerModule)
+	}
+	if relevanceErr != nil {
+		fmt.Printf("Error identifying relevant files: %v\n", relevanceErr)
+		os.Exit(1)
+	}
+	relevantFileInfos = finalRanking(relevantFileInfos)
+
+	// recordMatches shows the best matching line ranges of a file in the
+	// report, and why the file was selected in --explain mode
+	recordMatches := func(fileInfo relevance.FileInfo) {
+		meta := fileMeta[fileInfo.Path]
+		meta.Matches = nil
+		for _, match := range fileInfo.Matches {
+			meta.Matches = append(meta.Matches, match.String())
 		}
+		meta.Explanation = ""
+		if *explainFlag && fileInfo.Explanation != nil {
+			meta.Explanation = fileInfo.Explanation.Markdown()
+		}
+		fileMeta[fileInfo.Path] = meta
 	}
 
 	// Extract just the paths from the FileInfo objects
 	var relevantFiles []string
 	for _, fileInfo := range relevantFileInfos {
 		relevantFiles = append(relevantFiles, fileInfo.Path)
-		fmt.Printf("Relevant file: %s (score: %.2f)\n", fileInfo.Path, fileInfo.Score)
+		recordMatches(fileInfo)
+		details := fmt.Sprintf("score: %.2f", fileInfo.Score)
+		if len(fileInfo.Matches) > 0 {
+			details += fmt.Sprintf(", best match: %s", fileInfo.Matches[0])
+		}
+		if fileInfo.Judgement != nil {
+			details += fmt.Sprintf(", LLM grade: %d/%d, %s", fileInfo.Judgement.Grade, relevance.MaxGrade, fileInfo.Judgement.Reason)
+		}
+		fmt.Printf("Relevant file: %s (%s)\n", fileInfo.Path, details)
 	}
 
 	fmt.Printf("Identified %d relevant files out of %d total files.\n", len(relevantFiles), len(foundFiles))
 
+	// In attach mode, the tests covering each relevant file are analyzed with it
+	withTests := func(files []string) []string {
+		if testMode != walker.TestsAttach {
+			return files
+		}
+		seen := make(map[string]bool)
+		for _, file := range files {
+			seen[file] = true
+		}
+		for _, file := range files {
+			for _, test := range fileMeta[file].Tests {
+				if !seen[test] {
+					seen[test] = true
+					files = append(files, test)
+					fmt.Printf("Attached test: %s (covers %s)\n", test, file)
+				}
+			}
+		}
+		return files
+	}
+	relevantFiles = withTests(relevantFiles)
+
 	// Generate tree (after identifying relevant files)
 	var treeString string // Variable to hold the generated tree
 	if showTreeFlag {
@@ -453,36 +1740,8 @@ func main() {
 	// --- LLM Interaction ---
 	fmt.Println("\nGenerating summaries via LLM...")
 
-	// Parse headers if provided
-	headers := make(map[string]string)
-	for _, header := range llmHeaders {
-		parts := strings.SplitN(header, ":", 2)
-		if len(parts) == 2 {
-			key := strings.TrimSpace(parts[0])
-			value := strings.TrimSpace(parts[1])
-			headers[key] = value
-		} else {
-			fmt.Fprintf(os.Stderr, "Warning: invalid header format (expected 'key:value'): %s\n", header)
-		}
-	}
-
-	// Configure the LLM provider
-	llmConfig := llm.Config{
-		APIKey:    *llmApiKey,
-		Endpoint:  *llmEndpoint,
-		ModelName: *llmModel,
-		Provider:  *llmProvider,
-		Headers:   headers,
-	}
-
-	provider, err := llm.NewProvider(llmConfig)
-	if err != nil {
-		fmt.Printf("Error creating LLM provider: %v\n", err)
-		os.Exit(1)
-	}
-
 	// Single-service mode - Generate summaries for relevant files
-	summaries, err := llm.GenerateSummaries(provider, query, absTargetPath, relevantFiles)
+	summaries, err := llm.GenerateSummariesFS(provider, query, src.FS, relevantFiles)
 	if err != nil {
 		fmt.Printf("Error generating summaries: %v\n", err)
 		os.Exit(1)
@@ -492,11 +1751,153 @@ func main() {
 
 	// --- Output Generation (Markdown) ---
 	fmt.Println("\nGenerating Markdown output...")
-	err = output.GenerateMarkdown(outputFileName, query, absTargetPath, showTreeFlag, treeString, summaries)
+	err = output.GenerateMarkdown(outputFileName, query, absTargetPath, showTreeFlag, treeString, summaries, fileMeta)
 	if err != nil {
 		fmt.Printf("Error generating Markdown: %v\n", err)
 		os.Exit(1)
 	}
 
 	fmt.Println("\nAnalysis complete. Output file saved to", outputFileName)
+
+	// --- Watch Mode ---
+	if !*watchFlag {
+		return
+	}
+
+	// Summaries are cached by file and only regenerated for changed files;
+	// failed ones are retried on the next update
+	summaryCache := make(map[string]string)
+	cacheSummaries := func(fresh map[string]string) {
+		for path, summary := range fresh {
+			if !strings.HasPrefix(summary, "Error: ") {
+				summaryCache[path] = summary
+			}
+		}
+	}
+	cacheSummaries(summaries)
+
+	// updateReport re-scores the changed files, summarizes files that are
+	// new to the report or changed, and rewrites the Markdown output
+	updateReport := func(ctx context.Context, changes watch.Changes, results []walker.Result) error {
+		fmt.Printf("\n[%s] Changes detected: %s\n", time.Now().Format("15:04:05"), changes)
+
+		// Rebuild the candidates from the new walk
+		previousMeta := candidateMeta
+		foundFiles, foundDirs = nil, nil
+		fileMeta = make(map[string]output.FileMeta)
+		candidateMeta = make(map[string]walker.Metadata)
+		candidateModules = make(map[string]string)
+		for _, result := range results {
+			if result.Err == nil {
+				recordResult(result)
+			}
+		}
+
+		// Only files whose content differs need new scores and summaries; a
+		// new modification time alone (touch, checkout) is not enough
+		var rescore []string
+		for _, path := range append(append([]string{}, changes.Added...), changes.Modified...) {
+			meta, isCandidate := candidateMeta[path]
+			if old, ok := previousMeta[path]; ok && isCandidate && old.Hash != "" && old.Hash == meta.Hash {
+				continue
+			}
+			delete(summaryCache, path)
+			delete(judgements, path)
+			if isCandidate {
+				delete(scores, path)
+				rescore = append(rescore, path)
+			}
+		}
+		for _, path := range changes.Removed {
+			delete(summaryCache, path)
+			delete(scores, path)
+			lexicalIndex.Remove(path)
+		}
+		for path, fileInfo := range scores {
+			if _, ok := candidateMeta[path]; !ok {
+				delete(scores, path) // No longer a candidate (e.g. filtered out now)
+				lexicalIndex.Remove(path)
+				continue
+			}
+			fileInfo.Meta = candidateMeta[path]
+			scores[path] = fileInfo
+		}
+
+		if len(rescore) > 0 {
+			fmt.Printf("Re-scoring %d changed files...\n", len(rescore))
+			for _, path := range rescore {
+				content, err := fs.ReadFile(src.FS, filepath.ToSlash(path))
+				if err != nil {
+					lexicalIndex.Remove(path)
+					continue
+				}
+				lexicalIndex.Add(path, content)
+			}
+			rescored, err := identifyRelevant(rescore, len(rescore), 0)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: Error re-scoring changed files: %v\n", err)
+			}
+			for _, fileInfo := range rescored {
+				scores[fileInfo.Path] = fileInfo
+			}
+		}
+
+		// Rank all scores again and summarize what the report is missing
+		var allFiles []relevance.FileInfo
+		for _, fileInfo := range scores {
+			allFiles = append(allFiles, fileInfo)
+		}
+		relevance.Fuse(allFiles, fusion) // Normalization and ranks depend on every file, not only the changed ones
+		relevantFiles = nil
+		for _, fileInfo := range finalRanking(relevance.TopFiles(allFiles, selectFiles, *maxFilesPerModule)) {
+			relevantFiles = append(relevantFiles, fileInfo.Path)
+			recordMatches(fileInfo)
+		}
+		relevantFiles = withTests(relevantFiles)
+
+		reportSummaries := make(map[string]string)
+		var missing []string
+		for _, path := range relevantFiles {
+			if summary, ok := summaryCache[path]; ok {
+				reportSummaries[path] = summary
+			} else {
+				missing = append(missing, path)
+			}
+		}
+		if len(missing) > 0 {
+			fresh, err := llm.GenerateSummariesFS(provider, query, src.FS, missing)
+			if err != nil {
+				return fmt.Errorf("error generating summaries: %w", err)
+			}
+			for path, summary := range fresh {
+				reportSummaries[path] = summary
+			}
+			cacheSummaries(fresh)
+		}
+		treeString = ""
+		if showTreeFlag {
+			treeString = tree.Generate(absTargetPath, foundFiles, foundDirs, relevantFiles)
+		}
+		if err := output.GenerateMarkdown(outputFileName, query, absTargetPath, showTreeFlag, treeString, reportSummaries, fileMeta); err != nil {
+			return fmt.Errorf("error generating Markdown: %w", err)
+		}
+
+		fmt.Printf("Report updated: %d relevant files, %d re-scored, %d summaries regenerated.\n", len(relevantFiles), len(rescore), len(missing))
+		return nil
+	}
+
+	watchCtx, stopWatch := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stopWatch()
+
+	watcher := &watch.Watcher{
+		Options:  walkerOpts,
+		Interval: pollInterval,
+		OnChange: updateReport,
+	}
+	fmt.Printf("\nWatching %s for changes every %s (press Ctrl+C to stop)...\n", absTargetPath, pollInterval)
+	if err := watcher.Run(watchCtx, watch.NewSnapshot(src.FS, walkResults)); err != nil {
+		fmt.Printf("Error in watch mode: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("\nWatch stopped.")
 }